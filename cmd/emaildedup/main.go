@@ -0,0 +1,119 @@
+// Command emaildedup reports accounts whose emails collide once normalized
+// (case-folded, and with -idn or EMAIL_NORMALIZE_IDN set, IDN domains in
+// punycode). Such duplicates must be merged or removed by hand before the
+// case-insensitive email index can be created, or IDN normalization
+// enabled. With -rewrite the other emails are stored in normalized form:
+//
+//	emaildedup
+//	emaildedup -idn -rewrite
+//
+// The report is written to stdout as JSON and the exit status is 1 when
+// duplicates were found.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/kimutaiwycliff/auth-service/config"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+	"github.com/kimutaiwycliff/auth-service/pkg/database"
+)
+
+type account struct {
+	ID        string     `json:"id"`
+	Email     string     `json:"email"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type duplicateGroup struct {
+	NormalizedEmail string    `json:"normalized_email"`
+	Accounts        []account `json:"accounts"` // oldest first
+}
+
+type report struct {
+	Scanned int `json:"scanned"`
+	// Unnormalized counts emails that are stored in a non-canonical form.
+	// Without -rewrite they are rewritten on their next save.
+	Unnormalized int `json:"unnormalized"`
+	// Rewritten counts emails stored in normalized form by -rewrite.
+	// Duplicates are left as they are.
+	Rewritten  int              `json:"rewritten"`
+	Duplicates []duplicateGroup `json:"duplicates"`
+}
+
+func main() {
+	idn := flag.Bool("idn", false, "convert international domains to punycode, even if EMAIL_NORMALIZE_IDN is off")
+	rewrite := flag.Bool("rewrite", false, "store emails that aren't duplicates in normalized form")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+	emails := utils.EmailNormalizer{IDN: *idn || cfg.Email.NormalizeIDN}
+
+	db, err := database.NewPostgresDB(cfg.DB.DSN, cfg.DB.MaxOpenConns)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close(db)
+
+	// Soft-deleted accounts still hold their email until purged
+	rows, err := db.Table("users").
+		Select("id, email, created_at, deleted_at").
+		Order("created_at").
+		Rows()
+	if err != nil {
+		log.Fatalf("Failed to query users: %v", err)
+	}
+	defer rows.Close()
+
+	out := report{Duplicates: []duplicateGroup{}}
+	groups := map[string][]account{}
+	for rows.Next() {
+		var a account
+		if err := rows.Scan(&a.ID, &a.Email, &a.CreatedAt, &a.DeletedAt); err != nil {
+			log.Fatalf("Failed to read user: %v", err)
+		}
+
+		normalized := emails.Normalize(a.Email)
+		if normalized != a.Email {
+			out.Unnormalized++
+		}
+		groups[normalized] = append(groups[normalized], a)
+		out.Scanned++
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("Failed to read users: %v", err)
+	}
+
+	for email, accounts := range groups {
+		if len(accounts) > 1 {
+			out.Duplicates = append(out.Duplicates, duplicateGroup{NormalizedEmail: email, Accounts: accounts})
+			continue
+		}
+		if *rewrite && accounts[0].Email != email {
+			err := db.Table("users").Where("id = ?", accounts[0].ID).Update("email", email).Error
+			if err != nil {
+				log.Fatalf("Failed to rewrite email of user %s: %v", accounts[0].ID, err)
+			}
+			out.Rewritten++
+		}
+	}
+	sort.Slice(out.Duplicates, func(i, j int) bool {
+		return out.Duplicates[i].NormalizedEmail < out.Duplicates[j].NormalizedEmail
+	})
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+
+	if len(out.Duplicates) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,93 @@
+// Command importusers bulk-imports users with password hashes exported from
+// another system. The input file uses the same JSON format as
+// POST /api/v1/admin/users/import:
+//
+//	importusers -file users.json
+//	importusers -file - < users.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/kimutaiwycliff/auth-service/config"
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/kimutaiwycliff/auth-service/internal/services"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+	"github.com/kimutaiwycliff/auth-service/pkg/database"
+)
+
+func main() {
+	file := flag.String("file", "", "path to the import file, or - for stdin")
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var in io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatalf("Failed to open import file: %v", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var req models.UserImportRequest
+	if err := json.NewDecoder(in).Decode(&req); err != nil {
+		log.Fatalf("Failed to parse import file: %v", err)
+	}
+
+	cfg := config.LoadConfig()
+	db, err := database.NewPostgresDB(cfg.DB.DSN, cfg.DB.MaxOpenConns)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close(db)
+
+	if err := database.Migrate(db); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	importService := services.NewImportService(repositories.NewUserRepository(db, utils.EmailNormalizer{IDN: cfg.Email.NormalizeIDN}))
+
+	total := models.UserImportResult{}
+	for start := 0; start < len(req.Users); start += services.MaxImportBatchSize {
+		end := min(start+services.MaxImportBatchSize, len(req.Users))
+		batch := models.UserImportRequest{
+			Users:          req.Users[start:end],
+			FirebaseScrypt: req.FirebaseScrypt,
+		}
+
+		result, err := importService.ImportUsers(&batch)
+		if err != nil {
+			log.Fatalf("Import failed at user %d: %v", start, err)
+		}
+
+		total.Imported += result.Imported
+		total.Skipped += result.Skipped
+		total.Failed += result.Failed
+		for _, importErr := range result.Errors {
+			importErr.Index += start
+			total.Errors = append(total.Errors, importErr)
+		}
+		log.Printf("Processed %d/%d users", end, len(req.Users))
+	}
+
+	out := json.NewEncoder(os.Stdout)
+	out.SetIndent("", "  ")
+	if err := out.Encode(total); err != nil {
+		log.Fatalf("Failed to write result: %v", err)
+	}
+
+	if total.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -2,16 +2,21 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // timezone validation must work in images without zoneinfo
 
 	"github.com/kimutaiwycliff/auth-service/config"
 	"github.com/kimutaiwycliff/auth-service/internal/api"
 	"github.com/kimutaiwycliff/auth-service/internal/repositories"
 	"github.com/kimutaiwycliff/auth-service/internal/services"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
 	"github.com/kimutaiwycliff/auth-service/pkg/database"
 	"github.com/kimutaiwycliff/auth-service/pkg/redis"
 	"gorm.io/gorm"
@@ -20,7 +25,7 @@ import (
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
-	log.Printf("Loaded configuration: %+v", cfg)
+	utils.EmailDomains = newEmailDomainPolicy(cfg)
 
 	// Initialize database with retry logic
 	var db *gorm.DB
@@ -69,15 +74,95 @@ func main() {
 
 	// Rest of your main function remains the same...
 	// Initialize layers
-	userRepo := repositories.NewUserRepository(db)
+	emails := utils.EmailNormalizer{IDN: cfg.Email.NormalizeIDN}
+	userRepo := repositories.NewUserRepository(db, emails)
+	roleRepo := repositories.NewRoleRepository(db)
+	orgRepo := repositories.NewOrganizationRepository(db)
+	invitationRepo := repositories.NewInvitationRepository(db, emails)
+	auditRepo := repositories.NewAuditRepository(db)
+	oauthClientRepo := repositories.NewOAuthClientRepository(db)
+	oauthScopeRepo := repositories.NewOAuthScopeRepository(db)
+	oauthConsentRepo := repositories.NewOAuthConsentRepository(db)
+	identityRepo := repositories.NewIdentityRepository(db)
 	jwtService := services.NewJWTService(cfg.JWT.Secret, cfg.JWT.AccessExpiry, cfg.JWT.RefreshExpiry)
-	authService := services.NewAuthService(userRepo, jwtService, redisClient)
-	authHandler := api.NewAuthHandler(authService)
-	middleware := api.NewMiddleware(jwtService, redisClient)
+	rbacService := services.NewRBACService(roleRepo, userRepo)
+	orgService := services.NewOrganizationService(orgRepo, roleRepo, userRepo)
+	auditService := services.NewAuditService(auditRepo)
+	authService := services.NewAuthService(userRepo, jwtService, redisClient, rbacService, orgService, auditService, emails, cfg.JWT.ProfileClaims)
+	importService := services.NewImportService(userRepo)
+	emailService := newEmailService(cfg)
+	invitationService := services.NewInvitationService(
+		invitationRepo, orgRepo, roleRepo, userRepo,
+		authService, jwtService, emailService, emails, cfg.Org.InvitationExpiry,
+	)
+	passwordResetService := services.NewPasswordResetService(
+		userRepo, authService, jwtService, emailService, auditService, cfg.Auth.PasswordResetExpiry,
+	)
+	userAdminService := services.NewUserAdminService(userRepo, authService, passwordResetService, auditService, emails)
+	usernamePolicy, err := utils.NewUsernamePolicy(
+		cfg.Username.MinLength, cfg.Username.MaxLength, cfg.Username.Pattern, cfg.Username.Reserved,
+	)
+	if err != nil {
+		log.Fatalf("Invalid username configuration: %v", err)
+	}
+	accountService := services.NewAccountService(
+		userRepo, oauthConsentRepo, identityRepo, authService, rbacService, orgService, jwtService, redisClient,
+		auditService, usernamePolicy, cfg.Auth.AccountDeletionGracePeriod,
+	)
+	emailChangeService := services.NewEmailChangeService(
+		userRepo, authService, jwtService, redisClient, emailService, auditService, emails, cfg.Auth.EmailChangeExpiry,
+	)
+	oauthScopeService := services.NewOAuthScopeService(oauthScopeRepo, oauthClientRepo)
+	oauthClientService := services.NewOAuthClientService(
+		oauthClientRepo, oauthScopeService, jwtService, redisClient, cfg.OAuth.Issuer, cfg.OAuth.SecretRollover,
+	)
+	oidcService := services.NewOIDCService(userRepo, jwtService, loadSigningKey(cfg), cfg.OAuth.Issuer)
+	oauthConsentService := services.NewOAuthConsentService(
+		oauthConsentRepo, oauthClientRepo, oauthScopeService, authService, auditService,
+	)
+	deviceService := services.NewDeviceAuthorizationService(
+		oauthClientService, oauthConsentService, redisClient, auditService,
+		cfg.OAuth.DeviceVerificationURL, cfg.OAuth.DeviceCodeExpiry, cfg.OAuth.DevicePollInterval,
+	)
+	oauthService := services.NewOAuthService(
+		oauthClientService, authService, oidcService, deviceService, oauthConsentService,
+		jwtService, redisClient, auditService, cfg.OAuth.CodeExpiry,
+	)
+	authHandler := api.NewAuthHandler(authService, passwordResetService, accountService, emailChangeService, cfg.Auth.ReauthenticationMaxAge)
+	adminHandler := api.NewAdminHandler(importService, rbacService, userAdminService)
+	orgHandler := api.NewOrganizationHandler(orgService)
+	invitationHandler := api.NewInvitationHandler(invitationService)
+	oauthHandler := api.NewOAuthHandler(
+		oauthService, oauthClientService, oauthScopeService, oauthConsentService,
+		oidcService, deviceService, cfg.OAuth.LoginURL,
+	)
+	externalLoginService, err := services.NewExternalLoginService(
+		loadIdentityProviders(cfg), identityRepo, userRepo, authService, redisClient, auditService,
+		emails, nil, cfg.OAuth.Issuer,
+	)
+	if err != nil {
+		log.Fatalf("Invalid identity provider configuration: %v", err)
+	}
+	externalLoginHandler := api.NewExternalLoginHandler(externalLoginService, cfg.External.CallbackURL)
+	middleware := api.NewMiddleware(authService, redisClient)
+
+	if err := rbacService.SeedDefaults(cfg.RBAC.BootstrapAdminEmails); err != nil {
+		log.Fatalf("Failed to seed roles: %v", err)
+	}
+	if err := oauthScopeService.SeedDefaults(); err != nil {
+		log.Fatalf("Failed to seed OAuth scopes: %v", err)
+	}
+
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	go runPurgeJob(purgeCtx, accountService, cfg.Auth.PurgeInterval)
 
 	// Create Fiber app
 	app := api.NewFiberApp(cfg)
-	api.SetupRoutes(app, authHandler, middleware)
+	api.SetupRoutes(
+		app, authHandler, adminHandler, orgHandler, invitationHandler, oauthHandler,
+		externalLoginHandler, middleware, cfg.Auth.ReauthenticationMaxAge,
+	)
 
 	// Graceful shutdown
 	go func() {
@@ -90,6 +175,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutting down server...")
+	stopPurge()
 
 	if err := app.Shutdown(); err != nil {
 		log.Fatalf("Server shutdown error: %v", err)
@@ -106,3 +192,91 @@ func main() {
 	}
 	log.Println("Server exited properly")
 }
+
+// runPurgeJob periodically removes accounts whose deletion grace period has
+// passed, until ctx is cancelled.
+func runPurgeJob(ctx context.Context, accountService services.AccountService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := accountService.PurgeDeletedAccounts(ctx)
+		if err != nil {
+			log.Printf("Account purge failed: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d deleted accounts", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func newEmailDomainPolicy(cfg *config.Config) *utils.EmailDomainPolicy {
+	disposableFile := ""
+	if cfg.Email.BlockDisposable {
+		disposableFile = cfg.Email.DisposableDomainsFile
+	}
+
+	policy, err := utils.NewEmailDomainPolicy(cfg.Email.AllowedDomains, cfg.Email.DeniedDomains, disposableFile)
+	if err != nil {
+		log.Fatalf("Invalid email domain configuration: %v", err)
+	}
+	return policy
+}
+
+// loadSigningKey reads the ID token signing key, or generates one when none
+// is configured.
+func loadSigningKey(cfg *config.Config) *rsa.PrivateKey {
+	if cfg.OAuth.SigningKeyFile == "" {
+		log.Println("WARNING: no OAuth signing key configured, ID tokens will not verify after a restart")
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			log.Fatalf("Failed to generate signing key: %v", err)
+		}
+		return key
+	}
+
+	data, err := os.ReadFile(cfg.OAuth.SigningKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to read signing key: %v", err)
+	}
+	key, err := utils.ParseRSAPrivateKey(data)
+	if err != nil {
+		log.Fatalf("Invalid signing key: %v", err)
+	}
+	return key
+}
+
+// loadIdentityProviders reads the upstream identity providers users can
+// sign in with.
+func loadIdentityProviders(cfg *config.Config) []services.IdentityProviderConfig {
+	if cfg.External.ProvidersFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(cfg.External.ProvidersFile)
+	if err != nil {
+		log.Fatalf("Failed to read identity providers: %v", err)
+	}
+	var providers []services.IdentityProviderConfig
+	if err := json.Unmarshal(data, &providers); err != nil {
+		log.Fatalf("Invalid identity providers: %v", err)
+	}
+	return providers
+}
+
+func newEmailService(cfg *config.Config) services.EmailService {
+	if cfg.Email.SMTPHost == "" {
+		log.Println("No SMTP host configured, emails will be logged")
+		return services.NewLogEmailService(cfg.Email.LinkBaseURL)
+	}
+	return services.NewSMTPEmailService(
+		cfg.Email.SMTPHost, cfg.Email.SMTPPort,
+		cfg.Email.SMTPUsername, cfg.Email.SMTPPassword,
+		cfg.Email.From, cfg.Email.LinkBaseURL,
+	)
+}
@@ -8,10 +8,17 @@ import (
 )
 
 type Config struct {
-	Server ServerConfig `mapstructure:"SERVER"`
-	DB     DBConfig     `mapstructure:"DB"`
-	JWT    JWTConfig    `mapstructure:"JWT"`
-	Redis  RedisConfig  `mapstructure:"REDIS"`
+	Server   ServerConfig   `mapstructure:"SERVER"`
+	DB       DBConfig       `mapstructure:"DB"`
+	JWT      JWTConfig      `mapstructure:"JWT"`
+	Redis    RedisConfig    `mapstructure:"REDIS"`
+	RBAC     RBACConfig     `mapstructure:"RBAC"`
+	Email    EmailConfig    `mapstructure:"EMAIL"`
+	Org      OrgConfig      `mapstructure:"ORG"`
+	Auth     AuthConfig     `mapstructure:"AUTH"`
+	Username UsernameConfig `mapstructure:"USERNAME"`
+	OAuth    OAuthConfig    `mapstructure:"OAUTH"`
+	External ExternalConfig `mapstructure:"EXTERNAL"`
 }
 
 type ServerConfig struct {
@@ -26,9 +33,13 @@ type DBConfig struct {
 }
 
 type JWTConfig struct {
-	Secret       string        `mapstructure:"SECRET"`
-	AccessExpiry time.Duration `mapstructure:"ACCESS_EXPIRY"`
+	Secret        string        `mapstructure:"SECRET"`
+	AccessExpiry  time.Duration `mapstructure:"ACCESS_EXPIRY"`
 	RefreshExpiry time.Duration `mapstructure:"REFRESH_EXPIRY"`
+	// ProfileClaims lists profile claims (email, name, given_name,
+	// family_name, preferred_username, locale, zoneinfo, picture) to include
+	// in access tokens.
+	ProfileClaims []string `mapstructure:"PROFILE_CLAIMS"`
 }
 
 type RedisConfig struct {
@@ -37,6 +48,91 @@ type RedisConfig struct {
 	DB       int    `mapstructure:"DB"`
 }
 
+type RBACConfig struct {
+	// BootstrapAdminEmails are granted the admin role at startup.
+	BootstrapAdminEmails []string `mapstructure:"BOOTSTRAP_ADMIN_EMAILS"`
+}
+
+type EmailConfig struct {
+	// SMTPHost may be left empty to log emails instead of sending them.
+	SMTPHost     string `mapstructure:"SMTP_HOST"`
+	SMTPPort     int    `mapstructure:"SMTP_PORT"`
+	SMTPUsername string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword string `mapstructure:"SMTP_PASSWORD"`
+	From         string `mapstructure:"FROM"`
+	// LinkBaseURL is the frontend that handles links sent by email.
+	LinkBaseURL string `mapstructure:"LINK_BASE_URL"`
+	// NormalizeIDN stores international email domains in punycode. Existing
+	// emails must be rewritten with cmd/emaildedup before it is enabled.
+	NormalizeIDN bool `mapstructure:"NORMALIZE_IDN"`
+	// When AllowedDomains is set only those domains (and their subdomains)
+	// can be used. DeniedDomains are always rejected.
+	AllowedDomains        []string `mapstructure:"ALLOWED_DOMAINS"`
+	DeniedDomains         []string `mapstructure:"DENIED_DOMAINS"`
+	BlockDisposable       bool     `mapstructure:"BLOCK_DISPOSABLE"`
+	DisposableDomainsFile string   `mapstructure:"DISPOSABLE_DOMAINS_FILE"`
+}
+
+type OrgConfig struct {
+	InvitationExpiry time.Duration `mapstructure:"INVITATION_EXPIRY"`
+}
+
+type AuthConfig struct {
+	PasswordResetExpiry time.Duration `mapstructure:"PASSWORD_RESET_EXPIRY"`
+	// AccountDeletionGracePeriod is how long a deleted account can still be
+	// restored before it is purged.
+	AccountDeletionGracePeriod time.Duration `mapstructure:"ACCOUNT_DELETION_GRACE_PERIOD"`
+	PurgeInterval              time.Duration `mapstructure:"PURGE_INTERVAL"`
+	// ReauthenticationMaxAge is how recently the user must have entered their
+	// password for sensitive actions such as changing their email.
+	ReauthenticationMaxAge time.Duration `mapstructure:"REAUTHENTICATION_MAX_AGE"`
+	EmailChangeExpiry      time.Duration `mapstructure:"EMAIL_CHANGE_EXPIRY"`
+}
+
+type UsernameConfig struct {
+	MinLength int    `mapstructure:"MIN_LENGTH"`
+	MaxLength int    `mapstructure:"MAX_LENGTH"`
+	Pattern   string `mapstructure:"PATTERN"`
+	// Reserved usernames can't be claimed, compared case-insensitively.
+	Reserved []string `mapstructure:"RESERVED"`
+}
+
+type OAuthConfig struct {
+	// Issuer is the public base URL of this server, used to identify it in
+	// tokens and client assertions.
+	Issuer string `mapstructure:"ISSUER"`
+	// SigningKeyFile is a PEM encoded RSA private key used to sign ID
+	// tokens. Without it a key is generated at startup, and ID tokens stop
+	// verifying after a restart.
+	SigningKeyFile string `mapstructure:"SIGNING_KEY_FILE"`
+	// LoginURL is the frontend page that signs the user in and completes
+	// authorization requests. /oauth/authorize redirects there with the
+	// request's parameters.
+	LoginURL   string        `mapstructure:"LOGIN_URL"`
+	CodeExpiry time.Duration `mapstructure:"CODE_EXPIRY"`
+	// SecretRollover is how long a client's previous secret keeps working
+	// after it is rotated.
+	SecretRollover time.Duration `mapstructure:"SECRET_ROLLOVER"`
+	// DeviceVerificationURL is the frontend page where users enter the
+	// user code of a device authorization request.
+	DeviceVerificationURL string        `mapstructure:"DEVICE_VERIFICATION_URL"`
+	DeviceCodeExpiry      time.Duration `mapstructure:"DEVICE_CODE_EXPIRY"`
+	// DevicePollInterval is how long devices must wait between token
+	// requests.
+	DevicePollInterval time.Duration `mapstructure:"DEVICE_POLL_INTERVAL"`
+}
+
+type ExternalConfig struct {
+	// ProvidersFile is a JSON array of the upstream OpenID Connect providers
+	// users can sign in with (see services.IdentityProviderConfig). Their
+	// redirect URI is <OAUTH.ISSUER>/api/v1/auth/providers/<name>/callback.
+	ProvidersFile string `mapstructure:"PROVIDERS_FILE"`
+	// CallbackURL is the frontend page users return to after signing in at
+	// a provider, with a login code to exchange for tokens, the name of the
+	// provider linked to their account or an error.
+	CallbackURL string `mapstructure:"CALLBACK_URL"`
+}
+
 func LoadConfig() *Config {
 	viper.SetConfigFile(".env")
 	viper.AutomaticEnv()
@@ -50,9 +146,43 @@ func LoadConfig() *Config {
 	viper.SetDefault("JWT.SECRET", "default-secret-change-me")
 	viper.SetDefault("JWT.ACCESS_EXPIRY", "15m")
 	viper.SetDefault("JWT.REFRESH_EXPIRY", "168h") // 7 days
+	viper.SetDefault("JWT.PROFILE_CLAIMS", []string{})
 	viper.SetDefault("REDIS.ADDR", "redis:6379")
 	viper.SetDefault("REDIS.PASSWORD", "")
 	viper.SetDefault("REDIS.DB", 0)
+	viper.SetDefault("RBAC.BOOTSTRAP_ADMIN_EMAILS", []string{})
+	viper.SetDefault("EMAIL.SMTP_HOST", "")
+	viper.SetDefault("EMAIL.SMTP_PORT", 587)
+	viper.SetDefault("EMAIL.FROM", "no-reply@localhost")
+	viper.SetDefault("EMAIL.LINK_BASE_URL", "http://localhost:8080")
+	viper.SetDefault("EMAIL.NORMALIZE_IDN", false)
+	viper.SetDefault("EMAIL.ALLOWED_DOMAINS", []string{})
+	viper.SetDefault("EMAIL.DENIED_DOMAINS", []string{})
+	viper.SetDefault("EMAIL.BLOCK_DISPOSABLE", false)
+	viper.SetDefault("EMAIL.DISPOSABLE_DOMAINS_FILE", "config/disposable_domains.txt")
+	viper.SetDefault("ORG.INVITATION_EXPIRY", "168h") // 7 days
+	viper.SetDefault("AUTH.PASSWORD_RESET_EXPIRY", "1h")
+	viper.SetDefault("AUTH.ACCOUNT_DELETION_GRACE_PERIOD", "720h") // 30 days
+	viper.SetDefault("AUTH.PURGE_INTERVAL", "1h")
+	viper.SetDefault("AUTH.REAUTHENTICATION_MAX_AGE", "5m")
+	viper.SetDefault("AUTH.EMAIL_CHANGE_EXPIRY", "24h")
+	viper.SetDefault("OAUTH.ISSUER", "http://localhost:3000")
+	viper.SetDefault("OAUTH.LOGIN_URL", "http://localhost:8080/oauth/authorize")
+	viper.SetDefault("OAUTH.CODE_EXPIRY", "1m")
+	viper.SetDefault("OAUTH.SECRET_ROLLOVER", "24h")
+	viper.SetDefault("OAUTH.DEVICE_VERIFICATION_URL", "http://localhost:8080/device")
+	viper.SetDefault("OAUTH.DEVICE_CODE_EXPIRY", "10m")
+	viper.SetDefault("OAUTH.DEVICE_POLL_INTERVAL", "5s")
+	viper.SetDefault("EXTERNAL.PROVIDERS_FILE", "")
+	viper.SetDefault("EXTERNAL.CALLBACK_URL", "http://localhost:8080/auth/callback")
+	viper.SetDefault("USERNAME.MIN_LENGTH", 3)
+	viper.SetDefault("USERNAME.MAX_LENGTH", 30)
+	viper.SetDefault("USERNAME.PATTERN", `^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	viper.SetDefault("USERNAME.RESERVED", []string{
+		"admin", "administrator", "root", "system", "support", "help",
+		"security", "api", "auth", "oauth", "login", "logout", "me",
+		"settings", "www", "mail", "postmaster", "abuse", "noreply",
+	})
 
 	// Try to read .env file
 	if err := viper.ReadInConfig(); err != nil {
@@ -81,6 +211,36 @@ func LoadConfig() *Config {
 	if _, err := time.ParseDuration(cfg.JWT.RefreshExpiry.String()); err != nil {
 		cfg.JWT.RefreshExpiry = 168 * time.Hour
 	}
+	if cfg.Org.InvitationExpiry <= 0 {
+		cfg.Org.InvitationExpiry = 168 * time.Hour
+	}
+	if cfg.Auth.PasswordResetExpiry <= 0 {
+		cfg.Auth.PasswordResetExpiry = time.Hour
+	}
+	if cfg.Auth.AccountDeletionGracePeriod < 0 {
+		cfg.Auth.AccountDeletionGracePeriod = 720 * time.Hour
+	}
+	if cfg.Auth.PurgeInterval <= 0 {
+		cfg.Auth.PurgeInterval = time.Hour
+	}
+	if cfg.Auth.ReauthenticationMaxAge <= 0 {
+		cfg.Auth.ReauthenticationMaxAge = 5 * time.Minute
+	}
+	if cfg.Auth.EmailChangeExpiry <= 0 {
+		cfg.Auth.EmailChangeExpiry = 24 * time.Hour
+	}
+	if cfg.OAuth.CodeExpiry <= 0 {
+		cfg.OAuth.CodeExpiry = time.Minute
+	}
+	if cfg.OAuth.SecretRollover < 0 {
+		cfg.OAuth.SecretRollover = 24 * time.Hour
+	}
+	if cfg.OAuth.DeviceCodeExpiry <= 0 {
+		cfg.OAuth.DeviceCodeExpiry = 10 * time.Minute
+	}
+	if cfg.OAuth.DevicePollInterval < time.Second {
+		cfg.OAuth.DevicePollInterval = 5 * time.Second
+	}
 
 	return &cfg
 }
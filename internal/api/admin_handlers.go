@@ -0,0 +1,350 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/services"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+type AdminHandler struct {
+	importService    services.ImportService
+	rbacService      services.RBACService
+	userAdminService services.UserAdminService
+}
+
+func NewAdminHandler(
+	importService services.ImportService,
+	rbacService services.RBACService,
+	userAdminService services.UserAdminService,
+) *AdminHandler {
+	return &AdminHandler{
+		importService:    importService,
+		rbacService:      rbacService,
+		userAdminService: userAdminService,
+	}
+}
+
+func (h *AdminHandler) ListUsers(c *fiber.Ctx) error {
+	filter := models.UserFilter{
+		Email:   c.Query("email"),
+		Page:    c.QueryInt("page", 1),
+		PerPage: c.QueryInt("per_page", 0),
+	}
+
+	if v := c.Query("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			return utils.ErrInvalidInput.WithMessage("active must be true or false")
+		}
+		filter.Active = &active
+	}
+
+	for param, dst := range map[string]**time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+	} {
+		v := c.Query(param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return utils.ErrInvalidInput.WithMessage(param + " must be an RFC 3339 timestamp")
+		}
+		*dst = &t
+	}
+
+	users, err := h.userAdminService.ListUsers(filter)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(users)
+}
+
+func (h *AdminHandler) GetUser(c *fiber.Ctx) error {
+	user, err := h.userAdminService.GetUser(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	if user == nil {
+		return utils.ErrUserNotFound
+	}
+
+	return c.JSON(user)
+}
+
+func (h *AdminHandler) CreateUser(c *fiber.Ctx) error {
+	var req struct {
+		Email    string `json:"email" validate:"required,email"`
+		Password string `json:"password" validate:"omitempty,min=8"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	user, err := h.userAdminService.CreateUser(req.Email, req.Password)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(user)
+}
+
+func (h *AdminHandler) UpdateUserEmail(c *fiber.Ctx) error {
+	var req struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	user, err := h.userAdminService.UpdateEmail(c.UserContext(), c.Params("id"), req.Email)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(user)
+}
+
+func (h *AdminHandler) DeactivateUser(c *fiber.Ctx) error {
+	return h.setUserActive(c, false)
+}
+
+func (h *AdminHandler) ReactivateUser(c *fiber.Ctx) error {
+	return h.setUserActive(c, true)
+}
+
+func (h *AdminHandler) setUserActive(c *fiber.Ctx, active bool) error {
+	user, err := h.userAdminService.SetActive(c.UserContext(), c.Params("id"), active)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(user)
+}
+
+func (h *AdminHandler) UpdateUserAppMetadata(c *fiber.Ctx) error {
+	var req struct {
+		AppMetadata models.JSONMap `json:"app_metadata"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	user, err := h.userAdminService.UpdateAppMetadata(c.UserContext(), c.Params("id"), req.AppMetadata)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(user)
+}
+
+func (h *AdminHandler) ForcePasswordReset(c *fiber.Ctx) error {
+	if err := h.userAdminService.ForcePasswordReset(c.UserContext(), c.Params("id")); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AdminHandler) DeleteUser(c *fiber.Ctx) error {
+	if err := h.userAdminService.DeleteUser(c.UserContext(), c.Params("id")); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AdminHandler) RestoreUser(c *fiber.Ctx) error {
+	user, err := h.userAdminService.RestoreUser(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(user)
+}
+
+func (h *AdminHandler) RevokeUserSessions(c *fiber.Ctx) error {
+	if err := h.userAdminService.RevokeSessions(c.UserContext(), c.Params("id")); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AdminHandler) ImportUsers(c *fiber.Ctx) error {
+	var req models.UserImportRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	result, err := h.importService.ImportUsers(&req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(result)
+}
+
+func (h *AdminHandler) ListRoles(c *fiber.Ctx) error {
+	roles, err := h.rbacService.ListRoles()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(roles)
+}
+
+func (h *AdminHandler) GetRole(c *fiber.Ctx) error {
+	role, err := h.rbacService.GetRole(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	if role == nil {
+		return utils.ErrNotFound.WithMessage("role not found")
+	}
+
+	return c.JSON(role)
+}
+
+func (h *AdminHandler) CreateRole(c *fiber.Ctx) error {
+	var req struct {
+		Name        string   `json:"name" validate:"required"`
+		Scope       string   `json:"scope" validate:"omitempty,oneof=global organization"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	role, err := h.rbacService.CreateRole(req.Name, req.Scope, req.Description, req.Permissions)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(role)
+}
+
+func (h *AdminHandler) UpdateRole(c *fiber.Ctx) error {
+	var req struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	role, err := h.rbacService.UpdateRole(c.Params("id"), req.Name, req.Description, req.Permissions)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(role)
+}
+
+func (h *AdminHandler) DeleteRole(c *fiber.Ctx) error {
+	if err := h.rbacService.DeleteRole(c.Params("id")); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AdminHandler) ListPermissions(c *fiber.Ctx) error {
+	permissions, err := h.rbacService.ListPermissions()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(permissions)
+}
+
+func (h *AdminHandler) CreatePermission(c *fiber.Ctx) error {
+	var req struct {
+		Name        string `json:"name" validate:"required"`
+		Description string `json:"description"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	permission, err := h.rbacService.CreatePermission(req.Name, req.Description)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(permission)
+}
+
+func (h *AdminHandler) GetUserRoles(c *fiber.Ctx) error {
+	roles, err := h.rbacService.GetUserRoles(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(roles)
+}
+
+func (h *AdminHandler) AssignUserRole(c *fiber.Ctx) error {
+	var req struct {
+		Role string `json:"role" validate:"required"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	if err := h.rbacService.AssignRole(c.Params("id"), req.Role); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AdminHandler) RemoveUserRole(c *fiber.Ctx) error {
+	if err := h.rbacService.RemoveRole(c.Params("id"), c.Params("roleID")); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+var errInvalidBody = utils.ErrInvalidInput.WithMessage("invalid request body")
+
+// problem is an RFC 7807 problem details body. Code is a stable identifier
+// clients can switch on; Detail is meant for humans and may change.
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	// Reason explains why an email address was rejected.
+	Reason string `json:"reason,omitempty"`
+	// Errors lists the invalid fields of a request body.
+	Errors utils.ValidationErrors `json:"errors,omitempty"`
+}
+
+// oauthProblem is the error body of the OAuth endpoints (RFC 6749 section
+// 5.2).
+type oauthProblem struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// ErrorHandler reports errors returned by handlers and middleware as
+// application/problem+json. utils.AppErrors keep their status and code; any
+// other error is logged and reported as an internal error without details.
+// utils.OAuthErrors are reported in the format OAuth clients expect.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var oauthErr *utils.OAuthError
+	if errors.As(err, &oauthErr) {
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		switch {
+		case oauthErr.Status == fiber.StatusUnauthorized:
+			c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+		case errors.Is(oauthErr, utils.ErrOAuthInsufficientScope):
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="insufficient_scope"`)
+		}
+		return c.Status(oauthErr.Status).JSON(oauthProblem{
+			Error:       oauthErr.Code,
+			Description: oauthErr.Description,
+		})
+	}
+
+	p := problem{Type: "about:blank", Instance: c.Path()}
+
+	var (
+		appErr    *utils.AppError
+		emailErr  *utils.EmailValidationError
+		fieldErrs utils.ValidationErrors
+		fiberErr  *fiber.Error
+	)
+	switch {
+	case errors.As(err, &fieldErrs):
+		p.Status = utils.ErrValidationFailed.Status
+		p.Code = utils.ErrValidationFailed.Code
+		p.Detail = utils.ErrValidationFailed.Message
+		p.Errors = fieldErrs
+	case errors.As(err, &emailErr):
+		p.Status = utils.ErrInvalidEmail.Status
+		p.Code = utils.ErrInvalidEmail.Code
+		p.Detail = err.Error()
+		p.Reason = emailErr.Reason
+	case errors.As(err, &appErr):
+		p.Status = appErr.Status
+		p.Code = appErr.Code
+		p.Detail = err.Error()
+	case errors.As(err, &fiberErr):
+		p.Status = fiberErr.Code
+		p.Code = codeForStatus(fiberErr.Code)
+		p.Detail = fiberErr.Message
+	default:
+		log.Printf("%s %s: %v", c.Method(), c.Path(), err)
+		p.Status = utils.ErrInternal.Status
+		p.Code = utils.ErrInternal.Code
+		p.Detail = utils.ErrInternal.Message
+	}
+	p.Title = http.StatusText(p.Status)
+
+	c.Status(p.Status)
+	if err := c.JSON(p); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "application/problem+json")
+	return nil
+}
+
+// codeForStatus derives a code such as "method_not_allowed" for errors
+// raised by fiber itself.
+func codeForStatus(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return utils.ErrInternal.Code
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
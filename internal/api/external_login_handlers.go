@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/services"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+type ExternalLoginHandler struct {
+	externalLoginService services.ExternalLoginService
+	// callbackURL is the frontend page users return to after signing in
+	// at a provider.
+	callbackURL string
+}
+
+func NewExternalLoginHandler(externalLoginService services.ExternalLoginService, callbackURL string) *ExternalLoginHandler {
+	return &ExternalLoginHandler{
+		externalLoginService: externalLoginService,
+		callbackURL:          callbackURL,
+	}
+}
+
+func (h *ExternalLoginHandler) ListProviders(c *fiber.Ctx) error {
+	return c.JSON(h.externalLoginService.Providers())
+}
+
+// Start sends the user to the provider to sign in.
+func (h *ExternalLoginHandler) Start(c *fiber.Ctx) error {
+	authorizationURL, err := h.externalLoginService.Start(c.UserContext(), c.Params("provider"))
+	if err != nil {
+		return err
+	}
+	return c.Redirect(authorizationURL, fiber.StatusFound)
+}
+
+// Callback is where the provider sends the user back to. The user always
+// ends up on the frontend callback page, with either a login code, the name
+// of the provider that was linked to their account or an error.
+func (h *ExternalLoginHandler) Callback(c *fiber.Ctx) error {
+	provider := c.Params("provider")
+
+	var req models.ExternalLoginCallback
+	if err := c.QueryParser(&req); err != nil {
+		return utils.ErrInvalidInput.WithMessage("invalid query parameters")
+	}
+
+	code, err := h.externalLoginService.Callback(c.UserContext(), provider, &req)
+	if err != nil {
+		var appErr *utils.AppError
+		if !errors.As(err, &appErr) {
+			log.Printf("External login with %s failed: %v", provider, err)
+			appErr = utils.ErrExternalLoginFailed
+		}
+		return c.Redirect(h.callbackRedirect(url.Values{
+			"error":             {appErr.Code},
+			"error_description": {appErr.Message},
+		}), fiber.StatusFound)
+	}
+	if code == "" {
+		return c.Redirect(h.callbackRedirect(url.Values{"linked": {provider}}), fiber.StatusFound)
+	}
+	return c.Redirect(h.callbackRedirect(url.Values{"code": {code}}), fiber.StatusFound)
+}
+
+// Exchange returns the session tokens for a login code.
+func (h *ExternalLoginHandler) Exchange(c *fiber.Ctx) error {
+	var req struct {
+		Code string `json:"code" validate:"required"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	tokens, err := h.externalLoginService.Exchange(c.UserContext(), req.Code)
+	if err != nil {
+		return err
+	}
+	return c.JSON(tokens)
+}
+
+func (h *ExternalLoginHandler) ListIdentities(c *fiber.Ctx) error {
+	identities, err := h.externalLoginService.ListIdentities(c.Locals("userID").(string))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(identities)
+}
+
+// LinkIdentity returns the provider's authorization URL. Once the user has
+// signed in there, the provider is linked to their account. The URL is
+// returned rather than redirected to, since the request carries the
+// caller's access token.
+func (h *ExternalLoginHandler) LinkIdentity(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	authorizationURL, err := h.externalLoginService.StartLink(c.UserContext(), userID, c.Params("provider"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"authorization_url": authorizationURL})
+}
+
+func (h *ExternalLoginHandler) UnlinkIdentity(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	if err := h.externalLoginService.Unlink(c.UserContext(), userID, c.Params("provider")); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *ExternalLoginHandler) callbackRedirect(params url.Values) string {
+	sep := "?"
+	if strings.Contains(h.callbackURL, "?") {
+		sep = "&"
+	}
+	return h.callbackURL + sep + params.Encode()
+}
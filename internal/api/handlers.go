@@ -1,16 +1,41 @@
 package api
 
 import (
+	"errors"
+	"strings"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kimutaiwycliff/auth-service/internal/models"
 	"github.com/kimutaiwycliff/auth-service/internal/services"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
 )
 
 type AuthHandler struct {
-	authService services.AuthService
+	authService          services.AuthService
+	passwordResetService services.PasswordResetService
+	accountService       services.AccountService
+	emailChangeService   services.EmailChangeService
+	// reauthMaxAge is how recently users without a password must have
+	// signed in to delete their account.
+	reauthMaxAge time.Duration
 }
 
-func NewAuthHandler(authService services.AuthService) *AuthHandler {
-	return &AuthHandler{authService: authService}
+func NewAuthHandler(
+	authService services.AuthService,
+	passwordResetService services.PasswordResetService,
+	accountService services.AccountService,
+	emailChangeService services.EmailChangeService,
+	reauthMaxAge time.Duration,
+) *AuthHandler {
+	return &AuthHandler{
+		authService:          authService,
+		passwordResetService: passwordResetService,
+		accountService:       accountService,
+		emailChangeService:   emailChangeService,
+		reauthMaxAge:         reauthMaxAge,
+	}
 }
 
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
@@ -20,16 +45,15 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
 	}
 
 	user, err := h.authService.Register(req.Email, req.Password)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return err
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(user)
@@ -37,21 +61,26 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var req struct {
-		Email    string `json:"email" validate:"required,email"`
-		Password string `json:"password" validate:"required"`
+		Identifier string `json:"identifier" validate:"required_without=Email"` // email or username
+		Email      string `json:"email"`
+		Password   string `json:"password" validate:"required"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	identifier := req.Identifier
+	if identifier == "" {
+		identifier = req.Email
 	}
 
-	tokens, err := h.authService.Login(req.Email, req.Password)
+	tokens, err := h.authService.Login(c.UserContext(), identifier, req.Password)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return err
 	}
 
 	return c.JSON(tokens)
@@ -63,29 +92,46 @@ func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
 	}
 
-	tokens, err := h.authService.RefreshToken(c.Context(), req.RefreshToken)
+	tokens, err := h.authService.RefreshToken(c.UserContext(), req.RefreshToken)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return err
 	}
 
 	return c.JSON(tokens)
 }
 
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	var req struct {
+		Token    string `json:"token" validate:"required"`
+		Password string `json:"password" validate:"required,min=8"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	if err := h.passwordResetService.ResetPassword(c.UserContext(), req.Token, req.Password); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	token := c.Locals("accessToken").(string)
 
-	if err := h.authService.Logout(userID, token); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to logout",
-		})
+	if err := h.authService.Logout(c.UserContext(), userID, token); err != nil {
+		return err
 	}
 
 	return c.SendStatus(fiber.StatusNoContent)
@@ -96,16 +142,237 @@ func (h *AuthHandler) Me(c *fiber.Ctx) error {
 
 	user, err := h.authService.GetUser(userID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch user",
-		})
+		return err
 	}
 
 	if user == nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "User not found",
-		})
+		return utils.ErrUserNotFound
 	}
 
 	return c.JSON(user)
 }
+
+func (h *AuthHandler) UpdateMe(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var req models.ProfileUpdate
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	user, err := h.accountService.UpdateProfile(c.UserContext(), userID, req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(user)
+}
+
+// DeleteMe deletes the caller's account. The password is required again so
+// a stolen access token alone can't destroy the account. Accounts without a
+// password need a recent sign in at their identity provider instead.
+func (h *AuthHandler) DeleteMe(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var req struct {
+		Password string `json:"password"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	purgeAt, err := h.accountService.DeleteAccount(c.UserContext(), userID, req.Password, recentlyAuthenticated(c, h.reauthMaxAge))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":  "Account scheduled for deletion",
+		"purge_at": purgeAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// ExportMe returns an archive of everything stored about the caller.
+func (h *AuthHandler) ExportMe(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	export, err := h.accountService.ExportData(c.UserContext(), userID)
+	if err != nil {
+		return err
+	}
+
+	c.Attachment("account-export.json")
+	return c.JSON(export)
+}
+
+func (h *AuthHandler) SwitchOrganization(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var req struct {
+		OrganizationID string `json:"organization_id"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	tokens, err := h.authService.SwitchOrganization(c.UserContext(), userID, req.OrganizationID, authTime(c), claimStrings(c, "amr"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(tokens)
+}
+
+func (h *AuthHandler) Reauthenticate(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	claims, _ := c.Locals("claims").(jwt.MapClaims)
+	orgID, _ := claims["org_id"].(string)
+
+	var req struct {
+		Password string `json:"password" validate:"required"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	tokens, err := h.authService.Reauthenticate(c.UserContext(), userID, orgID, req.Password)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(tokens)
+}
+
+// SetPassword adds a password to an account that only signs in with
+// identity providers.
+func (h *AuthHandler) SetPassword(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var req struct {
+		Password string `json:"password" validate:"required,min=8"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	if err := h.accountService.SetPassword(c.UserContext(), userID, req.Password); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AuthHandler) ChangeEmail(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var req struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	if err := h.emailChangeService.RequestChange(c.UserContext(), userID, req.Email); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Confirmation email sent to the new address",
+	})
+}
+
+func (h *AuthHandler) ConfirmEmailChange(c *fiber.Ctx) error {
+	var req struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	user, err := h.emailChangeService.Confirm(c.UserContext(), req.Token)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(user)
+}
+
+func (h *AuthHandler) CancelEmailChange(c *fiber.Ctx) error {
+	var req struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	if err := h.emailChangeService.Cancel(c.UserContext(), req.Token); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// UsernameAvailable reports whether a username can be claimed. The route is
+// rate limited since it reveals which usernames exist.
+func (h *AuthHandler) UsernameAvailable(c *fiber.Ctx) error {
+	username := c.Query("username")
+	if username == "" {
+		return utils.ErrInvalidInput.WithMessage("username is required")
+	}
+
+	err := h.accountService.CheckUsername(username)
+	if err == nil {
+		return c.JSON(fiber.Map{"available": true})
+	}
+
+	// The username errors carry "username_" prefixed codes; the rest of the
+	// code is the reason reported to clients.
+	var appErr *utils.AppError
+	if !errors.As(err, &appErr) || !strings.HasPrefix(appErr.Code, "username_") {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"available": false,
+		"reason":    strings.TrimPrefix(appErr.Code, "username_"),
+		"message":   err.Error(),
+	})
+}
+
+// authTime reads the auth_time claim of the token validated by AuthRequired.
+func authTime(c *fiber.Ctx) int64 {
+	claims, _ := c.Locals("claims").(jwt.MapClaims)
+	t, _ := claims["auth_time"].(float64)
+	return int64(t)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/kimutaiwycliff/auth-service/internal/services"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+type InvitationHandler struct {
+	invitationService services.InvitationService
+}
+
+func NewInvitationHandler(invitationService services.InvitationService) *InvitationHandler {
+	return &InvitationHandler{invitationService: invitationService}
+}
+
+func (h *InvitationHandler) Create(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var req struct {
+		Email string `json:"email" validate:"required,email"`
+		Role  string `json:"role"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	invitation, err := h.invitationService.CreateInvitation(c.Params("orgID"), userID, req.Email, req.Role)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(invitation)
+}
+
+func (h *InvitationHandler) ListPending(c *fiber.Ctx) error {
+	invitations, err := h.invitationService.ListPending(c.Params("orgID"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(invitations)
+}
+
+func (h *InvitationHandler) Revoke(c *fiber.Ctx) error {
+	if err := h.invitationService.Revoke(c.Params("orgID"), c.Params("invitationID")); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *InvitationHandler) Accept(c *fiber.Ctx) error {
+	var req struct {
+		Token    string `json:"token" validate:"required"`
+		Password string `json:"password"` // only needed when the email has no account yet
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	member, err := h.invitationService.Accept(req.Token, req.Password)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(member)
+}
+
+func (h *InvitationHandler) Decline(c *fiber.Ctx) error {
+	var req struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	if err := h.invitationService.Decline(req.Token); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
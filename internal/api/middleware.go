@@ -1,90 +1,172 @@
 package api
 
 import (
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/kimutaiwycliff/auth-service/config"
 	"github.com/kimutaiwycliff/auth-service/internal/services"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
 )
 
 type Middleware struct {
-	jwtService  services.JWTService
+	authService  services.AuthService
 	redisService services.RedisService // Changed to use interface
 }
 
-func NewMiddleware(jwtService services.JWTService, redisService services.RedisService) *Middleware {
+func NewMiddleware(authService services.AuthService, redisService services.RedisService) *Middleware {
 	return &Middleware{
-		jwtService:  jwtService,
+		authService:  authService,
 		redisService: redisService, // Now using the interface
 	}
 }
 
+// AuthRequired authenticates the user's own session. Access tokens issued
+// to OAuth clients are rejected, since they only carry the scope the user
+// granted the client.
 func (m *Middleware) AuthRequired(c *fiber.Ctx) error {
+	return m.authenticate(c, false)
+}
+
+// OAuthTokenRequired is like AuthRequired, but also accepts access tokens
+// issued to OAuth clients. It guards the endpoints clients call on the
+// user's behalf, such as userinfo.
+func (m *Middleware) OAuthTokenRequired(c *fiber.Ctx) error {
+	return m.authenticate(c, true)
+}
+
+func (m *Middleware) authenticate(c *fiber.Ctx, allowClients bool) error {
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Authorization header missing",
-		})
+		return utils.ErrUnauthorized.WithMessage("authorization header missing")
 	}
 
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return utils.ErrUnauthorized.WithMessage("invalid authorization header")
+	}
 	token := authHeader[7:] // Remove "Bearer " prefix
 
-	// Check if token is blacklisted using RedisService
-	blacklisted, err := m.redisService.IsTokenBlacklisted(c.Context(), token)
+	// Verify token against the blacklist and revocation watermark
+	claims, err := m.authService.ValidateAccessToken(c.UserContext(), token)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Internal server error",
-		})
+		return err
 	}
-	if blacklisted {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Token has been invalidated",
-		})
+
+	// Tokens with an audience were exchanged for another service
+	if _, ok := claims["aud"]; ok {
+		return utils.ErrInvalidToken.WithMessage("token is meant for another audience")
 	}
 
-	// Verify token and get claims
-	claims, err := m.jwtService.ValidateAccessToken(token)
-	if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"error": "Invalid token",
-			})
+	if _, ok := claims["client_id"]; ok && !allowClients {
+		return utils.ErrInvalidToken.WithMessage("token was issued to an OAuth client")
+	}
+	// Client credentials tokens have no user behind them
+	if !services.IsUserToken(claims) {
+		return utils.ErrInvalidToken.WithMessage("token was issued to a client for itself")
 	}
 
 	// Properly extract userID from claims
 	userID, ok := claims["sub"].(string)
 	if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"error": "Invalid token claims",
-			})
+		return utils.ErrInvalidToken.WithMessage("invalid token claims")
 	}
 
-	// Store userID and token in context
+	// Store userID, token and claims in context
+	c.SetUserContext(services.WithActor(c.UserContext(), userID))
 	c.Locals("userID", userID)
 	c.Locals("accessToken", token)
+	c.Locals("claims", claims)
 
 	return c.Next()
 }
 
-func (m *Middleware) RateLimiter(limit int, window time.Duration) fiber.Handler {
+// RequirePermission allows the request only if the access token validated by
+// AuthRequired carries the given permission. It must run after AuthRequired.
+func (m *Middleware) RequirePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !hasClaimValue(c, "permissions", permission) {
+			return utils.ErrForbidden
+		}
+		return c.Next()
+	}
+}
+
+// RequireRole allows the request only if the access token validated by
+// AuthRequired carries the given role. It must run after AuthRequired.
+func (m *Middleware) RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !hasClaimValue(c, "roles", role) {
+			return utils.ErrForbidden
+		}
+		return c.Next()
+	}
+}
+
+// RequireOrgPermission allows the request only if the token's active
+// organization grants the given permission. On routes with an :orgID
+// parameter the active organization must also be that organization.
+func (m *Middleware) RequireOrgPermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, _ := c.Locals("claims").(jwt.MapClaims)
+		activeOrgID, _ := claims["org_id"].(string)
+		if activeOrgID == "" {
+			return utils.ErrForbidden.WithMessage("no active organization")
+		}
+
+		if orgID := c.Params("orgID"); orgID != "" && orgID != activeOrgID {
+			return utils.ErrForbidden.WithMessage("token is not scoped to this organization")
+		}
+
+		if !hasClaimValue(c, "org_permissions", permission) {
+			return utils.ErrForbidden
+		}
+
+		c.Locals("orgID", activeOrgID)
+		return c.Next()
+	}
+}
+
+// RequireRecentAuth allows the request only if the user entered their
+// password or signed in at an identity provider within maxAge, according to
+// the token's auth_time claim. Clients get a fresh auth_time from POST
+// /auth/reauthenticate, or by signing in at the provider again. It must run
+// after AuthRequired.
+func (m *Middleware) RequireRecentAuth(maxAge time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !recentlyAuthenticated(c, maxAge) {
+			return utils.ErrReauthenticationRequired
+		}
+		return c.Next()
+	}
+}
+
+// recentlyAuthenticated reports whether the token validated by AuthRequired
+// has an auth_time within maxAge.
+func recentlyAuthenticated(c *fiber.Ctx, maxAge time.Duration) bool {
+	t := authTime(c)
+	return t != 0 && time.Since(time.Unix(t, 0)) <= maxAge
+}
+
+// RateLimiter allows limit requests per client IP within window. Each scope
+// is counted separately, so limiting one endpoint doesn't use up another's
+// allowance.
+func (m *Middleware) RateLimiter(scope string, limit int, window time.Duration) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		ip := c.IP()
-		key := "rate_limit:" + ip
+		key := "rate_limit:" + scope + ":" + ip
 
-		count, err := m.redisService.IncrementRequestCount(c.Context(), key, window)
+		count, err := m.redisService.IncrementRequestCount(c.UserContext(), key, window)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Internal server error",
-			})
+			return err
 		}
 
 		if count > limit {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "Too many requests",
-			})
+			return utils.ErrRateLimited
 		}
 
 		return c.Next()
@@ -96,16 +178,58 @@ func NewFiberApp(cfg *config.Config) *fiber.App {
 		AppName:      "Auth Service",
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
+		ErrorHandler: ErrorHandler,
 	})
 
 	// Middleware
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
-		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
+		AllowMethods: "GET,POST,PUT,PATCH,DELETE,OPTIONS",
 		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
 	}))
 	app.Use(logger.New())
 	app.Use(recover.New())
+	app.Use(clientInfo)
 
 	return app
 }
+
+// clientInfo makes the caller's address and user agent available to
+// services through the request's user context.
+func clientInfo(c *fiber.Ctx) error {
+	c.SetUserContext(services.WithClientInfo(c.UserContext(), services.ClientInfo{
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}))
+	return c.Next()
+}
+
+// claimStrings reads a string list claim from the token stored by AuthRequired.
+func claimStrings(c *fiber.Ctx, key string) []string {
+	claims, ok := c.Locals("claims").(jwt.MapClaims)
+	if !ok {
+		return nil
+	}
+
+	raw, ok := claims[key].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	values := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if s, ok := v.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+func hasClaimValue(c *fiber.Ctx, key, want string) bool {
+	for _, v := range claimStrings(c, key) {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
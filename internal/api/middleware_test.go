@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kimutaiwycliff/auth-service/internal/services"
+)
+
+// tokenAuthService validates access tokens with a JWTService and nothing
+// else.
+type tokenAuthService struct {
+	services.AuthService
+	jwtService services.JWTService
+}
+
+func (s *tokenAuthService) ValidateAccessToken(ctx context.Context, token string) (jwt.MapClaims, error) {
+	return s.jwtService.ValidateAccessToken(token)
+}
+
+func TestAuthRequiredRejectsClientTokens(t *testing.T) {
+	jwtService := services.NewJWTService("test-secret", time.Minute, time.Hour)
+	middleware := NewMiddleware(&tokenAuthService{jwtService: jwtService}, nil)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app.Get("/api/v1/auth/me", middleware.AuthRequired, ok)
+	app.Get("/oauth/userinfo", middleware.OAuthTokenRequired, ok)
+
+	token := func(subject string, claims jwt.MapClaims) string {
+		t.Helper()
+		signed, err := jwtService.GenerateAccessToken(subject, 0, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	userToken := token("user-1", jwt.MapClaims{"roles": []string{"admin"}})
+	clientSessionToken := token("user-1", jwt.MapClaims{"client_id": "client-1", "scope": "openid"})
+	clientCredentialsToken := token("client-1", jwt.MapClaims{"client_id": "client-1", "scope": "reports"})
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{"user token on API", "/api/v1/auth/me", userToken, fiber.StatusOK},
+		{"client session token on API", "/api/v1/auth/me", clientSessionToken, fiber.StatusUnauthorized},
+		{"user token on userinfo", "/oauth/userinfo", userToken, fiber.StatusOK},
+		{"client session token on userinfo", "/oauth/userinfo", clientSessionToken, fiber.StatusOK},
+		{"client credentials token on API", "/api/v1/auth/me", clientCredentialsToken, fiber.StatusUnauthorized},
+		{"client credentials token on userinfo", "/oauth/userinfo", clientCredentialsToken, fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodGet, tt.path, nil)
+			req.Header.Set(fiber.HeaderAuthorization, "Bearer "+tt.token)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/services"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+type OAuthHandler struct {
+	oauthService   services.OAuthService
+	clientService  services.OAuthClientService
+	scopeService   services.OAuthScopeService
+	consentService services.OAuthConsentService
+	oidcService    services.OIDCService
+	deviceService  services.DeviceAuthorizationService
+	// loginURL is the frontend page that signs the user in and approves
+	// authorization requests.
+	loginURL string
+}
+
+func NewOAuthHandler(
+	oauthService services.OAuthService,
+	clientService services.OAuthClientService,
+	scopeService services.OAuthScopeService,
+	consentService services.OAuthConsentService,
+	oidcService services.OIDCService,
+	deviceService services.DeviceAuthorizationService,
+	loginURL string,
+) *OAuthHandler {
+	return &OAuthHandler{
+		oauthService:   oauthService,
+		clientService:  clientService,
+		scopeService:   scopeService,
+		consentService: consentService,
+		oidcService:    oidcService,
+		deviceService:  deviceService,
+		loginURL:       loginURL,
+	}
+}
+
+// Authorize is where clients send the user to start the authorization code
+// flow. Valid requests are forwarded to the login page, which signs the user
+// in and then calls ApproveAuthorization with the same parameters.
+func (h *OAuthHandler) Authorize(c *fiber.Ctx) error {
+	var req models.AuthorizationRequest
+	if err := c.QueryParser(&req); err != nil {
+		return utils.ErrInvalidInput.WithMessage("invalid query parameters")
+	}
+
+	errorRedirect, err := h.oauthService.CheckAuthorizationRequest(&req)
+	if err != nil {
+		return err
+	}
+	if errorRedirect != "" {
+		return c.Redirect(errorRedirect, fiber.StatusFound)
+	}
+
+	sep := "?"
+	if strings.Contains(h.loginURL, "?") {
+		sep = "&"
+	}
+	return c.Redirect(h.loginURL+sep+string(c.Context().QueryArgs().QueryString()), fiber.StatusFound)
+}
+
+// ApproveAuthorization issues an authorization code to the signed-in user and
+// returns where the login page should send the user next. If the user has to
+// consent to the client first, the consent prompt is returned instead and
+// the login page posts the request again with the user's answer.
+func (h *OAuthHandler) ApproveAuthorization(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var req models.AuthorizationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+
+	redirectTo, prompt, err := h.oauthService.Authorize(c.UserContext(), userID, authTime(c), claimStrings(c, "amr"), &req)
+	if err != nil {
+		return err
+	}
+	if prompt != nil {
+		return c.JSON(fiber.Map{"consent_required": true, "consent": prompt})
+	}
+
+	return c.JSON(fiber.Map{"redirect_to": redirectTo})
+}
+
+func (h *OAuthHandler) Token(c *fiber.Ctx) error {
+	var req models.TokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrOAuthInvalidRequest.WithDescription("invalid request body")
+	}
+
+	auth, err := clientAuthentication(c)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := h.oauthService.Token(c.UserContext(), auth, &req)
+	if err != nil {
+		return err
+	}
+
+	// Token responses must not be cached (RFC 6749 section 5.1)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderPragma, "no-cache")
+	return c.JSON(tokens)
+}
+
+// DeviceAuthorization starts the device authorization grant (RFC 8628).
+func (h *OAuthHandler) DeviceAuthorization(c *fiber.Ctx) error {
+	var req models.DeviceAuthorizationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrOAuthInvalidRequest.WithDescription("invalid request body")
+	}
+
+	auth, err := clientAuthentication(c)
+	if err != nil {
+		return err
+	}
+
+	response, err := h.deviceService.Authorize(c.UserContext(), auth, &req)
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(response)
+}
+
+// GetDeviceVerification shows the signed-in user what they are about to
+// approve when they enter a user code.
+func (h *OAuthHandler) GetDeviceVerification(c *fiber.Ctx) error {
+	verification, err := h.deviceService.Lookup(c.UserContext(), c.Query("user_code"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(verification)
+}
+
+// VerifyDevice approves or denies a device authorization.
+func (h *OAuthHandler) VerifyDevice(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var req models.DeviceVerificationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	if err := h.deviceService.Verify(c.UserContext(), userID, authTime(c), claimStrings(c, "amr"), &req); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Introspect tells resource servers whether a token is active (RFC 7662).
+func (h *OAuthHandler) Introspect(c *fiber.Ctx) error {
+	var req models.IntrospectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrOAuthInvalidRequest.WithDescription("invalid request body")
+	}
+
+	auth, err := clientAuthentication(c)
+	if err != nil {
+		return err
+	}
+
+	response, err := h.oauthService.Introspect(c.UserContext(), auth, &req)
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(response)
+}
+
+// Revoke revokes an access or refresh token (RFC 7009). The response is the
+// same whether or not the token was valid.
+func (h *OAuthHandler) Revoke(c *fiber.Ctx) error {
+	var req models.TokenRevocationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrOAuthInvalidRequest.WithDescription("invalid request body")
+	}
+
+	auth, err := clientAuthentication(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.oauthService.Revoke(c.UserContext(), auth, &req); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// UserInfo returns claims about the user the access token was issued for
+// (OpenID Connect Core section 5.3).
+func (h *OAuthHandler) UserInfo(c *fiber.Ctx) error {
+	claims := c.Locals("claims").(jwt.MapClaims)
+	scope, _ := claims["scope"].(string)
+
+	info, err := h.oidcService.UserInfo(c.Locals("userID").(string), scope)
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(info)
+}
+
+func (h *OAuthHandler) Discovery(c *fiber.Ctx) error {
+	return c.JSON(h.oidcService.Discovery())
+}
+
+// JWKS publishes the keys ID tokens are signed with.
+func (h *OAuthHandler) JWKS(c *fiber.Ctx) error {
+	return c.JSON(h.oidcService.KeySet())
+}
+
+func (h *OAuthHandler) ListConsents(c *fiber.Ctx) error {
+	consents, err := h.consentService.ListConsents(c.Locals("userID").(string))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(consents)
+}
+
+func (h *OAuthHandler) RevokeConsent(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	if err := h.consentService.RevokeConsent(c.UserContext(), userID, c.Params("clientID")); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *OAuthHandler) ListScopes(c *fiber.Ctx) error {
+	scopes, err := h.scopeService.ListScopes()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(scopes)
+}
+
+func (h *OAuthHandler) CreateScope(c *fiber.Ctx) error {
+	var req struct {
+		Name        string `json:"name" validate:"required"`
+		Description string `json:"description"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	scope, err := h.scopeService.CreateScope(req.Name, req.Description)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(scope)
+}
+
+func (h *OAuthHandler) DeleteScope(c *fiber.Ctx) error {
+	if err := h.scopeService.DeleteScope(c.Params("name")); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// clientWithSecret is returned when a client secret is issued. The secret
+// can't be retrieved later.
+type clientWithSecret struct {
+	*models.OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func (h *OAuthHandler) CreateClient(c *fiber.Ctx) error {
+	var req models.OAuthClientInput
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	client, secret, err := h.clientService.CreateClient(req)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(clientWithSecret{OAuthClient: client, ClientSecret: secret})
+}
+
+func (h *OAuthHandler) ListClients(c *fiber.Ctx) error {
+	clients, err := h.clientService.ListClients()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(clients)
+}
+
+func (h *OAuthHandler) GetClient(c *fiber.Ctx) error {
+	client, err := h.clientService.GetClient(c.Params("clientID"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(client)
+}
+
+func (h *OAuthHandler) UpdateClient(c *fiber.Ctx) error {
+	var req models.OAuthClientInput
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	client, err := h.clientService.UpdateClient(c.Params("clientID"), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(client)
+}
+
+func (h *OAuthHandler) DeleteClient(c *fiber.Ctx) error {
+	if err := h.clientService.DeleteClient(c.UserContext(), c.Params("clientID")); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *OAuthHandler) RotateClientSecret(c *fiber.Ctx) error {
+	client, secret, err := h.clientService.RotateSecret(c.Params("clientID"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(clientWithSecret{OAuthClient: client, ClientSecret: secret})
+}
+
+func (h *OAuthHandler) RevokePreviousClientSecret(c *fiber.Ctx) error {
+	client, err := h.clientService.RevokePreviousSecret(c.Params("clientID"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(client)
+}
+
+// clientAuthentication reads the client's credentials from the request
+// body (client_secret_post or private_key_jwt) or the Authorization header
+// (client_secret_basic). Only one method may be used.
+func clientAuthentication(c *fiber.Ctx) (models.ClientAuthentication, error) {
+	var auth models.ClientAuthentication
+	if err := c.BodyParser(&auth); err != nil {
+		return auth, utils.ErrOAuthInvalidRequest.WithDescription("invalid request body")
+	}
+
+	header := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(header, "Basic ") {
+		return auth, nil
+	}
+	if auth.ClientSecret != "" || auth.ClientAssertion != "" {
+		return auth, utils.ErrOAuthInvalidRequest.WithDescription("multiple client authentication methods used")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+	if err != nil {
+		return auth, utils.ErrOAuthInvalidClient.WithDescription("malformed basic credentials")
+	}
+	rawID, rawSecret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return auth, utils.ErrOAuthInvalidClient.WithDescription("malformed basic credentials")
+	}
+
+	// Both parts are form-urlencoded (RFC 6749 section 2.3.1)
+	clientID, err1 := url.QueryUnescape(rawID)
+	secret, err2 := url.QueryUnescape(rawSecret)
+	if err1 != nil || err2 != nil {
+		return auth, utils.ErrOAuthInvalidClient.WithDescription("malformed basic credentials")
+	}
+	if auth.ClientID != "" && auth.ClientID != clientID {
+		return auth, utils.ErrOAuthInvalidRequest.WithDescription("client_id does not match the authenticated client")
+	}
+
+	auth.ClientID = clientID
+	auth.ClientSecret = secret
+	return auth, nil
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/kimutaiwycliff/auth-service/internal/services"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+type OrganizationHandler struct {
+	orgService services.OrganizationService
+}
+
+func NewOrganizationHandler(orgService services.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{orgService: orgService}
+}
+
+func (h *OrganizationHandler) Create(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var req struct {
+		Name string `json:"name" validate:"required"`
+		Slug string `json:"slug" validate:"required"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	org, err := h.orgService.CreateOrganization(userID, req.Name, req.Slug)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(org)
+}
+
+func (h *OrganizationHandler) ListMine(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	memberships, err := h.orgService.ListUserOrganizations(userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(memberships)
+}
+
+func (h *OrganizationHandler) Get(c *fiber.Ctx) error {
+	org, err := h.orgService.GetOrganization(c.Params("orgID"))
+	if err != nil {
+		return err
+	}
+
+	if org == nil {
+		return utils.ErrNotFound.WithMessage("organization not found")
+	}
+
+	return c.JSON(org)
+}
+
+func (h *OrganizationHandler) Update(c *fiber.Ctx) error {
+	var req struct {
+		Name string `json:"name" validate:"required"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	org, err := h.orgService.UpdateOrganization(c.Params("orgID"), req.Name)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(org)
+}
+
+func (h *OrganizationHandler) Delete(c *fiber.Ctx) error {
+	if err := h.orgService.DeleteOrganization(c.Params("orgID")); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *OrganizationHandler) ListMembers(c *fiber.Ctx) error {
+	members, err := h.orgService.ListMembers(c.Params("orgID"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(members)
+}
+
+func (h *OrganizationHandler) AddMember(c *fiber.Ctx) error {
+	var req struct {
+		UserID string   `json:"user_id" validate:"required"`
+		Roles  []string `json:"roles"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	member, err := h.orgService.AddMember(c.Params("orgID"), req.UserID, req.Roles)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(member)
+}
+
+func (h *OrganizationHandler) UpdateMember(c *fiber.Ctx) error {
+	var req struct {
+		Roles []string `json:"roles" validate:"required"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidBody
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		return err
+	}
+
+	member, err := h.orgService.UpdateMemberRoles(c.Params("orgID"), c.Params("userID"), req.Roles)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(member)
+}
+
+func (h *OrganizationHandler) RemoveMember(c *fiber.Ctx) error {
+	if err := h.orgService.RemoveMember(c.Params("orgID"), c.Params("userID")); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
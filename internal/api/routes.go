@@ -1,10 +1,41 @@
 package api
 
 import (
+	"time"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/kimutaiwycliff/auth-service/internal/services"
 )
 
-func SetupRoutes(app *fiber.App, authHandler *AuthHandler, middleware *Middleware) {
+func SetupRoutes(
+	app *fiber.App,
+	authHandler *AuthHandler,
+	adminHandler *AdminHandler,
+	orgHandler *OrganizationHandler,
+	invitationHandler *InvitationHandler,
+	oauthHandler *OAuthHandler,
+	externalLoginHandler *ExternalLoginHandler,
+	middleware *Middleware,
+	reauthMaxAge time.Duration,
+) {
+	// OAuth endpoints live at the root, where clients expect them
+	oauth := app.Group("/oauth")
+	{
+		oauth.Get("/authorize", oauthHandler.Authorize)
+		oauth.Post("/authorize", middleware.AuthRequired, oauthHandler.ApproveAuthorization)
+		oauth.Post("/token", oauthHandler.Token)
+		oauth.Post("/introspect", oauthHandler.Introspect)
+		oauth.Post("/revoke", oauthHandler.Revoke)
+		oauth.Post("/device_authorization", oauthHandler.DeviceAuthorization)
+		// User codes are short, so guessing them is rate limited
+		oauth.Get("/device", middleware.AuthRequired, middleware.RateLimiter("device_verification", 10, time.Minute), oauthHandler.GetDeviceVerification)
+		oauth.Post("/device", middleware.AuthRequired, middleware.RateLimiter("device_verification", 10, time.Minute), oauthHandler.VerifyDevice)
+		oauth.Get("/userinfo", middleware.OAuthTokenRequired, oauthHandler.UserInfo)
+		oauth.Post("/userinfo", middleware.OAuthTokenRequired, oauthHandler.UserInfo)
+		oauth.Get("/jwks", oauthHandler.JWKS)
+	}
+	app.Get("/.well-known/openid-configuration", oauthHandler.Discovery)
+
 	// Public routes
 	api := app.Group("/api/v1")
 	{
@@ -13,7 +44,20 @@ func SetupRoutes(app *fiber.App, authHandler *AuthHandler, middleware *Middlewar
 			auth.Post("/register", authHandler.Register)
 			auth.Post("/login", authHandler.Login)
 			auth.Post("/refresh", authHandler.Refresh)
+			auth.Post("/password/reset", authHandler.ResetPassword)
+			auth.Post("/email/confirm", authHandler.ConfirmEmailChange)
+			auth.Get("/username-available", middleware.RateLimiter("username_available", 10, time.Minute), authHandler.UsernameAvailable)
+			auth.Post("/email/cancel", authHandler.CancelEmailChange)
+
+			// Sign in with upstream identity providers
+			auth.Get("/providers", externalLoginHandler.ListProviders)
+			auth.Post("/providers/exchange", externalLoginHandler.Exchange)
+			auth.Get("/providers/:provider/login", externalLoginHandler.Start)
+			auth.Get("/providers/:provider/callback", externalLoginHandler.Callback)
 		}
+
+		api.Post("/invitations/accept", invitationHandler.Accept)
+		api.Post("/invitations/decline", invitationHandler.Decline)
 	}
 
 	// Protected routes
@@ -21,5 +65,72 @@ func SetupRoutes(app *fiber.App, authHandler *AuthHandler, middleware *Middlewar
 	{
 		protected.Post("/auth/logout", authHandler.Logout)
 		protected.Get("/auth/me", authHandler.Me)
+		protected.Patch("/auth/me", authHandler.UpdateMe)
+		protected.Delete("/auth/me", authHandler.DeleteMe)
+		protected.Get("/auth/me/export", authHandler.ExportMe)
+		protected.Get("/auth/me/consents", oauthHandler.ListConsents)
+		protected.Delete("/auth/me/consents/:clientID", oauthHandler.RevokeConsent)
+		protected.Post("/auth/me/email", middleware.RequireRecentAuth(reauthMaxAge), authHandler.ChangeEmail)
+		protected.Post("/auth/me/password", middleware.RequireRecentAuth(reauthMaxAge), authHandler.SetPassword)
+		protected.Get("/auth/me/identities", externalLoginHandler.ListIdentities)
+		protected.Post("/auth/me/identities/:provider", middleware.RequireRecentAuth(reauthMaxAge), externalLoginHandler.LinkIdentity)
+		protected.Delete("/auth/me/identities/:provider", middleware.RequireRecentAuth(reauthMaxAge), externalLoginHandler.UnlinkIdentity)
+		protected.Post("/auth/reauthenticate", authHandler.Reauthenticate)
+		protected.Post("/auth/switch-organization", authHandler.SwitchOrganization)
+
+		protected.Post("/orgs", orgHandler.Create)
+		protected.Get("/orgs", orgHandler.ListMine)
+		protected.Get("/orgs/:orgID", middleware.RequireOrgPermission(services.PermOrgRead), orgHandler.Get)
+		protected.Patch("/orgs/:orgID", middleware.RequireOrgPermission(services.PermOrgUpdate), orgHandler.Update)
+		protected.Delete("/orgs/:orgID", middleware.RequireOrgPermission(services.PermOrgDelete), orgHandler.Delete)
+		protected.Get("/orgs/:orgID/members", middleware.RequireOrgPermission(services.PermOrgMembersRead), orgHandler.ListMembers)
+		protected.Post("/orgs/:orgID/members", middleware.RequireOrgPermission(services.PermOrgMembersWrite), orgHandler.AddMember)
+		protected.Put("/orgs/:orgID/members/:userID", middleware.RequireOrgPermission(services.PermOrgMembersWrite), orgHandler.UpdateMember)
+		protected.Delete("/orgs/:orgID/members/:userID", middleware.RequireOrgPermission(services.PermOrgMembersWrite), orgHandler.RemoveMember)
+		protected.Get("/orgs/:orgID/invitations", middleware.RequireOrgPermission(services.PermOrgMembersRead), invitationHandler.ListPending)
+		protected.Post("/orgs/:orgID/invitations", middleware.RequireOrgPermission(services.PermOrgMembersWrite), invitationHandler.Create)
+		protected.Delete("/orgs/:orgID/invitations/:invitationID", middleware.RequireOrgPermission(services.PermOrgMembersWrite), invitationHandler.Revoke)
+	}
+
+	// Admin routes
+	admin := api.Group("/admin", middleware.AuthRequired)
+	{
+		admin.Post("/users/import", middleware.RequirePermission(services.PermUsersImport), adminHandler.ImportUsers)
+
+		admin.Get("/users", middleware.RequirePermission(services.PermUsersRead), adminHandler.ListUsers)
+		admin.Post("/users", middleware.RequirePermission(services.PermUsersWrite), adminHandler.CreateUser)
+		admin.Get("/users/:id", middleware.RequirePermission(services.PermUsersRead), adminHandler.GetUser)
+		admin.Delete("/users/:id", middleware.RequirePermission(services.PermUsersWrite), adminHandler.DeleteUser)
+		admin.Post("/users/:id/restore", middleware.RequirePermission(services.PermUsersWrite), adminHandler.RestoreUser)
+		admin.Put("/users/:id/email", middleware.RequirePermission(services.PermUsersWrite), adminHandler.UpdateUserEmail)
+		admin.Put("/users/:id/app-metadata", middleware.RequirePermission(services.PermUsersWrite), adminHandler.UpdateUserAppMetadata)
+		admin.Post("/users/:id/deactivate", middleware.RequirePermission(services.PermUsersWrite), adminHandler.DeactivateUser)
+		admin.Post("/users/:id/reactivate", middleware.RequirePermission(services.PermUsersWrite), adminHandler.ReactivateUser)
+		admin.Post("/users/:id/force-password-reset", middleware.RequirePermission(services.PermUsersWrite), adminHandler.ForcePasswordReset)
+		admin.Post("/users/:id/revoke-sessions", middleware.RequirePermission(services.PermUsersWrite), adminHandler.RevokeUserSessions)
+
+		admin.Get("/roles", middleware.RequirePermission(services.PermRolesRead), adminHandler.ListRoles)
+		admin.Post("/roles", middleware.RequirePermission(services.PermRolesWrite), adminHandler.CreateRole)
+		admin.Get("/roles/:id", middleware.RequirePermission(services.PermRolesRead), adminHandler.GetRole)
+		admin.Put("/roles/:id", middleware.RequirePermission(services.PermRolesWrite), adminHandler.UpdateRole)
+		admin.Delete("/roles/:id", middleware.RequirePermission(services.PermRolesWrite), adminHandler.DeleteRole)
+
+		admin.Get("/permissions", middleware.RequirePermission(services.PermRolesRead), adminHandler.ListPermissions)
+		admin.Post("/permissions", middleware.RequirePermission(services.PermRolesWrite), adminHandler.CreatePermission)
+
+		admin.Get("/oauth/clients", middleware.RequirePermission(services.PermClientsRead), oauthHandler.ListClients)
+		admin.Post("/oauth/clients", middleware.RequirePermission(services.PermClientsWrite), oauthHandler.CreateClient)
+		admin.Get("/oauth/clients/:clientID", middleware.RequirePermission(services.PermClientsRead), oauthHandler.GetClient)
+		admin.Patch("/oauth/clients/:clientID", middleware.RequirePermission(services.PermClientsWrite), oauthHandler.UpdateClient)
+		admin.Delete("/oauth/clients/:clientID", middleware.RequirePermission(services.PermClientsWrite), oauthHandler.DeleteClient)
+		admin.Post("/oauth/clients/:clientID/secret", middleware.RequirePermission(services.PermClientsWrite), oauthHandler.RotateClientSecret)
+		admin.Delete("/oauth/clients/:clientID/previous-secret", middleware.RequirePermission(services.PermClientsWrite), oauthHandler.RevokePreviousClientSecret)
+		admin.Get("/oauth/scopes", middleware.RequirePermission(services.PermClientsRead), oauthHandler.ListScopes)
+		admin.Post("/oauth/scopes", middleware.RequirePermission(services.PermClientsWrite), oauthHandler.CreateScope)
+		admin.Delete("/oauth/scopes/:name", middleware.RequirePermission(services.PermClientsWrite), oauthHandler.DeleteScope)
+
+		admin.Get("/users/:id/roles", middleware.RequirePermission(services.PermRolesRead), adminHandler.GetUserRoles)
+		admin.Post("/users/:id/roles", middleware.RequirePermission(services.PermRolesWrite), adminHandler.AssignUserRole)
+		admin.Delete("/users/:id/roles/:roleID", middleware.RequirePermission(services.PermRolesWrite), adminHandler.RemoveUserRole)
 	}
 }
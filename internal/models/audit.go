@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+)
+
+// Audit event types.
+const (
+	AuditLoginSucceeded         = "login.succeeded"
+	AuditLoginFailed            = "login.failed"
+	AuditLogout                 = "logout"
+	AuditPasswordReset          = "password.reset"
+	AuditAccountDeleted         = "account.deleted"
+	AuditAccountRestored        = "account.restored"
+	AuditAccountDeactivated     = "account.deactivated"
+	AuditAccountReactivated     = "account.reactivated"
+	AuditSessionsRevoked        = "sessions.revoked"
+	AuditEmailChangeRequested   = "email.change_requested"
+	AuditEmailChangeCancelled   = "email.change_cancelled"
+	AuditEmailChanged           = "email.changed"
+	AuditReauthenticated        = "reauthenticated"
+	AuditReauthenticationFailed = "reauthentication.failed"
+	AuditOAuthAuthorized        = "oauth.authorized"
+	AuditOAuthRevoked           = "oauth.revoked"
+	AuditOAuthTokenExchanged    = "oauth.token_exchanged"
+	AuditOAuthConsentRevoked    = "oauth.consent_revoked"
+	AuditIdentityLinked         = "identity.linked"
+	AuditIdentityUnlinked       = "identity.unlinked"
+	AuditPasswordSet            = "password.set"
+)
+
+type AuditEvent struct {
+	ID        string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID    *string   `json:"user_id,omitempty" gorm:"type:uuid;index"`
+	ActorID   *string   `json:"actor_id,omitempty" gorm:"type:uuid"` // set when someone else acted on the user
+	Type      string    `json:"type" gorm:"not null;index"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Metadata  JSONMap   `json:"metadata,omitempty"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// SessionInfo describes an active refresh session without exposing the token.
+type SessionInfo struct {
+	IssuedAt       time.Time `json:"issued_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	OrganizationID string    `json:"organization_id,omitempty"`
+}
+
+// AccountExport is the archive returned by GET /auth/me/export.
+type AccountExport struct {
+	ExportedAt    time.Time            `json:"exported_at"`
+	Profile       *User                `json:"profile"`
+	Roles         []Role               `json:"roles"`
+	Organizations []OrganizationMember `json:"organizations"`
+	Sessions      []SessionInfo        `json:"sessions"`
+	Consents      []OAuthConsent       `json:"oauth_consents"`
+	Identities    []Identity           `json:"identities"`
+	LoginHistory  []AuditEvent         `json:"login_history"`
+	AuditEvents   []AuditEvent         `json:"audit_events"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// Identity links a user to their account at an upstream identity provider,
+// identified by the provider's subject claim. A user can link one account
+// per provider.
+type Identity struct {
+	ID       string `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID   string `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_identities_user_provider"`
+	Provider string `json:"provider" gorm:"not null;uniqueIndex:idx_identities_user_provider;uniqueIndex:idx_identities_provider_subject"`
+	Subject  string `json:"subject" gorm:"not null;uniqueIndex:idx_identities_provider_subject"`
+	// Email is the last address the provider reported as verified.
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// IdentityProvider describes an upstream identity provider users can sign in
+// with.
+type IdentityProvider struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+// ExternalLoginCallback holds the parameters an upstream identity provider
+// redirects the user back with.
+type ExternalLoginCallback struct {
+	Code             string `query:"code"`
+	State            string `query:"state"`
+	Error            string `query:"error"`
+	ErrorDescription string `query:"error_description"`
+}
@@ -0,0 +1,38 @@
+package models
+
+// ImportedUser is a single account in a bulk import. PasswordHash holds the
+// hash exactly as exported by the source system.
+type ImportedUser struct {
+	Email         string `json:"email"`
+	PasswordHash  string `json:"password_hash"`
+	HashAlgorithm string `json:"hash_algorithm,omitempty"` // detected from the hash when empty
+	Salt          string `json:"salt,omitempty"`           // firebase-scrypt only
+	Active        *bool  `json:"active,omitempty"`
+}
+
+// FirebaseScryptParams are the project-wide hash parameters shown in the
+// Firebase console under "Password hash parameters".
+type FirebaseScryptParams struct {
+	SignerKey     string `json:"signer_key"`
+	SaltSeparator string `json:"salt_separator"`
+	Rounds        int    `json:"rounds"`
+	MemCost       int    `json:"mem_cost"`
+}
+
+type UserImportRequest struct {
+	Users          []ImportedUser        `json:"users"`
+	FirebaseScrypt *FirebaseScryptParams `json:"firebase_scrypt,omitempty"`
+}
+
+type UserImportError struct {
+	Index int    `json:"index"`
+	Email string `json:"email"`
+	Error string `json:"error"`
+}
+
+type UserImportResult struct {
+	Imported int               `json:"imported"`
+	Skipped  int               `json:"skipped"`
+	Failed   int               `json:"failed"`
+	Errors   []UserImportError `json:"errors,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+	InvitationRevoked  = "revoked"
+)
+
+type Invitation struct {
+	ID             string        `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	OrganizationID string        `json:"organization_id" gorm:"type:uuid;not null;index"`
+	Organization   *Organization `json:"organization,omitempty"`
+	Email          string        `json:"email" gorm:"not null;index"`
+	RoleID         string        `json:"role_id" gorm:"type:uuid;not null"`
+	Role           *Role         `json:"role,omitempty"`
+	InvitedByID    string        `json:"invited_by_id" gorm:"type:uuid;not null"`
+	Status         string        `json:"status" gorm:"not null;default:pending;index"`
+	ExpiresAt      time.Time     `json:"expires_at" gorm:"not null"`
+	RespondedAt    *time.Time    `json:"responded_at,omitempty"`
+	CreatedAt      time.Time     `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time     `json:"updated_at" gorm:"autoUpdateTime"`
+}
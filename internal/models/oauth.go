@@ -0,0 +1,294 @@
+package models
+
+import (
+	"time"
+)
+
+// OAuth client types. Confidential clients can keep a secret, public ones
+// (SPAs, mobile and desktop apps) can't and rely on PKCE alone.
+const (
+	ClientTypePublic       = "public"
+	ClientTypeConfidential = "confidential"
+)
+
+// OAuthClient is an application that obtains tokens through the OAuth
+// endpoints.
+type OAuthClient struct {
+	ID       string `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ClientID string `json:"client_id" gorm:"uniqueIndex;not null"`
+	Type     string `json:"type" gorm:"not null;default:public"`
+	// Confidential clients authenticate with a secret, or with a JWT signed
+	// by a key in JWKS (private_key_jwt). Only hashes of secrets are stored.
+	// After a rotation the previous secret keeps working until
+	// PreviousSecretExpiresAt.
+	SecretHash              string     `json:"-"`
+	PreviousSecretHash      string     `json:"-"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+	JWKS                    JSONMap    `json:"jwks,omitempty" gorm:"not null;default:'{}'"`
+	// Name and LogoURL are shown to users on consent screens.
+	Name    string `json:"name" gorm:"not null"`
+	LogoURL string `json:"logo_url,omitempty"`
+	// FirstParty clients are our own apps. Users aren't asked to consent to
+	// them.
+	FirstParty bool `json:"first_party" gorm:"not null;default:false"`
+	// RedirectURIs must match the redirect_uri of authorization requests
+	// exactly.
+	RedirectURIs StringList `json:"redirect_uris" gorm:"not null"`
+	GrantTypes   StringList `json:"grant_types" gorm:"not null"`
+	// Scopes lists the scopes the client may request.
+	Scopes StringList `json:"scopes" gorm:"not null"`
+	// ExchangeAudiences lists the audiences the client may request tokens
+	// for with the token exchange grant. Exchanged tokens name the actor in
+	// an act claim, unless the client may impersonate users and didn't send
+	// an actor token.
+	ExchangeAudiences     StringList `json:"exchange_audiences" gorm:"not null;default:'[]'"`
+	ExchangeImpersonation bool       `json:"exchange_impersonation" gorm:"not null;default:false"`
+	// Token lifetimes in seconds; 0 uses the service defaults.
+	AccessTokenLifetime  int       `json:"access_token_lifetime"`
+	RefreshTokenLifetime int       `json:"refresh_token_lifetime"`
+	Active               bool      `json:"active" gorm:"not null;default:true"`
+	CreatedAt            time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt            time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// OAuthClientInput holds the settings of an OAuth client that admins can
+// change. Nil fields are left unchanged on update. Type can only be set when
+// the client is created.
+type OAuthClientInput struct {
+	Name                  *string   `json:"name"`
+	Type                  *string   `json:"type"`
+	FirstParty            *bool     `json:"first_party"`
+	JWKS                  *JSONMap  `json:"jwks"`
+	LogoURL               *string   `json:"logo_url"`
+	RedirectURIs          *[]string `json:"redirect_uris"`
+	GrantTypes            *[]string `json:"grant_types"`
+	Scopes                *[]string `json:"scopes"`
+	ExchangeAudiences     *[]string `json:"exchange_audiences"`
+	ExchangeImpersonation *bool     `json:"exchange_impersonation"`
+	AccessTokenLifetime   *int      `json:"access_token_lifetime"`
+	RefreshTokenLifetime  *int      `json:"refresh_token_lifetime"`
+	Active                *bool     `json:"active"`
+}
+
+// AuthorizationRequest holds the parameters of an /oauth/authorize request.
+type AuthorizationRequest struct {
+	ResponseType        string `json:"response_type" query:"response_type" form:"response_type"`
+	ClientID            string `json:"client_id" query:"client_id" form:"client_id"`
+	RedirectURI         string `json:"redirect_uri" query:"redirect_uri" form:"redirect_uri"`
+	Scope               string `json:"scope" query:"scope" form:"scope"`
+	State               string `json:"state" query:"state" form:"state"`
+	CodeChallenge       string `json:"code_challenge" query:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" query:"code_challenge_method" form:"code_challenge_method"`
+	// Nonce is copied into the ID token (OpenID Connect).
+	Nonce string `json:"nonce" query:"nonce" form:"nonce"`
+	// Consent is the user's answer to a consent prompt: ConsentGrant or
+	// ConsentDeny. It is only read when the user approves the request.
+	Consent string `json:"consent" form:"consent"`
+}
+
+// Answers to a consent prompt.
+const (
+	ConsentGrant = "grant"
+	ConsentDeny  = "deny"
+)
+
+// OAuthScope is a scope clients can be allowed to request. Description is
+// shown to users on consent screens.
+type OAuthScope struct {
+	ID          string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Name        string    `json:"name" gorm:"uniqueIndex;not null"`
+	Description string    `json:"description" gorm:"not null;default:''"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// OAuthConsent records the scopes a user has granted to a client.
+type OAuthConsent struct {
+	ID        string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID    string     `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_oauth_consents_user_client"`
+	ClientID  string     `json:"client_id" gorm:"not null;uniqueIndex:idx_oauth_consents_user_client;index"`
+	Scopes    StringList `json:"scopes" gorm:"not null"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// UserConsent describes a consent to the user who granted it.
+type UserConsent struct {
+	ClientID   string       `json:"client_id"`
+	ClientName string       `json:"client_name"`
+	LogoURL    string       `json:"logo_url,omitempty"`
+	Scopes     []OAuthScope `json:"scopes"`
+	GrantedAt  time.Time    `json:"granted_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// ConsentPrompt is returned instead of an authorization code when the user
+// has to consent to the client first.
+type ConsentPrompt struct {
+	ClientID   string       `json:"client_id"`
+	ClientName string       `json:"client_name"`
+	LogoURL    string       `json:"logo_url,omitempty"`
+	Scopes     []OAuthScope `json:"scopes"`
+}
+
+// AuthorizationCode is what an issued authorization code stands for until
+// it is redeemed at the token endpoint.
+type AuthorizationCode struct {
+	ClientID    string `json:"client_id"`
+	UserID      string `json:"user_id"`
+	RedirectURI string `json:"redirect_uri"`
+	// RedirectURISent records whether the authorization request included
+	// redirect_uri, in which case the token request must repeat it.
+	RedirectURISent bool     `json:"redirect_uri_sent,omitempty"`
+	Scope           string   `json:"scope,omitempty"`
+	CodeChallenge   string   `json:"code_challenge"`
+	AuthTime        int64    `json:"auth_time"`
+	AMR             []string `json:"amr,omitempty"`
+	Nonce           string   `json:"nonce,omitempty"`
+}
+
+// ClientAuthentication holds the credentials a client sent to one of the
+// OAuth endpoints. Secrets sent with HTTP basic authentication are copied in.
+type ClientAuthentication struct {
+	ClientID            string `json:"client_id" form:"client_id"`
+	ClientSecret        string `json:"client_secret" form:"client_secret"`
+	ClientAssertionType string `json:"client_assertion_type" form:"client_assertion_type"`
+	ClientAssertion     string `json:"client_assertion" form:"client_assertion"`
+}
+
+// TokenRequest holds the parameters of an /oauth/token request.
+type TokenRequest struct {
+	GrantType    string `json:"grant_type" form:"grant_type"`
+	Scope        string `json:"scope" form:"scope"`
+	Code         string `json:"code" form:"code"`
+	RedirectURI  string `json:"redirect_uri" form:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier" form:"code_verifier"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+	DeviceCode   string `json:"device_code" form:"device_code"`
+	// Token exchange parameters (RFC 8693)
+	SubjectToken       string `json:"subject_token" form:"subject_token"`
+	SubjectTokenType   string `json:"subject_token_type" form:"subject_token_type"`
+	ActorToken         string `json:"actor_token" form:"actor_token"`
+	ActorTokenType     string `json:"actor_token_type" form:"actor_token_type"`
+	RequestedTokenType string `json:"requested_token_type" form:"requested_token_type"`
+	Audience           string `json:"audience" form:"audience"`
+}
+
+// DeviceAuthorizationRequest holds the parameters of an
+// /oauth/device_authorization request.
+type DeviceAuthorizationRequest struct {
+	Scope string `json:"scope" form:"scope"`
+}
+
+// DeviceAuthorizationResponse tells the device which code to show the user
+// and how often to poll the token endpoint (RFC 8628 section 3.2).
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// Statuses of a device code.
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+)
+
+// DeviceCode is what an issued device code stands for until the device
+// redeems it. UserID, AuthTime and AMR are set once the user approves.
+type DeviceCode struct {
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope,omitempty"`
+	UserCode string `json:"user_code"`
+	Status   string `json:"status"`
+	// Interval is the polling interval in seconds. It grows when the
+	// device polls too often.
+	Interval int64    `json:"interval"`
+	UserID   string   `json:"user_id,omitempty"`
+	AuthTime int64    `json:"auth_time,omitempty"`
+	AMR      []string `json:"amr,omitempty"`
+}
+
+// DeviceVerification describes a pending device authorization to the user
+// who entered its user code.
+type DeviceVerification struct {
+	UserCode   string `json:"user_code"`
+	ClientID   string `json:"client_id"`
+	ClientName string `json:"client_name"`
+	LogoURL    string `json:"logo_url,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+}
+
+// DeviceVerificationRequest approves or denies a device authorization.
+type DeviceVerificationRequest struct {
+	UserCode string `json:"user_code" validate:"required"`
+	Approve  bool   `json:"approve"`
+}
+
+// OAuthTokenResponse is the token endpoint's response (RFC 6749 section 5.1).
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	// IDToken is issued when the openid scope was granted.
+	IDToken string `json:"id_token,omitempty"`
+	// IssuedTokenType is set for token exchange responses.
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+// TokenTypeHint values of introspection and revocation requests (RFC 7009).
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// TokenRevocationRequest holds the parameters of an /oauth/revoke request.
+type TokenRevocationRequest struct {
+	Token         string `json:"token" form:"token"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+}
+
+// IntrospectionRequest holds the parameters of an /oauth/introspect request.
+type IntrospectionRequest struct {
+	Token         string `json:"token" form:"token"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+}
+
+// IntrospectionResponse describes a token to a resource server (RFC 7662).
+// Only Active is set for tokens that are invalid, expired or revoked.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+}
+
+// OpenIDConfiguration is the OpenID Connect discovery document served at
+// /.well-known/openid-configuration.
+type OpenIDConfiguration struct {
+	Issuer                                     string   `json:"issuer"`
+	AuthorizationEndpoint                      string   `json:"authorization_endpoint"`
+	TokenEndpoint                              string   `json:"token_endpoint"`
+	UserinfoEndpoint                           string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint                      string   `json:"introspection_endpoint"`
+	RevocationEndpoint                         string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint                string   `json:"device_authorization_endpoint"`
+	JWKSURI                                    string   `json:"jwks_uri"`
+	ScopesSupported                            []string `json:"scopes_supported"`
+	ResponseTypesSupported                     []string `json:"response_types_supported"`
+	GrantTypesSupported                        []string `json:"grant_types_supported"`
+	SubjectTypesSupported                      []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported           []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                            []string `json:"claims_supported"`
+}
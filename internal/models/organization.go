@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+type Organization struct {
+	ID        string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Name      string    `json:"name" gorm:"not null"`
+	Slug      string    `json:"slug" gorm:"uniqueIndex;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// OrganizationMember links a user to an organization. Roles are drawn from
+// the organization-scoped roles (Role.Scope == RoleScopeOrganization).
+type OrganizationMember struct {
+	ID             string        `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	OrganizationID string        `json:"organization_id" gorm:"type:uuid;not null;uniqueIndex:idx_org_members_org_user"`
+	UserID         string        `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_org_members_org_user;index"`
+	Organization   *Organization `json:"organization,omitempty"`
+	User           *User         `json:"user,omitempty"`
+	Roles          []Role        `json:"roles" gorm:"many2many:organization_member_roles"`
+	CreatedAt      time.Time     `json:"created_at" gorm:"autoCreateTime"`
+}
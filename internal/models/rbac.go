@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+type Permission struct {
+	ID          string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Name        string    `json:"name" gorm:"uniqueIndex;not null"` // e.g. "users:write"
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// Role scopes. Global roles are granted through user_roles; organization
+// roles are granted per membership through organization_member_roles.
+const (
+	RoleScopeGlobal       = "global"
+	RoleScopeOrganization = "organization"
+)
+
+type Role struct {
+	ID          string       `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Name        string       `json:"name" gorm:"uniqueIndex:idx_roles_name_scope;not null"`
+	Scope       string       `json:"scope" gorm:"uniqueIndex:idx_roles_name_scope;not null;default:global"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions"`
+	CreatedAt   time.Time    `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time    `json:"updated_at" gorm:"autoUpdateTime"`
+}
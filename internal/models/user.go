@@ -2,15 +2,67 @@ package models
 
 import (
 	"time"
+
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+	"gorm.io/gorm"
 )
 
 type User struct {
-	ID        string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	Email     string    `json:"email" gorm:"uniqueIndex;not null"`
-	Password  string    `json:"-" gorm:"not null"`
-	Active    bool      `json:"active" gorm:"default:true"`
-	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	ID                    string         `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Email                 string         `json:"email" gorm:"uniqueIndex;not null;index:idx_users_email_lower,unique,expression:lower(email)"`
+	Username              *string        `json:"username,omitempty" gorm:"index:idx_users_username_lower,unique,expression:lower(username)"`
+	Password              string         `json:"-" gorm:"not null"`
+	Active                bool           `json:"active" gorm:"default:true"`
+	PasswordResetRequired bool           `json:"password_reset_required" gorm:"not null;default:false"`
+	DisplayName           string         `json:"display_name"`
+	GivenName             string         `json:"given_name"`
+	FamilyName            string         `json:"family_name"`
+	Locale                string         `json:"locale"`   // BCP 47 language tag
+	Timezone              string         `json:"timezone"` // IANA time zone name
+	AvatarURL             string         `json:"avatar_url"`
+	UserMetadata          JSONMap        `json:"user_metadata" gorm:"not null;default:'{}'"` // editable by the user
+	AppMetadata           JSONMap        `json:"app_metadata" gorm:"not null;default:'{}'"`  // editable by admins only
+	Roles                 []Role         `json:"roles,omitempty" gorm:"many2many:user_roles"`
+	CreatedAt             time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt             time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt             gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// BeforeSave stores the email in its normalized form.
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	u.Email = utils.NormalizeEmail(u.Email)
+	return nil
+}
+
+// ProfileUpdate is a partial update of the user's own profile. Nil fields
+// are left unchanged. UserMetadata is merged into the existing metadata and
+// keys set to null are removed.
+type ProfileUpdate struct {
+	Username     *string `json:"username"` // "" removes the username
+	DisplayName  *string `json:"display_name"`
+	GivenName    *string `json:"given_name"`
+	FamilyName   *string `json:"family_name"`
+	Locale       *string `json:"locale"`
+	Timezone     *string `json:"timezone"`
+	AvatarURL    *string `json:"avatar_url"`
+	UserMetadata JSONMap `json:"user_metadata"`
+}
+
+// UserFilter selects users for the admin listing. Zero values are ignored.
+type UserFilter struct {
+	Email         string // case-insensitive substring match
+	Active        *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Page          int
+	PerPage       int
+}
+
+type UserList struct {
+	Users   []User `json:"users"`
+	Total   int64  `json:"total"`
+	Page    int    `json:"page"`
+	PerPage int    `json:"per_page"`
 }
 
 type TokenPair struct {
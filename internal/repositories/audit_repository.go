@@ -0,0 +1,38 @@
+package repositories
+
+import (
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"gorm.io/gorm"
+)
+
+type AuditRepository interface {
+	Create(event *models.AuditEvent) error
+	// ListByUser returns the user's most recent events, newest first. An empty
+	// types list matches every event type.
+	ListByUser(userID string, types []string, limit int) ([]models.AuditEvent, error)
+}
+
+type auditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Create(event *models.AuditEvent) error {
+	return r.db.Create(event).Error
+}
+
+func (r *auditRepository) ListByUser(userID string, types []string, limit int) ([]models.AuditEvent, error) {
+	query := r.db.Where("user_id = ?", userID)
+	if len(types) > 0 {
+		query = query.Where("type IN ?", types)
+	}
+
+	var events []models.AuditEvent
+	if err := query.Order("created_at DESC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"gorm.io/gorm"
+)
+
+type IdentityRepository interface {
+	Find(provider, subject string) (*models.Identity, error)
+	Create(identity *models.Identity) error
+	// CreateWithUser creates a new user together with their first identity.
+	CreateWithUser(user *models.User, identity *models.Identity) error
+	Update(identity *models.Identity) error
+	ListByUser(userID string) ([]models.Identity, error)
+	Delete(userID, provider string) error
+}
+
+type identityRepository struct {
+	db *gorm.DB
+}
+
+func NewIdentityRepository(db *gorm.DB) IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+func (r *identityRepository) Find(provider, subject string) (*models.Identity, error) {
+	var identity models.Identity
+	if err := r.db.First(&identity, "provider = ? AND subject = ?", provider, subject).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *identityRepository) Create(identity *models.Identity) error {
+	return r.db.Create(identity).Error
+}
+
+func (r *identityRepository) CreateWithUser(user *models.User, identity *models.Identity) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+}
+
+func (r *identityRepository) Update(identity *models.Identity) error {
+	return r.db.Save(identity).Error
+}
+
+func (r *identityRepository) ListByUser(userID string) ([]models.Identity, error) {
+	var identities []models.Identity
+	if err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (r *identityRepository) Delete(userID, provider string) error {
+	return r.db.Delete(&models.Identity{}, "user_id = ? AND provider = ?", userID, provider).Error
+}
@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+	"gorm.io/gorm"
+)
+
+type InvitationRepository interface {
+	Create(invitation *models.Invitation) (*models.Invitation, error)
+	FindByID(id string) (*models.Invitation, error)
+	FindPending(orgID, email string) (*models.Invitation, error)
+	ListPending(orgID string) ([]models.Invitation, error)
+	Update(invitation *models.Invitation) error
+}
+
+type invitationRepository struct {
+	db     *gorm.DB
+	emails utils.EmailNormalizer
+}
+
+// NewInvitationRepository returns a repository that stores and looks up
+// emails in the form given by emails, like the user repository.
+func NewInvitationRepository(db *gorm.DB, emails utils.EmailNormalizer) InvitationRepository {
+	return &invitationRepository{db: db, emails: emails}
+}
+
+func (r *invitationRepository) Create(invitation *models.Invitation) (*models.Invitation, error) {
+	invitation.Email = r.emails.Normalize(invitation.Email)
+	if err := r.db.Create(invitation).Error; err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func (r *invitationRepository) FindByID(id string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := r.db.Preload("Organization").Preload("Role").First(&invitation, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// FindPending returns the unexpired pending invitation for email, if any.
+func (r *invitationRepository) FindPending(orgID, email string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := r.db.First(&invitation,
+		"organization_id = ? AND email = ? AND status = ? AND expires_at > ?",
+		orgID, r.emails.Normalize(email), models.InvitationPending, time.Now(),
+	).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *invitationRepository) ListPending(orgID string) ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	err := r.db.Preload("Role").
+		Where("organization_id = ? AND status = ? AND expires_at > ?", orgID, models.InvitationPending, time.Now()).
+		Order("created_at DESC").
+		Find(&invitations).Error
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (r *invitationRepository) Update(invitation *models.Invitation) error {
+	invitation.Email = r.emails.Normalize(invitation.Email)
+	return r.db.Omit("Organization", "Role").Save(invitation).Error
+}
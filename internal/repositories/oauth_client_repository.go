@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"gorm.io/gorm"
+)
+
+type OAuthClientRepository interface {
+	Create(client *models.OAuthClient) (*models.OAuthClient, error)
+	FindByClientID(clientID string) (*models.OAuthClient, error)
+	List() ([]models.OAuthClient, error)
+	// UsesScope reports whether any client may request the scope.
+	UsesScope(scope string) (bool, error)
+	Update(client *models.OAuthClient) error
+	Delete(id string) error
+}
+
+type oauthClientRepository struct {
+	db *gorm.DB
+}
+
+func NewOAuthClientRepository(db *gorm.DB) OAuthClientRepository {
+	return &oauthClientRepository{db: db}
+}
+
+func (r *oauthClientRepository) Create(client *models.OAuthClient) (*models.OAuthClient, error) {
+	if err := r.db.Create(client).Error; err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (r *oauthClientRepository) FindByClientID(clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	if err := r.db.First(&client, "client_id = ?", clientID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (r *oauthClientRepository) List() ([]models.OAuthClient, error) {
+	var clients []models.OAuthClient
+	if err := r.db.Order("name").Find(&clients).Error; err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (r *oauthClientRepository) UsesScope(scope string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.OAuthClient{}).
+		Where("scopes @> ?", models.StringList{scope}).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *oauthClientRepository) Update(client *models.OAuthClient) error {
+	return r.db.Save(client).Error
+}
+
+func (r *oauthClientRepository) Delete(id string) error {
+	return r.db.Delete(&models.OAuthClient{}, "id = ?", id).Error
+}
@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"gorm.io/gorm"
+)
+
+type OAuthConsentRepository interface {
+	Find(userID, clientID string) (*models.OAuthConsent, error)
+	// Save creates the consent or replaces its scopes.
+	Save(consent *models.OAuthConsent) error
+	ListByUser(userID string) ([]models.OAuthConsent, error)
+	Delete(userID, clientID string) error
+}
+
+type oauthConsentRepository struct {
+	db *gorm.DB
+}
+
+func NewOAuthConsentRepository(db *gorm.DB) OAuthConsentRepository {
+	return &oauthConsentRepository{db: db}
+}
+
+func (r *oauthConsentRepository) Find(userID, clientID string) (*models.OAuthConsent, error) {
+	var consent models.OAuthConsent
+	if err := r.db.First(&consent, "user_id = ? AND client_id = ?", userID, clientID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func (r *oauthConsentRepository) Save(consent *models.OAuthConsent) error {
+	if consent.ID == "" {
+		return r.db.Create(consent).Error
+	}
+	return r.db.Save(consent).Error
+}
+
+func (r *oauthConsentRepository) ListByUser(userID string) ([]models.OAuthConsent, error) {
+	var consents []models.OAuthConsent
+	if err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&consents).Error; err != nil {
+		return nil, err
+	}
+	return consents, nil
+}
+
+func (r *oauthConsentRepository) Delete(userID, clientID string) error {
+	return r.db.Delete(&models.OAuthConsent{}, "user_id = ? AND client_id = ?", userID, clientID).Error
+}
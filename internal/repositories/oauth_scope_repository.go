@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"gorm.io/gorm"
+)
+
+type OAuthScopeRepository interface {
+	Create(scope *models.OAuthScope) (*models.OAuthScope, error)
+	FindByName(name string) (*models.OAuthScope, error)
+	// FindByNames returns the scopes that exist, ordered by name.
+	FindByNames(names []string) ([]models.OAuthScope, error)
+	List() ([]models.OAuthScope, error)
+	Delete(id string) error
+}
+
+type oauthScopeRepository struct {
+	db *gorm.DB
+}
+
+func NewOAuthScopeRepository(db *gorm.DB) OAuthScopeRepository {
+	return &oauthScopeRepository{db: db}
+}
+
+func (r *oauthScopeRepository) Create(scope *models.OAuthScope) (*models.OAuthScope, error) {
+	if err := r.db.Create(scope).Error; err != nil {
+		return nil, err
+	}
+	return scope, nil
+}
+
+func (r *oauthScopeRepository) FindByName(name string) (*models.OAuthScope, error) {
+	var scope models.OAuthScope
+	if err := r.db.First(&scope, "name = ?", name).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &scope, nil
+}
+
+func (r *oauthScopeRepository) FindByNames(names []string) ([]models.OAuthScope, error) {
+	var scopes []models.OAuthScope
+	if len(names) == 0 {
+		return scopes, nil
+	}
+	if err := r.db.Where("name IN ?", names).Order("name").Find(&scopes).Error; err != nil {
+		return nil, err
+	}
+	return scopes, nil
+}
+
+func (r *oauthScopeRepository) List() ([]models.OAuthScope, error) {
+	var scopes []models.OAuthScope
+	if err := r.db.Order("name").Find(&scopes).Error; err != nil {
+		return nil, err
+	}
+	return scopes, nil
+}
+
+func (r *oauthScopeRepository) Delete(id string) error {
+	return r.db.Delete(&models.OAuthScope{}, "id = ?", id).Error
+}
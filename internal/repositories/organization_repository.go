@@ -0,0 +1,156 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"gorm.io/gorm"
+)
+
+type OrganizationRepository interface {
+	Create(org *models.Organization, owner *models.OrganizationMember) (*models.Organization, error)
+	FindByID(id string) (*models.Organization, error)
+	FindBySlug(slug string) (*models.Organization, error)
+	Update(org *models.Organization) error
+	Delete(id string) error
+
+	FindMember(orgID, userID string) (*models.OrganizationMember, error)
+	ListMembers(orgID string) ([]models.OrganizationMember, error)
+	ListMemberships(userID string) ([]models.OrganizationMember, error)
+	AddMember(member *models.OrganizationMember) error
+	SetMemberRoles(member *models.OrganizationMember, roles []models.Role) error
+	RemoveMember(orgID, userID string) error
+	CountMembersWithRole(orgID, roleID string) (int64, error)
+}
+
+type organizationRepository struct {
+	db *gorm.DB
+}
+
+func NewOrganizationRepository(db *gorm.DB) OrganizationRepository {
+	return &organizationRepository{db: db}
+}
+
+// Create inserts the organization together with its first member.
+func (r *organizationRepository) Create(org *models.Organization, owner *models.OrganizationMember) (*models.Organization, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		owner.OrganizationID = org.ID
+		return tx.Create(owner).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func (r *organizationRepository) FindByID(id string) (*models.Organization, error) {
+	var org models.Organization
+	if err := r.db.First(&org, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *organizationRepository) FindBySlug(slug string) (*models.Organization, error) {
+	var org models.Organization
+	if err := r.db.First(&org, "slug = ?", slug).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *organizationRepository) Update(org *models.Organization) error {
+	return r.db.Save(org).Error
+}
+
+func (r *organizationRepository) Delete(id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(
+			"DELETE FROM organization_member_roles WHERE organization_member_id IN (SELECT id FROM organization_members WHERE organization_id = ?)",
+			id,
+		).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.OrganizationMember{}, "organization_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Organization{}, "id = ?", id).Error
+	})
+}
+
+func (r *organizationRepository) FindMember(orgID, userID string) (*models.OrganizationMember, error) {
+	var member models.OrganizationMember
+	err := r.db.Preload("Roles.Permissions").
+		First(&member, "organization_id = ? AND user_id = ?", orgID, userID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *organizationRepository) ListMembers(orgID string) ([]models.OrganizationMember, error) {
+	var members []models.OrganizationMember
+	err := r.db.Preload("User").Preload("Roles").
+		Where("organization_id = ?", orgID).
+		Order("created_at").
+		Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *organizationRepository) ListMemberships(userID string) ([]models.OrganizationMember, error) {
+	var members []models.OrganizationMember
+	err := r.db.Preload("Organization").Preload("Roles").
+		Where("user_id = ?", userID).
+		Order("created_at").
+		Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *organizationRepository) AddMember(member *models.OrganizationMember) error {
+	return r.db.Create(member).Error
+}
+
+func (r *organizationRepository) SetMemberRoles(member *models.OrganizationMember, roles []models.Role) error {
+	return r.db.Model(member).Association("Roles").Replace(roles)
+}
+
+func (r *organizationRepository) RemoveMember(orgID, userID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(
+			"DELETE FROM organization_member_roles WHERE organization_member_id IN (SELECT id FROM organization_members WHERE organization_id = ? AND user_id = ?)",
+			orgID, userID,
+		).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&models.OrganizationMember{}, "organization_id = ? AND user_id = ?", orgID, userID).Error
+	})
+}
+
+func (r *organizationRepository) CountMembersWithRole(orgID, roleID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.OrganizationMember{}).
+		Joins("JOIN organization_member_roles ON organization_member_roles.organization_member_id = organization_members.id").
+		Where("organization_members.organization_id = ? AND organization_member_roles.role_id = ?", orgID, roleID).
+		Count(&count).Error
+	return count, err
+}
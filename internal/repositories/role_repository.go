@@ -0,0 +1,157 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"gorm.io/gorm"
+)
+
+type RoleRepository interface {
+	CreateRole(role *models.Role) (*models.Role, error)
+	FindRoleByID(id string) (*models.Role, error)
+	FindRoleByName(name, scope string) (*models.Role, error)
+	FindRolesByName(names []string, scope string) ([]models.Role, error)
+	ListRoles() ([]models.Role, error)
+	UpdateRole(role *models.Role) error
+	DeleteRole(id string) error
+
+	CreatePermission(permission *models.Permission) (*models.Permission, error)
+	FindPermissionsByName(names []string) ([]models.Permission, error)
+	ListPermissions() ([]models.Permission, error)
+
+	FindUserRoles(userID string) ([]models.Role, error)
+	AssignRole(userID, roleID string) error
+	RemoveRole(userID, roleID string) error
+}
+
+type roleRepository struct {
+	db *gorm.DB
+}
+
+func NewRoleRepository(db *gorm.DB) RoleRepository {
+	return &roleRepository{db: db}
+}
+
+func (r *roleRepository) CreateRole(role *models.Role) (*models.Role, error) {
+	if err := r.db.Create(role).Error; err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (r *roleRepository) FindRoleByID(id string) (*models.Role, error) {
+	var role models.Role
+	if err := r.db.Preload("Permissions").First(&role, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *roleRepository) FindRoleByName(name, scope string) (*models.Role, error) {
+	var role models.Role
+	if err := r.db.Preload("Permissions").First(&role, "name = ? AND scope = ?", name, scope).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *roleRepository) FindRolesByName(names []string, scope string) ([]models.Role, error) {
+	var roles []models.Role
+	if len(names) == 0 {
+		return roles, nil
+	}
+	if err := r.db.Preload("Permissions").Where("name IN ? AND scope = ?", names, scope).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *roleRepository) ListRoles() ([]models.Role, error) {
+	var roles []models.Role
+	if err := r.db.Preload("Permissions").Order("scope, name").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// UpdateRole saves the role and replaces its permission set.
+func (r *roleRepository) UpdateRole(role *models.Role) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Permissions").Save(role).Error; err != nil {
+			return err
+		}
+		return tx.Model(role).Association("Permissions").Replace(role.Permissions)
+	})
+}
+
+func (r *roleRepository) DeleteRole(id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM user_roles WHERE role_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM organization_member_roles WHERE role_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Role{}, "id = ?", id).Error
+	})
+}
+
+func (r *roleRepository) CreatePermission(permission *models.Permission) (*models.Permission, error) {
+	if err := r.db.Create(permission).Error; err != nil {
+		return nil, err
+	}
+	return permission, nil
+}
+
+func (r *roleRepository) FindPermissionsByName(names []string) ([]models.Permission, error) {
+	var permissions []models.Permission
+	if len(names) == 0 {
+		return permissions, nil
+	}
+	if err := r.db.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (r *roleRepository) ListPermissions() ([]models.Permission, error) {
+	var permissions []models.Permission
+	if err := r.db.Order("name").Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (r *roleRepository) FindUserRoles(userID string) ([]models.Role, error) {
+	var roles []models.Role
+	err := r.db.Preload("Permissions").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ? AND roles.scope = ?", userID, models.RoleScopeGlobal).
+		Order("roles.name").
+		Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *roleRepository) AssignRole(userID, roleID string) error {
+	return r.db.Exec(
+		"INSERT INTO user_roles (user_id, role_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
+		userID, roleID,
+	).Error
+}
+
+func (r *roleRepository) RemoveRole(userID, roleID string) error {
+	return r.db.Exec("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?", userID, roleID).Error
+}
@@ -2,28 +2,49 @@ package repositories
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
 	"gorm.io/gorm"
 )
 
 type UserRepository interface {
 	Create(user *models.User) (*models.User, error)
 	FindByID(id string) (*models.User, error)
+	// FindByIDUnscoped also returns soft-deleted users.
+	FindByIDUnscoped(id string) (*models.User, error)
 	FindByEmail(email string) (*models.User, error)
+	// FindByEmailUnscoped also returns soft-deleted users, whose email stays
+	// reserved until they are purged.
+	FindByEmailUnscoped(email string) (*models.User, error)
+	// Usernames are matched case-insensitively.
+	FindByUsername(username string) (*models.User, error)
+	FindByUsernameUnscoped(username string) (*models.User, error)
 	Update(user *models.User) error
+	// Delete soft-deletes the user; Purge removes the row and related data.
 	Delete(id string) error
+	// Restore undeletes a soft-deleted user and reports whether one was found.
+	Restore(id string) (bool, error)
+	Purge(id string) error
+	FindDeletedBefore(before time.Time, limit int) ([]models.User, error)
+	List(filter models.UserFilter) ([]models.User, int64, error)
 }
 
 type userRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	emails utils.EmailNormalizer
 }
 
-func NewUserRepository(db *gorm.DB) UserRepository {
-	return &userRepository{db: db}
+// NewUserRepository returns a repository that stores and looks up emails in
+// the form given by emails.
+func NewUserRepository(db *gorm.DB, emails utils.EmailNormalizer) UserRepository {
+	return &userRepository{db: db, emails: emails}
 }
 
 func (r *userRepository) Create(user *models.User) (*models.User, error) {
+	user.Email = r.emails.Normalize(user.Email)
 	if err := r.db.Create(user).Error; err != nil {
 		return nil, err
 	}
@@ -31,8 +52,16 @@ func (r *userRepository) Create(user *models.User) (*models.User, error) {
 }
 
 func (r *userRepository) FindByID(id string) (*models.User, error) {
+	return r.findByID(r.db, id)
+}
+
+func (r *userRepository) FindByIDUnscoped(id string) (*models.User, error) {
+	return r.findByID(r.db.Unscoped(), id)
+}
+
+func (r *userRepository) findByID(db *gorm.DB, id string) (*models.User, error) {
 	var user models.User
-	if err := r.db.First(&user, "id = ?", id).Error; err != nil {
+	if err := db.First(&user, "id = ?", id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -43,7 +72,7 @@ func (r *userRepository) FindByID(id string) (*models.User, error) {
 
 func (r *userRepository) FindByEmail(email string) (*models.User, error) {
 	var user models.User
-	if err := r.db.First(&user, "email = ?", email).Error; err != nil {
+	if err := r.db.First(&user, "email = ?", r.emails.Normalize(email)).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -53,9 +82,121 @@ func (r *userRepository) FindByEmail(email string) (*models.User, error) {
 }
 
 func (r *userRepository) Update(user *models.User) error {
+	user.Email = r.emails.Normalize(user.Email)
 	return r.db.Save(user).Error
 }
 
+func (r *userRepository) FindByEmailUnscoped(email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.Unscoped().First(&user, "email = ?", r.emails.Normalize(email)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *userRepository) FindByUsername(username string) (*models.User, error) {
+	return r.findByUsername(r.db, username)
+}
+
+func (r *userRepository) FindByUsernameUnscoped(username string) (*models.User, error) {
+	return r.findByUsername(r.db.Unscoped(), username)
+}
+
+func (r *userRepository) findByUsername(db *gorm.DB, username string) (*models.User, error) {
+	var user models.User
+	if err := db.First(&user, "lower(username) = lower(?)", username).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
 func (r *userRepository) Delete(id string) error {
 	return r.db.Delete(&models.User{}, "id = ?", id).Error
 }
+
+func (r *userRepository) Restore(id string) (bool, error) {
+	result := r.db.Unscoped().Model(&models.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Purge permanently removes the user together with their role assignments,
+// organization memberships, invitations they sent and audit history.
+func (r *userRepository) Purge(id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			"DELETE FROM user_roles WHERE user_id = ?",
+			"DELETE FROM organization_member_roles WHERE organization_member_id IN (SELECT id FROM organization_members WHERE user_id = ?)",
+			"DELETE FROM organization_members WHERE user_id = ?",
+			"DELETE FROM invitations WHERE invited_by_id = ?",
+			"DELETE FROM oauth_consents WHERE user_id = ?",
+			"DELETE FROM identities WHERE user_id = ?",
+			"DELETE FROM audit_events WHERE user_id = ?",
+			"UPDATE audit_events SET actor_id = NULL WHERE actor_id = ?",
+		}
+		for _, stmt := range statements {
+			if err := tx.Exec(stmt, id).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(&models.User{}, "id = ?", id).Error
+	})
+}
+
+func (r *userRepository) FindDeletedBefore(before time.Time, limit int) ([]models.User, error) {
+	var users []models.User
+	err := r.db.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Order("deleted_at").
+		Limit(limit).
+		Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *userRepository) List(filter models.UserFilter) ([]models.User, int64, error) {
+	query := r.db.Model(&models.User{})
+	if filter.Email != "" {
+		query = query.Where("email ILIKE ?", "%"+escapeLike(filter.Email)+"%")
+	}
+	if filter.Active != nil {
+		query = query.Where("active = ?", *filter.Active)
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *filter.CreatedBefore)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	err := query.Order("created_at DESC").
+		Offset((filter.Page - 1) * filter.PerPage).
+		Limit(filter.PerPage).
+		Find(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
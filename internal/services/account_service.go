@@ -0,0 +1,387 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	exportLoginHistoryLimit = 100
+	exportAuditEventLimit   = 1000
+	purgeBatchSize          = 100
+)
+
+// AccountService implements the self-service account lifecycle.
+type AccountService interface {
+	// DeleteAccount soft-deletes the account after re-checking the password
+	// and returns when it will be purged. Accounts without a password can
+	// only be deleted if recentAuth is set, i.e. the user signed in at an
+	// identity provider recently.
+	DeleteAccount(ctx context.Context, userID, password string, recentAuth bool) (time.Time, error)
+	ExportData(ctx context.Context, userID string) (*models.AccountExport, error)
+	UpdateProfile(ctx context.Context, userID string, update models.ProfileUpdate) (*models.User, error)
+	// SetPassword adds a password to an account that so far only signs in
+	// with identity providers.
+	SetPassword(ctx context.Context, userID, password string) error
+	// CheckUsername returns nil if username is valid and not taken, otherwise
+	// a utils.ErrUsername* error.
+	CheckUsername(username string) error
+	// PurgeDeletedAccounts permanently removes accounts whose grace period has
+	// passed and returns how many were purged.
+	PurgeDeletedAccounts(ctx context.Context) (int, error)
+}
+
+type accountService struct {
+	userRepo       repositories.UserRepository
+	consentRepo    repositories.OAuthConsentRepository
+	identityRepo   repositories.IdentityRepository
+	authService    AuthService
+	rbacService    RBACService
+	orgService     OrganizationService
+	jwtService     JWTService
+	redisService   RedisService
+	auditService   AuditService
+	usernamePolicy *utils.UsernamePolicy
+	gracePeriod    time.Duration
+}
+
+func NewAccountService(
+	userRepo repositories.UserRepository,
+	consentRepo repositories.OAuthConsentRepository,
+	identityRepo repositories.IdentityRepository,
+	authService AuthService,
+	rbacService RBACService,
+	orgService OrganizationService,
+	jwtService JWTService,
+	redisService RedisService,
+	auditService AuditService,
+	usernamePolicy *utils.UsernamePolicy,
+	gracePeriod time.Duration,
+) AccountService {
+	return &accountService{
+		userRepo:       userRepo,
+		consentRepo:    consentRepo,
+		identityRepo:   identityRepo,
+		authService:    authService,
+		rbacService:    rbacService,
+		orgService:     orgService,
+		jwtService:     jwtService,
+		redisService:   redisService,
+		auditService:   auditService,
+		usernamePolicy: usernamePolicy,
+		gracePeriod:    gracePeriod,
+	}
+}
+
+func (s *accountService) DeleteAccount(ctx context.Context, userID, password string, recentAuth bool) (time.Time, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if user == nil {
+		return time.Time{}, utils.ErrUserNotFound
+	}
+
+	if user.Password == "" {
+		if !recentAuth {
+			return time.Time{}, errNoPassword
+		}
+	} else if !utils.VerifyPassword(password, user.Password) {
+		return time.Time{}, utils.ErrInvalidCredentials
+	}
+
+	if err := s.userRepo.Delete(user.ID); err != nil {
+		return time.Time{}, err
+	}
+	if err := s.authService.RevokeSessions(ctx, user.ID); err != nil {
+		return time.Time{}, err
+	}
+
+	purgeAt := time.Now().Add(s.gracePeriod)
+	s.auditService.Record(ctx, user.ID, models.AuditAccountDeleted, models.JSONMap{
+		"purge_after": purgeAt.Format(time.RFC3339),
+	})
+	return purgeAt, nil
+}
+
+func (s *accountService) SetPassword(ctx context.Context, userID, password string) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return utils.ErrUserNotFound
+	}
+	if user.Password != "" {
+		return utils.ErrConflict.WithMessage("account already has a password")
+	}
+	if !utils.IsPasswordValid(password) {
+		return utils.ErrWeakPassword
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, user.ID, models.AuditPasswordSet, nil)
+	return nil
+}
+
+func (s *accountService) UpdateProfile(ctx context.Context, userID string, update models.ProfileUpdate) (*models.User, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, utils.ErrUserNotFound
+	}
+
+	if update.Username != nil {
+		username := strings.TrimSpace(*update.Username)
+		if username == "" {
+			user.Username = nil
+		} else {
+			if err := s.usernamePolicy.Validate(username); err != nil {
+				return nil, err
+			}
+			existingUser, err := s.userRepo.FindByUsernameUnscoped(username)
+			if err != nil {
+				return nil, err
+			}
+			if existingUser != nil && existingUser.ID != user.ID {
+				return nil, utils.ErrUsernameTaken
+			}
+			user.Username = &username
+		}
+	}
+
+	names := []struct {
+		value *string
+		field *string
+		label string
+	}{
+		{update.DisplayName, &user.DisplayName, "display_name"},
+		{update.GivenName, &user.GivenName, "given_name"},
+		{update.FamilyName, &user.FamilyName, "family_name"},
+	}
+	for _, n := range names {
+		if n.value == nil {
+			continue
+		}
+		v := strings.TrimSpace(*n.value)
+		if !utils.IsProfileNameValid(v) {
+			return nil, utils.ErrInvalidInput.WithMessagef("%s must be at most %d characters on a single line", n.label, utils.MaxProfileNameLength)
+		}
+		*n.field = v
+	}
+
+	if update.Locale != nil {
+		if *update.Locale != "" && !utils.IsLocaleValid(*update.Locale) {
+			return nil, utils.ErrInvalidInput.WithMessage("locale must be a BCP 47 language tag")
+		}
+		user.Locale = *update.Locale
+	}
+
+	if update.Timezone != nil {
+		if *update.Timezone != "" && !utils.IsTimezoneValid(*update.Timezone) {
+			return nil, utils.ErrInvalidInput.WithMessage("timezone must be an IANA time zone name")
+		}
+		user.Timezone = *update.Timezone
+	}
+
+	if update.AvatarURL != nil {
+		if *update.AvatarURL != "" && !utils.IsImageURLValid(*update.AvatarURL) {
+			return nil, utils.ErrInvalidInput.WithMessage("avatar_url must be an absolute http or https URL")
+		}
+		user.AvatarURL = *update.AvatarURL
+	}
+
+	if update.UserMetadata != nil {
+		metadata, err := mergeMetadata(user.UserMetadata, update.UserMetadata)
+		if err != nil {
+			return nil, err
+		}
+		user.UserMetadata = metadata
+	}
+
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *accountService) CheckUsername(username string) error {
+	if err := s.usernamePolicy.Validate(username); err != nil {
+		return err
+	}
+
+	// Deleted accounts keep their username until purged
+	existingUser, err := s.userRepo.FindByUsernameUnscoped(username)
+	if err != nil {
+		return err
+	}
+	if existingUser != nil {
+		return utils.ErrUsernameTaken
+	}
+	return nil
+}
+
+func (s *accountService) ExportData(ctx context.Context, userID string) (*models.AccountExport, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, utils.ErrUserNotFound
+	}
+
+	roles, err := s.rbacService.GetUserRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := s.orgService.ListUserOrganizations(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.activeSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	consents, err := s.consentRepo.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := s.identityRepo.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	loginHistory, err := s.auditService.ListUserEvents(userID,
+		[]string{models.AuditLoginSucceeded, models.AuditLoginFailed, models.AuditLogout},
+		exportLoginHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.auditService.ListUserEvents(userID, nil, exportAuditEventLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AccountExport{
+		ExportedAt:    time.Now().UTC(),
+		Profile:       user,
+		Roles:         roles,
+		Organizations: memberships,
+		Sessions:      sessions,
+		Consents:      consents,
+		Identities:    identities,
+		LoginHistory:  loginHistory,
+		AuditEvents:   events,
+	}, nil
+}
+
+// activeSessions describes the user's refresh session, if any. Users have
+// at most one refresh token at a time.
+func (s *accountService) activeSessions(ctx context.Context, userID string) ([]models.SessionInfo, error) {
+	sessions := []models.SessionInfo{}
+
+	token, err := s.redisService.GetRefreshToken(ctx, userID)
+	if errors.Is(err, redis.Nil) {
+		return sessions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := s.jwtService.ValidateRefreshToken(token)
+	if err != nil {
+		return sessions, nil
+	}
+
+	iat, _ := claims["iat"].(float64)
+	exp, _ := claims["exp"].(float64)
+	orgID, _ := claims["org_id"].(string)
+	return append(sessions, models.SessionInfo{
+		IssuedAt:       time.Unix(int64(iat), 0).UTC(),
+		ExpiresAt:      time.Unix(int64(exp), 0).UTC(),
+		OrganizationID: orgID,
+	}), nil
+}
+
+func (s *accountService) PurgeDeletedAccounts(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-s.gracePeriod)
+	purged := 0
+
+	for {
+		users, err := s.userRepo.FindDeletedBefore(cutoff, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		if len(users) == 0 {
+			return purged, nil
+		}
+
+		for _, user := range users {
+			if err := s.userRepo.Purge(user.ID); err != nil {
+				return purged, err
+			}
+			// Sessions were revoked at deletion; drop anything left behind
+			if err := s.redisService.DeleteRefreshToken(ctx, user.ID); err != nil {
+				log.Printf("WARNING: failed to delete refresh token for purged user %s: %v", user.ID, err)
+			}
+			purged++
+		}
+	}
+}
+
+// mergeMetadata applies patch to current: keys set to null are removed and
+// all other keys are replaced. The result must stay within
+// utils.MaxMetadataSize once encoded.
+func mergeMetadata(current, patch models.JSONMap) (models.JSONMap, error) {
+	merged := models.JSONMap{}
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+
+	if err := checkMetadataSize(merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+func checkMetadataSize(metadata models.JSONMap) error {
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if len(encoded) > utils.MaxMetadataSize {
+		return utils.ErrInvalidInput.WithMessagef("metadata must be at most %d bytes", utils.MaxMetadataSize)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	hash, err := utils.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		hash       string
+		password   string
+		recentAuth bool
+		wantErr    error
+	}{
+		{name: "correct password", hash: hash, password: "correct horse"},
+		{name: "wrong password", hash: hash, password: "wrong", recentAuth: true, wantErr: utils.ErrInvalidCredentials},
+		{name: "no password, recent sign in", recentAuth: true},
+		{name: "no password, old sign in", wantErr: utils.ErrReauthenticationRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := newMemoryUsers(&models.User{ID: "user-1", Password: tt.hash, Active: true})
+			redisService := newMemoryRedis()
+			jwtService := NewJWTService("test-secret", time.Minute, time.Hour)
+			s := &accountService{
+				userRepo:     users,
+				authService:  &authService{userRepo: users, jwtService: jwtService, redisService: redisService},
+				auditService: discardAudit{},
+			}
+
+			_, err := s.DeleteAccount(context.Background(), "user-1", tt.password, tt.recentAuth)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if deleted := users.users["user-1"].DeletedAt.Valid; deleted != (tt.wantErr == nil) {
+				t.Errorf("deleted = %v", deleted)
+			}
+		})
+	}
+}
+
+func TestExportDataIncludesConsentsAndIdentities(t *testing.T) {
+	users := newMemoryUsers(&models.User{ID: "user-1", Active: true})
+	consents := &memoryConsents{consents: []models.OAuthConsent{
+		{UserID: "user-1", ClientID: "client-1", Scopes: models.StringList{"openid"}},
+		{UserID: "user-2", ClientID: "client-1", Scopes: models.StringList{"openid"}},
+	}}
+	identities := &memoryIdentities{users: users, identities: []models.Identity{
+		{UserID: "user-1", Provider: "google", Subject: "1234"},
+	}}
+	s := &accountService{
+		userRepo:     users,
+		consentRepo:  consents,
+		identityRepo: identities,
+		rbacService:  &fixedRBAC{},
+		orgService:   noOrganizations{},
+		redisService: newMemoryRedis(),
+		auditService: discardAudit{},
+	}
+
+	export, err := s.ExportData(context.Background(), "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(export.Consents) != 1 || export.Consents[0].ClientID != "client-1" {
+		t.Errorf("consents = %+v", export.Consents)
+	}
+	if len(export.Identities) != 1 || export.Identities[0].Provider != "google" {
+		t.Errorf("identities = %+v", export.Identities)
+	}
+}
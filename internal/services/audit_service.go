@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+)
+
+type clientInfoKey struct{}
+
+type actorKey struct{}
+
+// ClientInfo identifies where a request came from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// WithClientInfo attaches the caller's address and user agent to ctx so
+// audit events can record them.
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// WithActor attaches the authenticated user performing the request to ctx.
+func WithActor(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, actorKey{}, userID)
+}
+
+type AuditService interface {
+	// Record stores an event about userID. Failures are logged rather than
+	// returned so auditing never blocks the action being audited.
+	Record(ctx context.Context, userID, eventType string, metadata models.JSONMap)
+	ListUserEvents(userID string, types []string, limit int) ([]models.AuditEvent, error)
+}
+
+type auditService struct {
+	auditRepo repositories.AuditRepository
+}
+
+func NewAuditService(auditRepo repositories.AuditRepository) AuditService {
+	return &auditService{auditRepo: auditRepo}
+}
+
+func (s *auditService) Record(ctx context.Context, userID, eventType string, metadata models.JSONMap) {
+	event := &models.AuditEvent{
+		Type:     eventType,
+		Metadata: metadata,
+	}
+	if userID != "" {
+		event.UserID = &userID
+	}
+	if info, ok := ctx.Value(clientInfoKey{}).(ClientInfo); ok {
+		event.IP = info.IP
+		event.UserAgent = info.UserAgent
+	}
+	// Only record an actor when someone else acted on the user
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" && actor != userID {
+		event.ActorID = &actor
+	}
+
+	if err := s.auditRepo.Create(event); err != nil {
+		log.Printf("WARNING: failed to record audit event %s for user %s: %v", eventType, userID, err)
+	}
+}
+
+func (s *auditService) ListUserEvents(userID string, types []string, limit int) ([]models.AuditEvent, error) {
+	return s.auditRepo.ListByUser(userID, types, limit)
+}
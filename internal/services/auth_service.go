@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/kimutaiwycliff/auth-service/internal/models"
 	"github.com/kimutaiwycliff/auth-service/internal/repositories"
 	"github.com/kimutaiwycliff/auth-service/internal/utils"
@@ -14,48 +17,115 @@ import (
 
 type AuthService interface {
 	Register(email, password string) (*models.User, error)
-	Login(email, password string) (*models.TokenPair, error)
-	RefreshToken(ctx context.Context,refreshToken string) (*models.TokenPair, error)
-	Logout(userID, accessToken string) error
+	// Login accepts either an email or a username as identifier.
+	Login(ctx context.Context, identifier, password string) (*models.TokenPair, error)
+	// LoginExternal starts a session for a user who signed in at the
+	// upstream identity provider named provider.
+	LoginExternal(ctx context.Context, userID, provider string) (*models.TokenPair, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*models.TokenPair, error)
+	Logout(ctx context.Context, userID, accessToken string) error
 	VerifyToken(token string) (string, error) // returns userID
+	// ValidateAccessToken checks the signature, the blacklist and the user's
+	// revocation watermark, and returns the token's claims.
+	ValidateAccessToken(ctx context.Context, token string) (jwt.MapClaims, error)
+	// ValidateRefreshToken checks the signature, the blacklist and that the
+	// token is still the current refresh token of its session, and returns
+	// the token's claims.
+	ValidateRefreshToken(ctx context.Context, token string) (jwt.MapClaims, error)
 	GetUser(userID string) (*models.User, error)
+	// SwitchOrganization re-issues the tokens of a session. authTime and amr
+	// are the session's auth_time and amr claims, which are carried over
+	// unchanged.
+	SwitchOrganization(ctx context.Context, userID, orgID string, authTime int64, amr []string) (*models.TokenPair, error)
+	// Reauthenticate checks the user's password again and re-issues the
+	// session's tokens with a fresh auth_time. Users without a password
+	// re-authenticate by signing in at an identity provider instead.
+	Reauthenticate(ctx context.Context, userID, orgID, password string) (*models.TokenPair, error)
+	// IssueClientTokens starts a session for an OAuth client acting on the
+	// user's behalf. It is kept apart from the user's own session, so
+	// authorizing a client doesn't sign the user out elsewhere.
+	IssueClientTokens(ctx context.Context, userID, clientID, scope string, authTime int64, amr []string, lifetimes TokenLifetimes) (*models.TokenPair, error)
+	// RefreshClientToken is RefreshToken for sessions of OAuth clients. The
+	// refresh token must have been issued to clientID.
+	RefreshClientToken(ctx context.Context, clientID, refreshToken string, lifetimes TokenLifetimes) (*models.TokenPair, error)
+	// RevokeSessions signs the user out everywhere.
+	RevokeSessions(ctx context.Context, userID string) error
+	// RevokeClientSession ends the session of an OAuth client acting on the
+	// user's behalf, including its access tokens.
+	RevokeClientSession(ctx context.Context, userID, clientID string) error
 }
 
+// TokenLifetimes overrides the lifetimes of a session's tokens. Zero values
+// use the configured defaults.
+type TokenLifetimes struct {
+	Access  time.Duration
+	Refresh time.Duration
+}
+
+// errNoPassword tells users who only sign in with identity providers to
+// confirm who they are by signing in at one again, rather than with a
+// password.
+var errNoPassword = utils.ErrReauthenticationRequired.WithMessage("account has no password, sign in with an identity provider again")
+
 type authService struct {
-	userRepo    repositories.UserRepository
-	jwtService  JWTService
+	userRepo     repositories.UserRepository
+	jwtService   JWTService
 	redisService RedisService
+	rbacService  RBACService
+	orgService   OrganizationService
+	auditService AuditService
+	emails       utils.EmailNormalizer
+	// profileClaims lists the profile claims copied into access tokens.
+	profileClaims []string
 }
 
 func NewAuthService(
 	userRepo repositories.UserRepository,
 	jwtService JWTService,
 	redisService RedisService,
+	rbacService RBACService,
+	orgService OrganizationService,
+	auditService AuditService,
+	emails utils.EmailNormalizer,
+	profileClaims []string,
 ) AuthService {
+	for _, name := range profileClaims {
+		if _, ok := profileClaimValues[name]; !ok {
+			log.Printf("WARNING: ignoring unknown profile claim %q", name)
+		}
+	}
+
 	return &authService{
-		userRepo:    userRepo,
-		jwtService:  jwtService,
-		redisService: redisService,
+		userRepo:      userRepo,
+		jwtService:    jwtService,
+		redisService:  redisService,
+		rbacService:   rbacService,
+		orgService:    orgService,
+		auditService:  auditService,
+		emails:        emails,
+		profileClaims: profileClaims,
 	}
 }
 
 func (s *authService) Register(email, password string) (*models.User, error) {
+	email = s.emails.Normalize(email)
+
 	// Validate input
-	if !utils.IsEmailValid(email) {
-		return nil, errors.New("invalid email format")
+	if err := utils.ValidateEmail(email); err != nil {
+		return nil, err
 	}
 
 	if !utils.IsPasswordValid(password) {
-		return nil, errors.New("password must be at least 8 characters")
+		return nil, utils.ErrWeakPassword
 	}
 
-	// Check if user exists
-	existingUser, err := s.userRepo.FindByEmail(email)
+	// Check if user exists, including accounts awaiting purge
+	existingUser, err := s.userRepo.FindByEmailUnscoped(email)
 	if err != nil {
 		return nil, err
 	}
 	if existingUser != nil {
-		return nil, errors.New("user already exists")
+		return nil, utils.ErrUserExists
 	}
 
 	// Hash password
@@ -73,87 +143,147 @@ func (s *authService) Register(email, password string) (*models.User, error) {
 	return s.userRepo.Create(user)
 }
 
-func (s *authService) Login(email, password string) (*models.TokenPair, error) {
-	// Find user
-	user, err := s.userRepo.FindByEmail(email)
+func (s *authService) Login(ctx context.Context, identifier, password string) (*models.TokenPair, error) {
+	// Find user; usernames can't contain "@"
+	var user *models.User
+	var err error
+	if strings.Contains(identifier, "@") {
+		user, err = s.userRepo.FindByEmail(identifier)
+	} else {
+		user, err = s.userRepo.FindByUsername(identifier)
+	}
 	if err != nil {
 		return nil, err
 	}
 	if user == nil {
-		return nil, errors.New("invalid credentials")
+		s.auditService.Record(ctx, "", models.AuditLoginFailed, models.JSONMap{"identifier": identifier, "reason": "unknown_user"})
+		return nil, utils.ErrInvalidCredentials
 	}
 
 	// Verify password
 	if !utils.VerifyPassword(password, user.Password) {
-		return nil, errors.New("invalid credentials")
+		s.auditService.Record(ctx, user.ID, models.AuditLoginFailed, models.JSONMap{"reason": "invalid_password"})
+		return nil, utils.ErrInvalidCredentials
+	}
+
+	if !user.Active {
+		s.auditService.Record(ctx, user.ID, models.AuditLoginFailed, models.JSONMap{"reason": "account_disabled"})
+		return nil, utils.ErrAccountDisabled
+	}
+
+	if user.PasswordResetRequired {
+		s.auditService.Record(ctx, user.ID, models.AuditLoginFailed, models.JSONMap{"reason": "password_reset_required"})
+		return nil, utils.ErrPasswordResetRequired
+	}
+
+	// Upgrade imported or outdated hashes now that we have the plaintext
+	if utils.NeedsRehash(user.Password) {
+		s.upgradePasswordHash(user, password)
 	}
 
 	// Generate tokens
-	accessToken, err := s.jwtService.GenerateAccessToken(user.ID)
+	tokens, err := s.issueTokens(ctx, session{userID: user.ID, authTime: time.Now().Unix(), amr: []string{AuthMethodPassword}})
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken, err := s.jwtService.GenerateRefreshToken(user.ID)
+	s.auditService.Record(ctx, user.ID, models.AuditLoginSucceeded, nil)
+	return tokens, nil
+}
+
+func (s *authService) LoginExternal(ctx context.Context, userID, provider string) (*models.TokenPair, error) {
+	user, err := s.userRepo.FindByID(userID)
 	if err != nil {
 		return nil, err
 	}
+	if user == nil {
+		return nil, utils.ErrUserNotFound
+	}
+	if !user.Active {
+		s.auditService.Record(ctx, user.ID, models.AuditLoginFailed, models.JSONMap{"provider": provider, "reason": "account_disabled"})
+		return nil, utils.ErrAccountDisabled
+	}
 
-	// Store refresh token using RedisService
-	err = s.redisService.StoreRefreshToken(context.Background(), user.ID, refreshToken, s.jwtService.GetRefreshExpiry())
+	tokens, err := s.issueTokens(ctx, session{userID: user.ID, authTime: time.Now().Unix(), amr: []string{AuthMethodFederated}})
 	if err != nil {
 		return nil, err
 	}
 
-	return &models.TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-	}, nil
+	s.auditService.Record(ctx, user.ID, models.AuditLoginSucceeded, models.JSONMap{"provider": provider})
+	return tokens, nil
 }
 
 func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	return s.refresh(ctx, "", refreshToken, TokenLifetimes{})
+}
+
+func (s *authService) RefreshClientToken(ctx context.Context, clientID, refreshToken string, lifetimes TokenLifetimes) (*models.TokenPair, error) {
+	return s.refresh(ctx, clientID, refreshToken, lifetimes)
+}
+
+// refresh rotates the refresh token of a session. clientID is empty for the
+// user's own session.
+func (s *authService) refresh(ctx context.Context, clientID, refreshToken string, lifetimes TokenLifetimes) (*models.TokenPair, error) {
 	// Validate refresh token structure and signature
 	claims, err := s.jwtService.ValidateRefreshToken(refreshToken)
 	if err != nil {
-		return nil, fmt.Errorf("invalid refresh token: %w", err)
+		return nil, fmt.Errorf("%w: %v", utils.ErrInvalidToken, err)
 	}
 
 	// Type assertion for userID with proper error handling
 	userID, ok := claims["sub"].(string)
 	if !ok || userID == "" {
-		return nil, errors.New("invalid user ID in token claims")
+		return nil, utils.ErrInvalidToken
+	}
+
+	// Sessions can only be refreshed by whoever they were issued to
+	if tokenClientID, _ := claims["client_id"].(string); tokenClientID != clientID {
+		return nil, utils.ErrInvalidToken.WithMessage("refresh token was issued to another client")
 	}
 
+	scope, _ := claims["scope"].(string)
+	sess := session{userID: userID, clientID: clientID, scope: scope, lifetimes: lifetimes}
+
 	// Verify refresh token exists in Redis and matches
-	storedToken, err := s.redisService.GetRefreshToken(ctx, userID)
+	storedToken, err := s.redisService.GetRefreshToken(ctx, sess.key())
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			return nil, errors.New("refresh token not found or expired")
+			return nil, utils.ErrInvalidToken.WithMessage("refresh token not found or expired")
 		}
 		return nil, fmt.Errorf("failed to verify refresh token: %w", err)
 	}
 
 	if storedToken != refreshToken {
 		// Potential security issue - log this event
-		s.redisService.DeleteRefreshToken(ctx, userID) // Invalidate compromised token
-		return nil, errors.New("refresh token mismatch - possible token reuse")
+		s.redisService.DeleteRefreshToken(ctx, sess.key()) // Invalidate compromised token
+		return nil, utils.ErrTokenReused
 	}
 
-	// Generate new tokens
-	newAccessToken, err := s.jwtService.GenerateAccessToken(userID)
+	// Deactivated or deleted users can't extend their session
+	user, err := s.userRepo.FindByID(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if user == nil || !user.Active {
+		s.redisService.DeleteRefreshToken(ctx, sess.key())
+		return nil, utils.ErrAccountDisabled
 	}
 
-	newRefreshToken, err := s.jwtService.GenerateRefreshToken(userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	// Keep the active organization unless the membership has been revoked
+	sess.orgID, _ = claims["org_id"].(string)
+	if sess.orgID != "" {
+		if _, _, err := s.orgService.GetMemberAuthorization(sess.orgID, userID); err != nil {
+			sess.orgID = ""
+		}
 	}
 
-	// Atomic operation: Delete old and store new refresh token
-	err = s.redisService.StoreRefreshToken(ctx, userID, newRefreshToken, s.jwtService.GetRefreshExpiry())
+	// Generate new tokens with the user's current roles
+	authTime, _ := claims["auth_time"].(float64)
+	sess.authTime = int64(authTime)
+	sess.amr = claimStrings(claims, "amr")
+	tokens, err := s.issueTokens(ctx, sess)
 	if err != nil {
-		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+		return nil, err
 	}
 
 	// Invalidate the old refresh token (optional additional security)
@@ -162,42 +292,369 @@ func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*m
 		log.Printf("WARNING: failed to blacklist old refresh token: %v", err)
 	}
 
-	return &models.TokenPair{
-		AccessToken:  newAccessToken,
-		RefreshToken: newRefreshToken,
-	}, nil
+	return tokens, nil
 }
 
-func (s *authService) Logout(userID, accessToken string) error {
+// SwitchOrganization re-issues the user's tokens scoped to orgID. An empty
+// orgID returns to tokens without an active organization.
+func (s *authService) SwitchOrganization(ctx context.Context, userID, orgID string, authTime int64, amr []string) (*models.TokenPair, error) {
+	if orgID != "" {
+		if _, _, err := s.orgService.GetMemberAuthorization(orgID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.issueTokens(ctx, session{userID: userID, orgID: orgID, authTime: authTime, amr: amr})
+}
+
+func (s *authService) Reauthenticate(ctx context.Context, userID, orgID, password string) (*models.TokenPair, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.Active {
+		return nil, utils.ErrAccountDisabled
+	}
+	if user.Password == "" {
+		return nil, errNoPassword
+	}
+
+	if !utils.VerifyPassword(password, user.Password) {
+		s.auditService.Record(ctx, user.ID, models.AuditReauthenticationFailed, nil)
+		return nil, utils.ErrInvalidCredentials
+	}
+
+	// Keep the active organization unless the membership has been revoked
+	if orgID != "" {
+		if _, _, err := s.orgService.GetMemberAuthorization(orgID, userID); err != nil {
+			orgID = ""
+		}
+	}
+
+	tokens, err := s.issueTokens(ctx, session{userID: user.ID, orgID: orgID, authTime: time.Now().Unix(), amr: []string{AuthMethodPassword}})
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditService.Record(ctx, user.ID, models.AuditReauthenticated, nil)
+	return tokens, nil
+}
+
+func (s *authService) Logout(ctx context.Context, userID, accessToken string) error {
 	// Blacklist access token
-	err := s.redisService.BlacklistToken(context.Background(), accessToken, s.jwtService.GetAccessExpiry())
+	err := s.redisService.BlacklistToken(ctx, accessToken, s.jwtService.GetAccessExpiry())
 	if err != nil {
 		return err
 	}
 
 	// Delete refresh token
-	return s.redisService.DeleteRefreshToken(context.Background(), userID)
+	if err := s.redisService.DeleteRefreshToken(ctx, userID); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, userID, models.AuditLogout, nil)
+	return nil
 }
 
 func (s *authService) VerifyToken(token string) (string, error) {
-	// Check if token is blacklisted
-	blacklisted, err := s.redisService.IsTokenBlacklisted(context.Background(), token)
+	claims, err := s.ValidateAccessToken(context.Background(), token)
 	if err != nil {
 		return "", err
 	}
+
+	return claims["sub"].(string), nil
+}
+
+func (s *authService) ValidateAccessToken(ctx context.Context, token string) (jwt.MapClaims, error) {
+	// Check if token is blacklisted
+	blacklisted, err := s.redisService.IsTokenBlacklisted(ctx, token)
+	if err != nil {
+		return nil, err
+	}
 	if blacklisted {
-		return "", errors.New("token is invalidated")
+		return nil, utils.ErrTokenInvalidated
 	}
 
 	// Validate token
 	claims, err := s.jwtService.ValidateAccessToken(token)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("%w: %v", utils.ErrInvalidToken, err)
 	}
 
-	return claims["sub"].(string), nil
+	// Reject tokens issued before the user's sessions, or the client's
+	// session, were revoked, or before the client was deleted
+	sess := session{userID: claims["sub"].(string)}
+	sess.clientID, _ = claims["client_id"].(string)
+	keys := []string{sess.userID}
+	if sess.clientID != "" {
+		keys = append(keys, sess.key(), clientRevocationKey(sess.clientID))
+	}
+	iat, _ := claims["iat"].(float64)
+	for _, key := range keys {
+		watermark, err := s.redisService.GetRevocationWatermark(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if watermark > 0 && int64(iat) <= watermark {
+			return nil, utils.ErrTokenRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+func (s *authService) ValidateRefreshToken(ctx context.Context, token string) (jwt.MapClaims, error) {
+	blacklisted, err := s.redisService.IsTokenBlacklisted(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if blacklisted {
+		return nil, utils.ErrTokenInvalidated
+	}
+
+	claims, err := s.jwtService.ValidateRefreshToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.ErrInvalidToken, err)
+	}
+
+	sess := session{userID: claims["sub"].(string)}
+	sess.clientID, _ = claims["client_id"].(string)
+	storedToken, err := s.redisService.GetRefreshToken(ctx, sess.key())
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, utils.ErrInvalidToken.WithMessage("refresh token not found or expired")
+		}
+		return nil, fmt.Errorf("failed to verify refresh token: %w", err)
+	}
+	if storedToken != token {
+		return nil, utils.ErrInvalidToken.WithMessage("refresh token has been replaced")
+	}
+
+	return claims, nil
+}
+
+func (s *authService) IssueClientTokens(ctx context.Context, userID, clientID, scope string, authTime int64, amr []string, lifetimes TokenLifetimes) (*models.TokenPair, error) {
+	return s.issueTokens(ctx, session{
+		userID:    userID,
+		clientID:  clientID,
+		scope:     scope,
+		authTime:  authTime,
+		amr:       amr,
+		lifetimes: lifetimes,
+	})
+}
+
+// RevokeSessions deletes the refresh tokens and sets a revocation watermark,
+// so access tokens issued until now stop working immediately. iat only has
+// one-second resolution, so tokens issued later within the same second are
+// rejected as well.
+func (s *authService) RevokeSessions(ctx context.Context, userID string) error {
+	if err := s.redisService.DeleteRefreshToken(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.redisService.DeleteClientRefreshTokens(ctx, userID); err != nil {
+		return err
+	}
+	return s.redisService.SetRevocationWatermark(ctx, userID, time.Now(), s.jwtService.GetAccessExpiry())
+}
+
+func (s *authService) RevokeClientSession(ctx context.Context, userID, clientID string) error {
+	sess := session{userID: userID, clientID: clientID}
+	if err := s.redisService.DeleteRefreshToken(ctx, sess.key()); err != nil {
+		return err
+	}
+	return s.redisService.SetRevocationWatermark(ctx, sess.key(), time.Now(), s.jwtService.GetAccessExpiry())
 }
 
 func (s *authService) GetUser(userID string) (*models.User, error) {
 	return s.userRepo.FindByID(userID)
 }
+
+// Authentication methods (RFC 8176) recorded in the amr claim of a session.
+const (
+	AuthMethodPassword  = "pwd"
+	AuthMethodFederated = "fed"
+)
+
+// session describes what a token pair is issued for.
+type session struct {
+	userID string
+	orgID  string
+	// clientID and scope are set for sessions of OAuth clients.
+	clientID string
+	scope    string
+	// authTime is when the user last entered their password or signed in
+	// at an identity provider, as a unix timestamp, and amr how they did.
+	authTime  int64
+	amr       []string
+	lifetimes TokenLifetimes
+}
+
+// key identifies the session's refresh token in Redis.
+func (s session) key() string {
+	if s.clientID == "" {
+		return s.userID
+	}
+	return s.userID + ":" + s.clientID
+}
+
+// clientRevocationKey identifies the revocation watermark of every token
+// issued to an OAuth client, which is set when the client is deleted.
+func clientRevocationKey(clientID string) string {
+	return "client:" + clientID
+}
+
+// issueTokens generates a new token pair for the session and stores the
+// refresh token.
+func (s *authService) issueTokens(ctx context.Context, sess session) (*models.TokenPair, error) {
+	// Tokens of OAuth clients only carry the scope the user granted, never
+	// the user's own roles and permissions
+	accessClaims := jwt.MapClaims{}
+	if sess.clientID == "" {
+		var err error
+		accessClaims, err = s.accessTokenClaims(sess.userID, sess.orgID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load user roles: %w", err)
+		}
+	}
+	accessClaims["auth_time"] = sess.authTime
+
+	refreshClaims := jwt.MapClaims{"auth_time": sess.authTime}
+	if len(sess.amr) > 0 {
+		accessClaims["amr"] = sess.amr
+		refreshClaims["amr"] = sess.amr
+	}
+	if sess.orgID != "" {
+		refreshClaims["org_id"] = sess.orgID
+	}
+	if sess.clientID != "" {
+		accessClaims["client_id"] = sess.clientID
+		refreshClaims["client_id"] = sess.clientID
+	}
+	if sess.scope != "" {
+		accessClaims["scope"] = sess.scope
+		refreshClaims["scope"] = sess.scope
+	}
+
+	accessToken, err := s.jwtService.GenerateAccessToken(sess.userID, sess.lifetimes.Access, accessClaims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	refreshToken, err := s.jwtService.GenerateRefreshToken(sess.userID, sess.lifetimes.Refresh, refreshClaims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	// Replaces any previous refresh token of the session
+	refreshExpiry := sess.lifetimes.Refresh
+	if refreshExpiry <= 0 {
+		refreshExpiry = s.jwtService.GetRefreshExpiry()
+	}
+	err = s.redisService.StoreRefreshToken(ctx, sess.key(), refreshToken, refreshExpiry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// accessTokenClaims builds the authorization claims embedded in access tokens.
+func (s *authService) accessTokenClaims(userID, orgID string) (jwt.MapClaims, error) {
+	roles, permissions, err := s.rbacService.GetUserAuthorization(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{
+		"roles":       roles,
+		"permissions": permissions,
+	}
+
+	if orgID != "" {
+		orgRoles, orgPermissions, err := s.orgService.GetMemberAuthorization(orgID, userID)
+		if err != nil {
+			return nil, err
+		}
+		claims["org_id"] = orgID
+		claims["org_roles"] = orgRoles
+		claims["org_permissions"] = orgPermissions
+	}
+
+	if len(s.profileClaims) > 0 {
+		user, err := s.userRepo.FindByID(userID)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			for name, value := range ProfileClaims(user, s.profileClaims) {
+				claims[name] = value
+			}
+		}
+	}
+
+	return claims, nil
+}
+
+// profileClaimValues maps the standard OpenID Connect claim names to the
+// user's profile fields.
+var profileClaimValues = map[string]func(*models.User) string{
+	"email":       func(u *models.User) string { return u.Email },
+	"name":        func(u *models.User) string { return u.DisplayName },
+	"given_name":  func(u *models.User) string { return u.GivenName },
+	"family_name": func(u *models.User) string { return u.FamilyName },
+	"preferred_username": func(u *models.User) string {
+		if u.Username == nil {
+			return ""
+		}
+		return *u.Username
+	},
+	"locale":   func(u *models.User) string { return u.Locale },
+	"zoneinfo": func(u *models.User) string { return u.Timezone },
+	"picture":  func(u *models.User) string { return u.AvatarURL },
+}
+
+// ProfileClaims returns the requested profile claims that are set for the
+// user. Unknown names and empty fields are skipped.
+func ProfileClaims(user *models.User, names []string) jwt.MapClaims {
+	claims := jwt.MapClaims{}
+	for _, name := range names {
+		value, ok := profileClaimValues[name]
+		if !ok {
+			continue
+		}
+		if v := value(user); v != "" {
+			claims[name] = v
+		}
+	}
+	return claims
+}
+
+func (s *authService) upgradePasswordHash(user *models.User, password string) {
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		log.Printf("WARNING: failed to rehash password for user %s: %v", user.ID, err)
+		return
+	}
+
+	user.Password = hashedPassword
+	if err := s.userRepo.Update(user); err != nil {
+		// The old hash still verifies, so the upgrade is retried on next login
+		log.Printf("WARNING: failed to store upgraded password hash for user %s: %v", user.ID, err)
+	}
+}
+
+// claimStrings reads a string list claim, such as amr.
+func claimStrings(claims jwt.MapClaims, key string) []string {
+	raw, _ := claims[key].([]interface{})
+	var values []string
+	for _, v := range raw {
+		if s, ok := v.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
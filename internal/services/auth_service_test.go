@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+func TestIssueTokensKeepsUserAuthorizationOutOfClientTokens(t *testing.T) {
+	jwtService := NewJWTService("test-secret", time.Minute, time.Hour)
+	s := &authService{
+		jwtService:   jwtService,
+		redisService: newMemoryRedis(),
+		rbacService:  &fixedRBAC{roles: []string{"admin"}, permissions: []string{PermUsersWrite}},
+	}
+
+	tests := []struct {
+		name      string
+		sess      session
+		wantRoles bool
+	}{
+		{"own session", session{userID: "user-1"}, true},
+		{"client session", session{userID: "user-1", clientID: "client-1", scope: "openid"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := s.issueTokens(context.Background(), tt.sess)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := jwtService.ValidateAccessToken(tokens.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"roles", "permissions"} {
+				if _, ok := claims[name]; ok != tt.wantRoles {
+					t.Errorf("%s present = %v, want %v", name, ok, tt.wantRoles)
+				}
+			}
+		})
+	}
+}
+
+func TestReauthenticateWithoutPassword(t *testing.T) {
+	users := newMemoryUsers(&models.User{ID: "user-1", Active: true})
+	s := &authService{
+		userRepo:     users,
+		jwtService:   NewJWTService("test-secret", time.Minute, time.Hour),
+		redisService: newMemoryRedis(),
+		auditService: discardAudit{},
+	}
+
+	// An empty password never matches an empty hash
+	_, err := s.Reauthenticate(context.Background(), "user-1", "", "")
+	if !errors.Is(err, utils.ErrReauthenticationRequired) {
+		t.Errorf("err = %v, want %v", err, utils.ErrReauthenticationRequired)
+	}
+}
+
+func TestRefreshKeepsAuthenticationMethods(t *testing.T) {
+	jwtService := NewJWTService("test-secret", time.Minute, time.Hour)
+	s := &authService{
+		userRepo:     newMemoryUsers(&models.User{ID: "user-1", Active: true}),
+		jwtService:   jwtService,
+		redisService: newMemoryRedis(),
+		rbacService:  &fixedRBAC{},
+	}
+
+	tokens, err := s.issueTokens(context.Background(), session{userID: "user-1", authTime: 1700000000, amr: []string{AuthMethodFederated}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err = s.RefreshToken(context.Background(), tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := jwtService.ValidateAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["auth_time"] != float64(1700000000) || !reflect.DeepEqual(claimStrings(claims, "amr"), []string{AuthMethodFederated}) {
+		t.Errorf("auth_time = %v, amr = %v after refreshing", claims["auth_time"], claims["amr"])
+	}
+}
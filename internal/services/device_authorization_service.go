@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+// GrantTypeDeviceCode is the grant type devices poll the token endpoint
+// with (RFC 8628).
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// User codes are typed in by hand: consonants only, so they can't spell
+// words, and no easily confused characters (RFC 8628 section 6.1).
+const (
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// slowDownIncrement is added to a device's polling interval each time it
+// polls too often.
+const slowDownIncrement = 5 * time.Second
+
+// DeviceAuthorizationService implements the device authorization grant for
+// devices that can't open a browser, like CLIs and TVs. The device shows a
+// user code, which the user enters on another device where they are signed
+// in, while the device polls the token endpoint.
+type DeviceAuthorizationService interface {
+	// Authorize starts a device authorization for the client authenticated
+	// by auth. Failures are utils.OAuthErrors.
+	Authorize(ctx context.Context, auth models.ClientAuthentication, req *models.DeviceAuthorizationRequest) (*models.DeviceAuthorizationResponse, error)
+	// Lookup returns the pending device authorization with the user code,
+	// so the user can check what they are approving.
+	Lookup(ctx context.Context, userCode string) (*models.DeviceVerification, error)
+	// Verify approves or denies a pending device authorization on behalf of
+	// the signed-in user. Approving it also records the user's consent.
+	Verify(ctx context.Context, userID string, authTime int64, amr []string, req *models.DeviceVerificationRequest) error
+	// Redeem is called when the client polls the token endpoint. It returns
+	// the device code once the user has approved it; after that the code
+	// can't be used again. Failures are utils.OAuthErrors.
+	Redeem(ctx context.Context, client *models.OAuthClient, deviceCode string) (*models.DeviceCode, error)
+}
+
+type deviceAuthorizationService struct {
+	clientService  OAuthClientService
+	consentService OAuthConsentService
+	redisService   RedisService
+	auditService   AuditService
+	// verificationURL is the frontend page where users enter user codes.
+	verificationURL string
+	expiry          time.Duration
+	interval        time.Duration
+}
+
+func NewDeviceAuthorizationService(
+	clientService OAuthClientService,
+	consentService OAuthConsentService,
+	redisService RedisService,
+	auditService AuditService,
+	verificationURL string,
+	expiry, interval time.Duration,
+) DeviceAuthorizationService {
+	return &deviceAuthorizationService{
+		clientService:   clientService,
+		consentService:  consentService,
+		redisService:    redisService,
+		auditService:    auditService,
+		verificationURL: verificationURL,
+		expiry:          expiry,
+		interval:        interval,
+	}
+}
+
+func (s *deviceAuthorizationService) Authorize(ctx context.Context, auth models.ClientAuthentication, req *models.DeviceAuthorizationRequest) (*models.DeviceAuthorizationResponse, error) {
+	client, err := s.clientService.AuthenticateClient(ctx, auth)
+	if err != nil {
+		return nil, err
+	}
+	if !client.GrantTypes.Contains(GrantTypeDeviceCode) {
+		return nil, utils.ErrOAuthUnauthorizedClient
+	}
+	scope := normalizeScope(req.Scope)
+	for _, requested := range strings.Fields(scope) {
+		if !client.Scopes.Contains(requested) {
+			return nil, utils.ErrOAuthInvalidScope.WithDescription("scope " + requested + " is not allowed for this client")
+		}
+	}
+
+	deviceCode, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.Marshal(models.DeviceCode{
+		ClientID: client.ClientID,
+		Scope:    scope,
+		UserCode: userCode,
+		Status:   models.DeviceCodePending,
+		Interval: int64(s.interval.Seconds()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.redisService.StoreDeviceCode(ctx, deviceCode, userCode, string(value), s.expiry); err != nil {
+		return nil, fmt.Errorf("failed to store device code: %w", err)
+	}
+
+	displayCode := formatUserCode(userCode)
+	return &models.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                displayCode,
+		VerificationURI:         s.verificationURL,
+		VerificationURIComplete: redirectWithParams(s.verificationURL, url.Values{"user_code": {displayCode}}),
+		ExpiresIn:               int64(s.expiry.Seconds()),
+		Interval:                int64(s.interval.Seconds()),
+	}, nil
+}
+
+func (s *deviceAuthorizationService) Lookup(ctx context.Context, userCode string) (*models.DeviceVerification, error) {
+	_, code, err := s.findPending(ctx, userCode)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.clientService.GetClient(code.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.DeviceVerification{
+		UserCode:   formatUserCode(code.UserCode),
+		ClientID:   client.ClientID,
+		ClientName: client.Name,
+		LogoURL:    client.LogoURL,
+		Scope:      code.Scope,
+	}, nil
+}
+
+func (s *deviceAuthorizationService) Verify(ctx context.Context, userID string, authTime int64, amr []string, req *models.DeviceVerificationRequest) error {
+	deviceCode, code, err := s.findPending(ctx, req.UserCode)
+	if err != nil {
+		return err
+	}
+
+	if req.Approve {
+		if err := s.consentService.Grant(userID, code.ClientID, code.Scope); err != nil {
+			return err
+		}
+		code.Status = models.DeviceCodeApproved
+		code.UserID = userID
+		code.AuthTime = authTime
+		code.AMR = amr
+	} else {
+		code.Status = models.DeviceCodeDenied
+	}
+	value, err := json.Marshal(code)
+	if err != nil {
+		return err
+	}
+	if err := s.redisService.UpdateDeviceCode(ctx, deviceCode, string(value)); err != nil {
+		return fmt.Errorf("failed to update device code: %w", err)
+	}
+
+	if req.Approve {
+		s.auditService.Record(ctx, userID, models.AuditOAuthAuthorized, models.JSONMap{
+			"client_id":  code.ClientID,
+			"scope":      code.Scope,
+			"grant_type": GrantTypeDeviceCode,
+		})
+	}
+	return nil
+}
+
+// findPending returns the device code for a user code that hasn't been
+// answered yet.
+func (s *deviceAuthorizationService) findPending(ctx context.Context, userCode string) (string, *models.DeviceCode, error) {
+	invalid := utils.ErrNotFound.WithMessage("invalid or expired user code")
+
+	deviceCode, err := s.redisService.FindDeviceCode(ctx, normalizeUserCode(userCode))
+	if err != nil {
+		return "", nil, err
+	}
+	if deviceCode == "" {
+		return "", nil, invalid
+	}
+	code, err := s.getDeviceCode(ctx, deviceCode)
+	if err != nil {
+		return "", nil, err
+	}
+	if code == nil {
+		return "", nil, invalid
+	}
+	if code.Status != models.DeviceCodePending {
+		return "", nil, utils.ErrConflict.WithMessage("device authorization has already been answered")
+	}
+	return deviceCode, code, nil
+}
+
+func (s *deviceAuthorizationService) Redeem(ctx context.Context, client *models.OAuthClient, deviceCode string) (*models.DeviceCode, error) {
+	if deviceCode == "" {
+		return nil, utils.ErrOAuthInvalidRequest.WithDescription("device_code is required")
+	}
+
+	code, err := s.getDeviceCode(ctx, deviceCode)
+	if err != nil {
+		return nil, err
+	}
+	if code == nil {
+		return nil, utils.ErrOAuthExpiredToken.WithDescription("device code is invalid or has expired")
+	}
+	if code.ClientID != client.ClientID {
+		return nil, utils.ErrOAuthInvalidGrant.WithDescription("device code was issued to another client")
+	}
+
+	// Devices that poll too often have to wait longer from then on
+	interval := time.Duration(code.Interval) * time.Second
+	firstPoll, err := s.redisService.MarkDeviceCodePolled(ctx, deviceCode, interval)
+	if err != nil {
+		return nil, err
+	}
+	if !firstPoll {
+		code.Interval += int64(slowDownIncrement.Seconds())
+		value, err := json.Marshal(code)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.redisService.UpdateDeviceCode(ctx, deviceCode, string(value)); err != nil {
+			return nil, fmt.Errorf("failed to update device code: %w", err)
+		}
+		return nil, utils.ErrOAuthSlowDown
+	}
+
+	switch code.Status {
+	case models.DeviceCodePending:
+		return nil, utils.ErrOAuthAuthorizationPending
+	case models.DeviceCodeDenied:
+		s.redisService.ConsumeDeviceCode(ctx, deviceCode)
+		return nil, utils.ErrOAuthAccessDenied.WithDescription("the user denied the authorization request")
+	}
+
+	// Consuming the code makes sure only one poll gets the tokens
+	value, err := s.redisService.ConsumeDeviceCode(ctx, deviceCode)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, utils.ErrOAuthExpiredToken.WithDescription("device code is invalid or has expired")
+	}
+	return code, nil
+}
+
+// getDeviceCode loads a device code. It returns nil if the code doesn't
+// exist.
+func (s *deviceAuthorizationService) getDeviceCode(ctx context.Context, deviceCode string) (*models.DeviceCode, error) {
+	value, err := s.redisService.GetDeviceCode(ctx, deviceCode)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	var code models.DeviceCode
+	if err := json.Unmarshal([]byte(value), &code); err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func generateUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// formatUserCode splits a user code in two halves for readability.
+func formatUserCode(code string) string {
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// normalizeUserCode undoes formatUserCode and forgives the case and
+// separators users type.
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
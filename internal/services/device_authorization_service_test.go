@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+// fixedClient is an OAuthClientService that authenticates every request as
+// the same client.
+type fixedClient struct {
+	OAuthClientService
+	client *models.OAuthClient
+}
+
+func (c *fixedClient) AuthenticateClient(ctx context.Context, auth models.ClientAuthentication) (*models.OAuthClient, error) {
+	return c.client, nil
+}
+
+func (c *fixedClient) GetClient(clientID string) (*models.OAuthClient, error) {
+	if clientID != c.client.ClientID {
+		return nil, utils.ErrNotFound
+	}
+	return c.client, nil
+}
+
+// recordedConsents is an OAuthConsentService that remembers what was
+// granted.
+type recordedConsents struct {
+	OAuthConsentService
+	granted []string
+}
+
+func (c *recordedConsents) Grant(userID, clientID, scope string) error {
+	c.granted = append(c.granted, userID+" "+clientID+" "+scope)
+	return nil
+}
+
+var deviceClient = &models.OAuthClient{
+	ClientID:   "tv-app",
+	Name:       "TV app",
+	GrantTypes: models.StringList{GrantTypeDeviceCode},
+	Scopes:     models.StringList{"openid", "profile"},
+}
+
+func newTestDeviceService() (*deviceAuthorizationService, *memoryRedis, *recordedConsents) {
+	redisService := newMemoryRedis()
+	consents := &recordedConsents{}
+	s := NewDeviceAuthorizationService(
+		&fixedClient{client: deviceClient}, consents, redisService, discardAudit{},
+		"https://app.example.com/device", 10*time.Minute, 5*time.Second,
+	)
+	return s.(*deviceAuthorizationService), redisService, consents
+}
+
+// startDeviceAuthorization starts a device authorization for deviceClient.
+func startDeviceAuthorization(t *testing.T, s *deviceAuthorizationService) *models.DeviceAuthorizationResponse {
+	t.Helper()
+	resp, err := s.Authorize(context.Background(), models.ClientAuthentication{}, &models.DeviceAuthorizationRequest{Scope: "profile openid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestDeviceAuthorize(t *testing.T) {
+	s, _, _ := newTestDeviceService()
+	resp := startDeviceAuthorization(t, s)
+
+	if !regexp.MustCompile(`^[BCDFGHJKLMNPQRSTVWXZ]{4}-[BCDFGHJKLMNPQRSTVWXZ]{4}$`).MatchString(resp.UserCode) {
+		t.Errorf("user code %q has the wrong format", resp.UserCode)
+	}
+	if resp.VerificationURIComplete != "https://app.example.com/device?user_code="+resp.UserCode {
+		t.Errorf("verification_uri_complete = %q", resp.VerificationURIComplete)
+	}
+	if resp.ExpiresIn != 600 || resp.Interval != 5 {
+		t.Errorf("expires_in = %d, interval = %d", resp.ExpiresIn, resp.Interval)
+	}
+
+	_, err := s.Authorize(context.Background(), models.ClientAuthentication{}, &models.DeviceAuthorizationRequest{Scope: "admin"})
+	if !errors.Is(err, utils.ErrOAuthInvalidScope) {
+		t.Errorf("disallowed scope: err = %v, want invalid_scope", err)
+	}
+
+	s.clientService = &fixedClient{client: &models.OAuthClient{ClientID: "web-app", GrantTypes: models.StringList{"authorization_code"}}}
+	_, err = s.Authorize(context.Background(), models.ClientAuthentication{}, &models.DeviceAuthorizationRequest{})
+	if !errors.Is(err, utils.ErrOAuthUnauthorizedClient) {
+		t.Errorf("client without the grant type: err = %v, want unauthorized_client", err)
+	}
+}
+
+func TestDeviceCodeApproved(t *testing.T) {
+	ctx := context.Background()
+	s, redisService, consents := newTestDeviceService()
+	resp := startDeviceAuthorization(t, s)
+
+	if _, err := s.Redeem(ctx, deviceClient, resp.DeviceCode); !errors.Is(err, utils.ErrOAuthAuthorizationPending) {
+		t.Fatalf("first poll: err = %v, want authorization_pending", err)
+	}
+	if _, err := s.Redeem(ctx, deviceClient, resp.DeviceCode); !errors.Is(err, utils.ErrOAuthSlowDown) {
+		t.Fatalf("early poll: err = %v, want slow_down", err)
+	}
+	code, err := s.getDeviceCode(ctx, resp.DeviceCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.Interval != 10 {
+		t.Errorf("interval after slow_down = %d, want 10", code.Interval)
+	}
+
+	// Users may type the code in lowercase and without the dash
+	typed := strings.ToLower(" " + resp.UserCode[:4] + resp.UserCode[5:])
+	verification, err := s.Lookup(ctx, typed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.ClientName != "TV app" || verification.Scope != "profile openid" || verification.UserCode != resp.UserCode {
+		t.Errorf("unexpected verification %+v", verification)
+	}
+	err = s.Verify(ctx, "user-1", 1700000000, []string{AuthMethodPassword}, &models.DeviceVerificationRequest{UserCode: typed, Approve: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(consents.granted) != 1 || consents.granted[0] != "user-1 tv-app profile openid" {
+		t.Errorf("granted consents = %q", consents.granted)
+	}
+	err = s.Verify(ctx, "user-2", 1700000000, []string{AuthMethodPassword}, &models.DeviceVerificationRequest{UserCode: resp.UserCode, Approve: true})
+	if !errors.Is(err, utils.ErrConflict) {
+		t.Errorf("second answer: err = %v, want conflict", err)
+	}
+
+	redisService.forgetPoll(resp.DeviceCode)
+	code, err = s.Redeem(ctx, deviceClient, resp.DeviceCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.UserID != "user-1" || code.AuthTime != 1700000000 || !reflect.DeepEqual(code.AMR, []string{AuthMethodPassword}) || code.Scope != "profile openid" {
+		t.Errorf("unexpected device code %+v", code)
+	}
+
+	redisService.forgetPoll(resp.DeviceCode)
+	if _, err := s.Redeem(ctx, deviceClient, resp.DeviceCode); !errors.Is(err, utils.ErrOAuthExpiredToken) {
+		t.Errorf("second redemption: err = %v, want expired_token", err)
+	}
+}
+
+func TestDeviceCodeDenied(t *testing.T) {
+	ctx := context.Background()
+	s, redisService, consents := newTestDeviceService()
+	resp := startDeviceAuthorization(t, s)
+
+	err := s.Verify(ctx, "user-1", 1700000000, []string{AuthMethodPassword}, &models.DeviceVerificationRequest{UserCode: resp.UserCode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(consents.granted) != 0 {
+		t.Errorf("denying granted consents %q", consents.granted)
+	}
+
+	if _, err := s.Redeem(ctx, deviceClient, resp.DeviceCode); !errors.Is(err, utils.ErrOAuthAccessDenied) {
+		t.Fatalf("err = %v, want access_denied", err)
+	}
+	redisService.forgetPoll(resp.DeviceCode)
+	if _, err := s.Redeem(ctx, deviceClient, resp.DeviceCode); !errors.Is(err, utils.ErrOAuthExpiredToken) {
+		t.Errorf("poll after denial: err = %v, want expired_token", err)
+	}
+}
+
+func TestDeviceCodeOfAnotherClient(t *testing.T) {
+	s, _, _ := newTestDeviceService()
+	resp := startDeviceAuthorization(t, s)
+
+	other := &models.OAuthClient{ClientID: "other-app"}
+	if _, err := s.Redeem(context.Background(), other, resp.DeviceCode); !errors.Is(err, utils.ErrOAuthInvalidGrant) {
+		t.Errorf("err = %v, want invalid_grant", err)
+	}
+	if _, err := s.Redeem(context.Background(), deviceClient, "unknown"); !errors.Is(err, utils.ErrOAuthExpiredToken) {
+		t.Errorf("unknown device code: err = %v, want expired_token", err)
+	}
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+const (
+	emailChangeConfirmPurpose = "email_change_confirm"
+	emailChangeCancelPurpose  = "email_change_cancel"
+)
+
+type EmailChangeService interface {
+	// RequestChange emails a confirmation link to newEmail and a cancel link
+	// to the current address. It replaces any earlier pending change.
+	RequestChange(ctx context.Context, userID, newEmail string) error
+	// Confirm swaps the user's email to the pending address.
+	Confirm(ctx context.Context, token string) (*models.User, error)
+	// Cancel discards the pending change and signs the user out everywhere,
+	// since an unexpected change suggests the account is compromised.
+	Cancel(ctx context.Context, token string) error
+}
+
+// pendingEmailChange is stored in Redis until the change is confirmed,
+// cancelled or expires. ID ties the emailed links to this request so links
+// from a replaced request stop working.
+type pendingEmailChange struct {
+	ID       string `json:"id"`
+	OldEmail string `json:"old_email"`
+	NewEmail string `json:"new_email"`
+}
+
+type emailChangeService struct {
+	userRepo     repositories.UserRepository
+	authService  AuthService
+	jwtService   JWTService
+	redisService RedisService
+	emailService EmailService
+	auditService AuditService
+	emails       utils.EmailNormalizer
+	expiry       time.Duration
+}
+
+func NewEmailChangeService(
+	userRepo repositories.UserRepository,
+	authService AuthService,
+	jwtService JWTService,
+	redisService RedisService,
+	emailService EmailService,
+	auditService AuditService,
+	emails utils.EmailNormalizer,
+	expiry time.Duration,
+) EmailChangeService {
+	return &emailChangeService{
+		userRepo:     userRepo,
+		authService:  authService,
+		jwtService:   jwtService,
+		redisService: redisService,
+		emailService: emailService,
+		auditService: auditService,
+		emails:       emails,
+		expiry:       expiry,
+	}
+}
+
+func (s *emailChangeService) RequestChange(ctx context.Context, userID, newEmail string) error {
+	newEmail = s.emails.Normalize(newEmail)
+	if err := utils.ValidateEmail(newEmail); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return utils.ErrUserNotFound
+	}
+	if newEmail == user.Email {
+		return utils.ErrInvalidInput.WithMessage("new email must be different from the current one")
+	}
+
+	// Checked again on confirmation, this just fails early
+	existingUser, err := s.userRepo.FindByEmailUnscoped(newEmail)
+	if err != nil {
+		return err
+	}
+	if existingUser != nil {
+		return utils.ErrEmailInUse
+	}
+
+	id, err := randomID()
+	if err != nil {
+		return err
+	}
+	pending, err := json.Marshal(pendingEmailChange{ID: id, OldEmail: user.Email, NewEmail: newEmail})
+	if err != nil {
+		return err
+	}
+	if err := s.redisService.StorePendingEmailChange(ctx, user.ID, string(pending), s.expiry); err != nil {
+		return err
+	}
+
+	confirmToken, err := s.jwtService.GenerateActionToken(user.ID, emailChangeConfirmPurpose, s.expiry, jwt.MapClaims{"cid": id})
+	if err != nil {
+		return err
+	}
+	cancelToken, err := s.jwtService.GenerateActionToken(user.ID, emailChangeCancelPurpose, s.expiry, jwt.MapClaims{"cid": id})
+	if err != nil {
+		return err
+	}
+
+	confirmBody := fmt.Sprintf(
+		"Confirm this address for your account:\n%s\n\nThis link expires in %s.",
+		s.emailService.LinkURL("/email/confirm", confirmToken), s.expiry,
+	)
+	if err := s.emailService.Send(newEmail, "Confirm your new email address", confirmBody); err != nil {
+		return fmt.Errorf("failed to send confirmation email: %w", err)
+	}
+
+	noticeBody := fmt.Sprintf(
+		"A request was made to change your account email to %s.\n\n"+
+			"If this wasn't you, cancel the change and sign out of all sessions:\n%s",
+		newEmail, s.emailService.LinkURL("/email/cancel", cancelToken),
+	)
+	if err := s.emailService.Send(user.Email, "Your email address is being changed", noticeBody); err != nil {
+		return fmt.Errorf("failed to send notice email: %w", err)
+	}
+
+	s.auditService.Record(ctx, user.ID, models.AuditEmailChangeRequested, models.JSONMap{"new_email": newEmail})
+	return nil
+}
+
+func (s *emailChangeService) Confirm(ctx context.Context, token string) (*models.User, error) {
+	userID, pending, err := s.pendingChange(ctx, token, emailChangeConfirmPurpose)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	// The email changed some other way since the request was made
+	if user == nil || user.Email != pending.OldEmail {
+		s.discard(ctx, userID)
+		return nil, utils.ErrInvalidLink
+	}
+
+	existingUser, err := s.userRepo.FindByEmailUnscoped(pending.NewEmail)
+	if err != nil {
+		return nil, err
+	}
+	if existingUser != nil {
+		s.discard(ctx, userID)
+		return nil, utils.ErrEmailInUse
+	}
+
+	user.Email = pending.NewEmail
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+	s.discard(ctx, userID)
+
+	s.auditService.Record(ctx, user.ID, models.AuditEmailChanged, models.JSONMap{
+		"old_email": pending.OldEmail,
+		"new_email": pending.NewEmail,
+	})
+	return user, nil
+}
+
+func (s *emailChangeService) Cancel(ctx context.Context, token string) error {
+	userID, pending, err := s.pendingChange(ctx, token, emailChangeCancelPurpose)
+	if err != nil {
+		return err
+	}
+
+	if err := s.redisService.DeletePendingEmailChange(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.authService.RevokeSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, userID, models.AuditEmailChangeCancelled, models.JSONMap{"new_email": pending.NewEmail})
+	return nil
+}
+
+// pendingChange validates a confirm or cancel link against the change
+// currently pending for its user.
+func (s *emailChangeService) pendingChange(ctx context.Context, token, purpose string) (string, *pendingEmailChange, error) {
+	claims, err := s.jwtService.ValidateActionToken(token, purpose)
+	if err != nil {
+		return "", nil, utils.ErrInvalidLink
+	}
+	userID, ok := claims["sub"].(string)
+	if !ok {
+		return "", nil, utils.ErrInvalidLink
+	}
+
+	raw, err := s.redisService.GetPendingEmailChange(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if raw == "" {
+		return "", nil, utils.ErrInvalidLink
+	}
+
+	var pending pendingEmailChange
+	if err := json.Unmarshal([]byte(raw), &pending); err != nil {
+		return "", nil, err
+	}
+	if cid, _ := claims["cid"].(string); cid != pending.ID {
+		return "", nil, utils.ErrInvalidLink
+	}
+	return userID, &pending, nil
+}
+
+func (s *emailChangeService) discard(ctx context.Context, userID string) {
+	if err := s.redisService.DeletePendingEmailChange(ctx, userID); err != nil {
+		log.Printf("WARNING: failed to delete pending email change for user %s: %v", userID, err)
+	}
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+// recordedLinks is an EmailService that keeps the tokens of the links it
+// builds, by path.
+type recordedLinks struct {
+	tokens map[string][]string
+}
+
+func (e *recordedLinks) Send(to, subject, body string) error {
+	return nil
+}
+
+func (e *recordedLinks) LinkURL(path, token string) string {
+	e.tokens[path] = append(e.tokens[path], token)
+	return "https://app.example.com" + path + "?token=" + token
+}
+
+func newTestEmailChangeService() (*emailChangeService, *authService, *recordedLinks) {
+	users := newMemoryUsers(&models.User{ID: "user-1", Email: "alice@example.com", Active: true})
+	redisService := newMemoryRedis()
+	jwtService := NewJWTService("test-secret", time.Minute, time.Hour)
+	auth := &authService{userRepo: users, jwtService: jwtService, redisService: redisService, rbacService: &fixedRBAC{}}
+	links := &recordedLinks{tokens: map[string][]string{}}
+	s := NewEmailChangeService(users, auth, jwtService, redisService, links, discardAudit{}, utils.EmailNormalizer{}, time.Hour)
+	return s.(*emailChangeService), auth, links
+}
+
+func TestConfirmRejectsReplacedRequest(t *testing.T) {
+	ctx := context.Background()
+	s, _, links := newTestEmailChangeService()
+
+	if err := s.RequestChange(ctx, "user-1", "first@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RequestChange(ctx, "user-1", "second@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	replaced, current := links.tokens["/email/confirm"][0], links.tokens["/email/confirm"][1]
+
+	if _, err := s.Confirm(ctx, replaced); !errors.Is(err, utils.ErrInvalidLink) {
+		t.Errorf("replaced confirm link: err = %v, want %v", err, utils.ErrInvalidLink)
+	}
+	if err := s.Cancel(ctx, links.tokens["/email/cancel"][0]); !errors.Is(err, utils.ErrInvalidLink) {
+		t.Errorf("replaced cancel link: err = %v, want %v", err, utils.ErrInvalidLink)
+	}
+
+	user, err := s.Confirm(ctx, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "second@example.com" {
+		t.Errorf("email = %q, want the address of the latest request", user.Email)
+	}
+	if _, err := s.Confirm(ctx, current); !errors.Is(err, utils.ErrInvalidLink) {
+		t.Errorf("second confirmation: err = %v, want %v", err, utils.ErrInvalidLink)
+	}
+}
+
+func TestConfirmRejectsLinksOfOtherPurposes(t *testing.T) {
+	ctx := context.Background()
+	s, _, links := newTestEmailChangeService()
+	if err := s.RequestChange(ctx, "user-1", "new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Confirm(ctx, links.tokens["/email/cancel"][0]); !errors.Is(err, utils.ErrInvalidLink) {
+		t.Errorf("cancel link: err = %v, want %v", err, utils.ErrInvalidLink)
+	}
+	if _, err := s.Confirm(ctx, "not-a-token"); !errors.Is(err, utils.ErrInvalidLink) {
+		t.Errorf("invalid token: err = %v, want %v", err, utils.ErrInvalidLink)
+	}
+}
+
+func TestCancelRevokesSessions(t *testing.T) {
+	ctx := context.Background()
+	s, auth, links := newTestEmailChangeService()
+	tokens, err := auth.issueTokens(ctx, session{userID: "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RequestChange(ctx, "user-1", "new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Cancel(ctx, links.tokens["/email/cancel"][0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := auth.ValidateAccessToken(ctx, tokens.AccessToken); !errors.Is(err, utils.ErrTokenRevoked) {
+		t.Errorf("access token: err = %v, want %v", err, utils.ErrTokenRevoked)
+	}
+	if _, err := auth.ValidateRefreshToken(ctx, tokens.RefreshToken); err == nil {
+		t.Error("refresh token still works")
+	}
+	if _, err := s.Confirm(ctx, links.tokens["/email/confirm"][0]); !errors.Is(err, utils.ErrInvalidLink) {
+		t.Errorf("confirming a cancelled change: err = %v, want %v", err, utils.ErrInvalidLink)
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type EmailService interface {
+	Send(to, subject, body string) error
+	// LinkURL builds an absolute link into the frontend, e.g.
+	// LinkURL("/invitations/accept", token).
+	LinkURL(path, token string) string
+}
+
+type smtpEmailService struct {
+	addr        string
+	auth        smtp.Auth
+	from        string
+	linkBaseURL string
+}
+
+func NewSMTPEmailService(host string, port int, username, password, from, linkBaseURL string) EmailService {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &smtpEmailService{
+		addr:        net.JoinHostPort(host, fmt.Sprint(port)),
+		auth:        auth,
+		from:        from,
+		linkBaseURL: strings.TrimRight(linkBaseURL, "/"),
+	}
+}
+
+func (s *smtpEmailService) Send(to, subject, body string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid email header value")
+	}
+
+	msg := strings.Join([]string{
+		"From: " + s.from,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{to}, []byte(msg))
+}
+
+func (s *smtpEmailService) LinkURL(path, token string) string {
+	return s.linkBaseURL + path + "?token=" + token
+}
+
+// logEmailService writes emails to the log instead of sending them. It is
+// used when no SMTP host is configured, e.g. in local development.
+type logEmailService struct {
+	linkBaseURL string
+}
+
+func NewLogEmailService(linkBaseURL string) EmailService {
+	return &logEmailService{linkBaseURL: strings.TrimRight(linkBaseURL, "/")}
+}
+
+func (s *logEmailService) Send(to, subject, body string) error {
+	log.Printf("EMAIL to=%s subject=%q\n%s", to, subject, body)
+	return nil
+}
+
+func (s *logEmailService) LinkURL(path, token string) string {
+	return s.linkBaseURL + path + "?token=" + token
+}
@@ -0,0 +1,796 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+const (
+	// loginStateExpiry is how long users have to sign in at the provider.
+	loginStateExpiry = 10 * time.Minute
+	// loginCodeExpiry is how long the frontend has to exchange a login code.
+	loginCodeExpiry = time.Minute
+	// keyRefreshInterval limits how often a provider's keys are fetched
+	// again when an ID token is signed with an unknown key.
+	keyRefreshInterval = time.Minute
+	// maxUpstreamResponseSize limits what is read from a provider.
+	maxUpstreamResponseSize = 1 << 20
+)
+
+// externalClaimFields are the user fields that can be mapped to a
+// provider's claims. By default each maps to the standard claim of the
+// same name.
+var externalClaimFields = []string{"email", "email_verified", "name", "given_name", "family_name", "picture", "locale"}
+
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// IdentityProviderConfig configures an upstream OpenID Connect provider
+// users can sign in with, such as Google, Microsoft, Okta or GitLab.
+type IdentityProviderConfig struct {
+	// Name identifies the provider in URLs and linked identities, so it
+	// can't change once users have signed in with it.
+	Name         string `json:"name"`
+	DisplayName  string `json:"display_name"`
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// Scopes defaults to openid, email and profile.
+	Scopes []string `json:"scopes"`
+	// Claims maps user fields (see externalClaimFields) to the provider's
+	// claim names, for providers that don't use the standard ones.
+	Claims map[string]string `json:"claims"`
+	// TrustEmail treats email addresses from the provider as verified when
+	// it doesn't send email_verified.
+	TrustEmail bool `json:"trust_email"`
+	// AutoLink links a first sign in to the existing account with the same
+	// email address, if the provider verified it. Whoever controls the
+	// address at the provider gets into the account, so only enable it for
+	// providers trusted to verify addresses.
+	AutoLink bool `json:"auto_link"`
+}
+
+// ExternalLoginService signs users in with upstream OpenID Connect
+// providers. The user is sent to the provider, which redirects back to the
+// callback with an authorization code. The callback redeems it, validates
+// the ID token and hands the frontend a short-lived login code, which it
+// exchanges for a session. Users who sign in for the first time get a new
+// account linked to their identity at the provider. Signed-in users can
+// also link their accounts at providers the same way.
+type ExternalLoginService interface {
+	Providers() []models.IdentityProvider
+	// Start returns the provider's authorization URL to send the user to.
+	Start(ctx context.Context, provider string) (string, error)
+	// StartLink is Start for linking the provider to the user's account.
+	StartLink(ctx context.Context, userID, provider string) (string, error)
+	// Callback completes the sign in at the provider and returns a login
+	// code, or "" if the sign in linked the provider to a user's account.
+	// Failures the user should be told about are utils.AppErrors.
+	Callback(ctx context.Context, provider string, req *models.ExternalLoginCallback) (string, error)
+	// Exchange starts a session for the user a login code was issued to.
+	// The code can't be used again.
+	Exchange(ctx context.Context, code string) (*models.TokenPair, error)
+	ListIdentities(userID string) ([]models.Identity, error)
+	// Unlink removes the user's identity at the provider. Users without a
+	// password can't unlink their last provider, since they couldn't sign
+	// in anymore.
+	Unlink(ctx context.Context, userID, provider string) error
+}
+
+type externalLoginService struct {
+	providers    map[string]*identityProvider
+	order        []string
+	identityRepo repositories.IdentityRepository
+	userRepo     repositories.UserRepository
+	authService  AuthService
+	redisService RedisService
+	auditService AuditService
+	emails       utils.EmailNormalizer
+	httpClient   *http.Client
+	// callbackURL is this server's redirect URI prefix registered at the
+	// providers, followed by "/<provider>/callback".
+	callbackURL string
+}
+
+// identityProvider is a configured provider and what was fetched from it.
+type identityProvider struct {
+	IdentityProviderConfig
+
+	mu            sync.Mutex
+	metadata      *models.OpenIDConfiguration
+	keys          *utils.JWKSet
+	keysFetchedAt time.Time
+}
+
+// loginState is kept while the user signs in at the provider. UserID is
+// set when the sign in links the provider to the user's account.
+type loginState struct {
+	Provider     string `json:"provider"`
+	UserID       string `json:"user_id,omitempty"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// loginCode is what a login code is exchanged for.
+type loginCode struct {
+	UserID   string `json:"user_id"`
+	Provider string `json:"provider"`
+}
+
+// externalProfile is what a provider tells about the user.
+type externalProfile struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	GivenName     string
+	FamilyName    string
+	Picture       string
+	Locale        string
+}
+
+func NewExternalLoginService(
+	providers []IdentityProviderConfig,
+	identityRepo repositories.IdentityRepository,
+	userRepo repositories.UserRepository,
+	authService AuthService,
+	redisService RedisService,
+	auditService AuditService,
+	emails utils.EmailNormalizer,
+	httpClient *http.Client,
+	issuer string,
+) (ExternalLoginService, error) {
+	s := &externalLoginService{
+		providers:    map[string]*identityProvider{},
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+		authService:  authService,
+		redisService: redisService,
+		auditService: auditService,
+		emails:       emails,
+		httpClient:   httpClient,
+		callbackURL:  strings.TrimSuffix(issuer, "/") + "/api/v1/auth/providers",
+	}
+	if s.httpClient == nil {
+		s.httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	for _, cfg := range providers {
+		if !providerNamePattern.MatchString(cfg.Name) {
+			return nil, fmt.Errorf("invalid identity provider name %q", cfg.Name)
+		}
+		if _, ok := s.providers[cfg.Name]; ok {
+			return nil, fmt.Errorf("duplicate identity provider %q", cfg.Name)
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("identity provider %q needs an issuer and a client ID", cfg.Name)
+		}
+		for field := range cfg.Claims {
+			if !containsString(externalClaimFields, field) {
+				return nil, fmt.Errorf("identity provider %q maps unknown field %q", cfg.Name, field)
+			}
+		}
+		if cfg.DisplayName == "" {
+			cfg.DisplayName = cfg.Name
+		}
+		if len(cfg.Scopes) == 0 {
+			cfg.Scopes = []string{ScopeOpenID, ScopeEmail, ScopeProfile}
+		} else if !containsString(cfg.Scopes, ScopeOpenID) {
+			cfg.Scopes = append([]string{ScopeOpenID}, cfg.Scopes...)
+		}
+
+		s.providers[cfg.Name] = &identityProvider{IdentityProviderConfig: cfg}
+		s.order = append(s.order, cfg.Name)
+	}
+	return s, nil
+}
+
+func (s *externalLoginService) Providers() []models.IdentityProvider {
+	providers := make([]models.IdentityProvider, 0, len(s.order))
+	for _, name := range s.order {
+		providers = append(providers, models.IdentityProvider{
+			Name:        name,
+			DisplayName: s.providers[name].DisplayName,
+		})
+	}
+	return providers
+}
+
+func (s *externalLoginService) Start(ctx context.Context, name string) (string, error) {
+	return s.start(ctx, name, "")
+}
+
+func (s *externalLoginService) StartLink(ctx context.Context, userID, name string) (string, error) {
+	return s.start(ctx, name, userID)
+}
+
+func (s *externalLoginService) start(ctx context.Context, name, userID string) (string, error) {
+	provider, err := s.provider(name)
+	if err != nil {
+		return "", err
+	}
+	metadata, err := s.discover(ctx, provider)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomID()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomID()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := generateCodeVerifier()
+	if err != nil {
+		return "", err
+	}
+	value, err := json.Marshal(loginState{Provider: name, UserID: userID, Nonce: nonce, CodeVerifier: verifier})
+	if err != nil {
+		return "", err
+	}
+	if err := s.redisService.StoreLoginState(ctx, state, string(value), loginStateExpiry); err != nil {
+		return "", fmt.Errorf("failed to store login state: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	return redirectWithParams(metadata.AuthorizationEndpoint, url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.ClientID},
+		"redirect_uri":          {s.redirectURI(name)},
+		"scope":                 {strings.Join(provider.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {PKCEMethodS256},
+	}), nil
+}
+
+func (s *externalLoginService) Callback(ctx context.Context, name string, req *models.ExternalLoginCallback) (string, error) {
+	provider, err := s.provider(name)
+	if err != nil {
+		return "", err
+	}
+
+	// The state is consumed first, so it can't be replayed even if the
+	// sign in fails
+	value, err := s.redisService.ConsumeLoginState(ctx, req.State)
+	if err != nil {
+		return "", err
+	}
+	var state loginState
+	if value == "" || json.Unmarshal([]byte(value), &state) != nil || state.Provider != name {
+		return "", utils.ErrExternalLoginFailed.WithMessage("invalid or expired login state")
+	}
+	if req.Error != "" {
+		message := req.ErrorDescription
+		if message == "" {
+			message = req.Error
+		}
+		return "", utils.ErrExternalLoginFailed.WithMessagef("the identity provider returned an error: %s", message)
+	}
+	if req.Code == "" {
+		return "", utils.ErrExternalLoginFailed.WithMessage("the identity provider returned no authorization code")
+	}
+
+	profile, err := s.redeem(ctx, provider, req.Code, &state)
+	if err != nil {
+		return "", err
+	}
+	if state.UserID != "" {
+		return "", s.link(ctx, provider, state.UserID, profile)
+	}
+	user, err := s.resolveUser(ctx, provider, profile)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := randomID()
+	if err != nil {
+		return "", err
+	}
+	login, err := json.Marshal(loginCode{UserID: user.ID, Provider: name})
+	if err != nil {
+		return "", err
+	}
+	if err := s.redisService.StoreLoginCode(ctx, code, string(login), loginCodeExpiry); err != nil {
+		return "", fmt.Errorf("failed to store login code: %w", err)
+	}
+	return code, nil
+}
+
+func (s *externalLoginService) Exchange(ctx context.Context, code string) (*models.TokenPair, error) {
+	value, err := s.redisService.ConsumeLoginCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	var login loginCode
+	if value == "" || json.Unmarshal([]byte(value), &login) != nil {
+		return nil, utils.ErrInvalidToken.WithMessage("invalid or expired login code")
+	}
+	return s.authService.LoginExternal(ctx, login.UserID, login.Provider)
+}
+
+func (s *externalLoginService) ListIdentities(userID string) ([]models.Identity, error) {
+	return s.identityRepo.ListByUser(userID)
+}
+
+func (s *externalLoginService) Unlink(ctx context.Context, userID, provider string) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return utils.ErrUserNotFound
+	}
+	identities, err := s.identityRepo.ListByUser(userID)
+	if err != nil {
+		return err
+	}
+
+	linked := false
+	for _, identity := range identities {
+		if identity.Provider == provider {
+			linked = true
+		}
+	}
+	if !linked {
+		return utils.ErrNotFound.WithMessage("identity provider isn't linked")
+	}
+	if user.Password == "" && len(identities) == 1 {
+		return utils.ErrConflict.WithMessage("set a password before unlinking the last identity provider")
+	}
+
+	if err := s.identityRepo.Delete(userID, provider); err != nil {
+		return err
+	}
+	s.auditService.Record(ctx, userID, models.AuditIdentityUnlinked, models.JSONMap{"provider": provider})
+	return nil
+}
+
+// link links the identity to the signed-in user who started the sign in.
+func (s *externalLoginService) link(ctx context.Context, provider *identityProvider, userID string, profile *externalProfile) error {
+	identity, err := s.identityRepo.Find(provider.Name, profile.Subject)
+	if err != nil {
+		return err
+	}
+	if identity != nil {
+		if identity.UserID == userID {
+			return nil
+		}
+		return utils.ErrConflict.WithMessage("this account at the identity provider is linked to another user")
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return utils.ErrUserNotFound
+	}
+	return s.addIdentity(ctx, user.ID, provider, profile, false)
+}
+
+// addIdentity links the identity to an existing user, who can only link one
+// account per provider.
+func (s *externalLoginService) addIdentity(ctx context.Context, userID string, provider *identityProvider, profile *externalProfile, autoLinked bool) error {
+	identities, err := s.identityRepo.ListByUser(userID)
+	if err != nil {
+		return err
+	}
+	for _, identity := range identities {
+		if identity.Provider == provider.Name {
+			return utils.ErrConflict.WithMessage("another account at this identity provider is already linked")
+		}
+	}
+
+	identity := &models.Identity{UserID: userID, Provider: provider.Name, Subject: profile.Subject}
+	if profile.EmailVerified {
+		identity.Email = profile.Email
+	}
+	if err := s.identityRepo.Create(identity); err != nil {
+		return err
+	}
+
+	metadata := models.JSONMap{"provider": provider.Name}
+	if autoLinked {
+		metadata["auto_linked"] = true
+	}
+	s.auditService.Record(ctx, userID, models.AuditIdentityLinked, metadata)
+	return nil
+}
+
+// resolveUser returns the user linked to the identity. On the first sign in
+// the identity is linked to the account with the same email address if the
+// provider allows it, and otherwise to a new account.
+func (s *externalLoginService) resolveUser(ctx context.Context, provider *identityProvider, profile *externalProfile) (*models.User, error) {
+	identity, err := s.identityRepo.Find(provider.Name, profile.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		user, err := s.userRepo.FindByIDUnscoped(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			if user.DeletedAt.Valid {
+				return nil, utils.ErrAccountDisabled
+			}
+			// Unverified addresses could belong to anyone
+			if profile.EmailVerified && profile.Email != "" && identity.Email != profile.Email {
+				identity.Email = profile.Email
+				if err := s.identityRepo.Update(identity); err != nil {
+					return nil, err
+				}
+			}
+			return user, nil
+		}
+
+		// The user was purged without their identities, so this is the
+		// first sign in with the identity
+		if err := s.identityRepo.Delete(identity.UserID, identity.Provider); err != nil {
+			return nil, err
+		}
+	}
+
+	if profile.Email == "" {
+		return nil, utils.ErrExternalLoginFailed.WithMessage("the identity provider didn't share an email address")
+	}
+	if !profile.EmailVerified {
+		return nil, utils.ErrExternalLoginFailed.WithMessage("the email address isn't verified by the identity provider")
+	}
+	if err := utils.ValidateEmail(profile.Email); err != nil {
+		return nil, err
+	}
+	existing, err := s.userRepo.FindByEmailUnscoped(profile.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		// The address is verified at this point, but accounts awaiting
+		// purge are never linked
+		if !provider.AutoLink || existing.DeletedAt.Valid {
+			return nil, utils.ErrEmailInUse.WithMessage("an account with this email already exists, sign in to it to link the identity provider")
+		}
+		if err := s.addIdentity(ctx, existing.ID, provider, profile, true); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+
+	user := newExternalUser(profile)
+	identity = &models.Identity{Provider: provider.Name, Subject: profile.Subject, Email: profile.Email}
+	if err := s.identityRepo.CreateWithUser(user, identity); err != nil {
+		return nil, err
+	}
+
+	s.auditService.Record(ctx, user.ID, models.AuditIdentityLinked, models.JSONMap{"provider": provider.Name})
+	return user, nil
+}
+
+// newExternalUser creates an account without a password from the profile.
+// Profile fields that don't pass validation are left empty.
+func newExternalUser(profile *externalProfile) *models.User {
+	user := &models.User{Email: profile.Email}
+	if utils.IsProfileNameValid(profile.Name) {
+		user.DisplayName = profile.Name
+	}
+	if utils.IsProfileNameValid(profile.GivenName) {
+		user.GivenName = profile.GivenName
+	}
+	if utils.IsProfileNameValid(profile.FamilyName) {
+		user.FamilyName = profile.FamilyName
+	}
+	if profile.Picture != "" && utils.IsImageURLValid(profile.Picture) {
+		user.AvatarURL = profile.Picture
+	}
+	if profile.Locale != "" && utils.IsLocaleValid(profile.Locale) {
+		user.Locale = profile.Locale
+	}
+	return user
+}
+
+// redeem exchanges the authorization code at the provider's token endpoint
+// and returns the profile of the user from the validated ID token.
+func (s *externalLoginService) redeem(ctx context.Context, provider *identityProvider, code string, state *loginState) (*externalProfile, error) {
+	metadata, err := s.discover(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {GrantTypeAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {s.redirectURI(provider.Name)},
+		"code_verifier": {state.CodeVerifier},
+	}
+	// client_secret_basic is the default (RFC 8414), so client_secret_post
+	// is only used for providers that don't support it
+	useBasic := len(metadata.TokenEndpointAuthMethodsSupported) == 0 ||
+		containsString(metadata.TokenEndpointAuthMethodsSupported, "client_secret_basic")
+	if !useBasic {
+		form.Set("client_id", provider.ClientID)
+		form.Set("client_secret", provider.ClientSecret)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+	if useBasic {
+		httpReq.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+	}
+
+	var tokens struct {
+		AccessToken      string `json:"access_token"`
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := s.do(httpReq, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		if tokens.Error != "" {
+			return nil, utils.ErrExternalLoginFailed.WithMessagef("the identity provider rejected the authorization code: %s", tokens.Error)
+		}
+		return nil, fmt.Errorf("token endpoint of %s returned status %d", provider.Name, status)
+	}
+	if tokens.IDToken == "" {
+		return nil, utils.ErrExternalLoginFailed.WithMessage("the identity provider returned no ID token")
+	}
+
+	claims, err := s.verifyIDToken(ctx, provider, metadata, tokens.IDToken, state.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// Some providers only release the email and profile at the userinfo
+	// endpoint
+	if _, ok := claims[provider.claim("email")]; !ok && metadata.UserinfoEndpoint != "" && tokens.AccessToken != "" {
+		if err := s.mergeUserInfo(ctx, provider, metadata, tokens.AccessToken, claims); err != nil {
+			return nil, err
+		}
+	}
+	profile := provider.profile(claims)
+	profile.Email = s.emails.Normalize(profile.Email)
+	return profile, nil
+}
+
+// verifyIDToken checks the ID token's signature against the provider's
+// keys, its issuer, audience, expiry and nonce, and returns its claims.
+func (s *externalLoginService) verifyIDToken(ctx context.Context, provider *identityProvider, metadata *models.OpenIDConfiguration, idToken, nonce string) (jwt.MapClaims, error) {
+	invalid := utils.ErrExternalLoginFailed.WithMessage("the identity provider returned an invalid ID token")
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return s.signingKey(ctx, provider, metadata, kid)
+	},
+		jwt.WithValidMethods(clientAssertionAlgorithms),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(provider.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, invalid
+	}
+
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, invalid
+	}
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, invalid
+	}
+	// A token issued to several audiences must name us as the authorized
+	// party (OpenID Connect Core section 3.1.3.7)
+	if audience, _ := claims.GetAudience(); len(audience) > 1 {
+		if azp, _ := claims["azp"].(string); azp != provider.ClientID {
+			return nil, invalid
+		}
+	}
+	return claims, nil
+}
+
+// mergeUserInfo adds the claims from the provider's userinfo endpoint that
+// aren't in the ID token.
+func (s *externalLoginService) mergeUserInfo(ctx context.Context, provider *identityProvider, metadata *models.OpenIDConfiguration, accessToken string, claims jwt.MapClaims) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.UserinfoEndpoint, nil)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+accessToken)
+	httpReq.Header.Set("Accept", "application/json")
+
+	var userInfo map[string]interface{}
+	status, err := s.do(httpReq, &userInfo)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("userinfo endpoint of %s returned status %d", provider.Name, status)
+	}
+	// The userinfo response must be about the same user (OpenID Connect
+	// Core section 5.3.2)
+	if userInfo["sub"] != claims["sub"] {
+		return utils.ErrExternalLoginFailed.WithMessage("the identity provider returned userinfo for another user")
+	}
+	for name, value := range userInfo {
+		if _, ok := claims[name]; !ok {
+			claims[name] = value
+		}
+	}
+	return nil
+}
+
+// discover fetches the provider's metadata on first use.
+func (s *externalLoginService) discover(ctx context.Context, provider *identityProvider) (*models.OpenIDConfiguration, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if provider.metadata != nil {
+		return provider.metadata, nil
+	}
+
+	issuer := strings.TrimSuffix(provider.Issuer, "/")
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var metadata models.OpenIDConfiguration
+	status, err := s.do(httpReq, &metadata)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery of %s returned status %d", provider.Name, status)
+	}
+	// The metadata must be about the configured issuer (OpenID Connect
+	// Discovery section 4.3)
+	if strings.TrimSuffix(metadata.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery of %s returned issuer %q", provider.Name, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery of %s returned incomplete metadata", provider.Name)
+	}
+
+	provider.metadata = &metadata
+	return provider.metadata, nil
+}
+
+// signingKey returns the provider's key with kid. The keys are fetched
+// again when kid is unknown, since providers rotate their keys.
+func (s *externalLoginService) signingKey(ctx context.Context, provider *identityProvider, metadata *models.OpenIDConfiguration, kid string) (interface{}, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if provider.keys != nil {
+		key, err := provider.keys.Find(kid)
+		if err == nil || time.Since(provider.keysFetchedAt) < keyRefreshInterval {
+			return key, err
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Providers may publish keys this server can't use, which only matter
+	// if a token is signed with them, so the set isn't validated up front
+	var keys utils.JWKSet
+	status, err := s.do(httpReq, &keys)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("key set of %s returned status %d", provider.Name, status)
+	}
+	provider.keys = &keys
+	provider.keysFetchedAt = time.Now()
+	return provider.keys.Find(kid)
+}
+
+// do sends a request to a provider and decodes its JSON response into v,
+// also for error responses.
+func (s *externalLoginService) do(req *http.Request, v interface{}) (int, error) {
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamResponseSize))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("invalid response from %s: %w", req.URL.Host, err)
+	}
+	return resp.StatusCode, nil
+}
+
+func (s *externalLoginService) provider(name string) (*identityProvider, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, utils.ErrNotFound.WithMessage("unknown identity provider")
+	}
+	return provider, nil
+}
+
+func (s *externalLoginService) redirectURI(provider string) string {
+	return s.callbackURL + "/" + provider + "/callback"
+}
+
+// claim returns the name of the provider's claim for a user field.
+func (p *identityProvider) claim(field string) string {
+	if name, ok := p.Claims[field]; ok {
+		return name
+	}
+	return field
+}
+
+// profile maps the provider's claims to the user's profile.
+func (p *identityProvider) profile(claims jwt.MapClaims) *externalProfile {
+	str := func(field string) string {
+		value, _ := claims[p.claim(field)].(string)
+		return strings.TrimSpace(value)
+	}
+
+	profile := &externalProfile{
+		Subject:    str("sub"),
+		Email:      str("email"),
+		Name:       str("name"),
+		GivenName:  str("given_name"),
+		FamilyName: str("family_name"),
+		Picture:    str("picture"),
+		Locale:     str("locale"),
+	}
+	// Some providers send email_verified as a string
+	switch verified := claims[p.claim("email_verified")].(type) {
+	case bool:
+		profile.EmailVerified = verified
+	case string:
+		profile.EmailVerified = verified == "true"
+	case nil:
+		profile.EmailVerified = p.TrustEmail
+	}
+	return profile
+}
+
+// generateCodeVerifier returns a PKCE code verifier of 43 characters.
+func generateCodeVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+	"github.com/kimutaiwycliff/auth-service/pkg/oidcmock"
+)
+
+// externalLoginTest is an externalLoginService signing users in at a mock
+// provider named "mock".
+type externalLoginTest struct {
+	*externalLoginService
+	provider   *oidcmock.Provider
+	users      *memoryUsers
+	identities *memoryIdentities
+	redis      *memoryRedis
+	jwtService JWTService
+}
+
+func newExternalLoginTest(t *testing.T, configure func(*IdentityProviderConfig)) *externalLoginTest {
+	t.Helper()
+	provider, err := oidcmock.New("mock-client", "mock-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(provider.Close)
+
+	cfg := IdentityProviderConfig{
+		Name:         "mock",
+		Issuer:       provider.Issuer(),
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	users := newMemoryUsers()
+	identities := &memoryIdentities{users: users}
+	redisService := newMemoryRedis()
+	jwtService := NewJWTService("test-secret", time.Minute, time.Hour)
+	authService := &authService{
+		userRepo:     users,
+		jwtService:   jwtService,
+		redisService: redisService,
+		rbacService:  &fixedRBAC{},
+		auditService: discardAudit{},
+	}
+
+	s, err := NewExternalLoginService([]IdentityProviderConfig{cfg}, identities, users, authService, redisService, discardAudit{}, utils.EmailNormalizer{}, provider.Client(), "https://auth.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &externalLoginTest{
+		externalLoginService: s.(*externalLoginService),
+		provider:             provider,
+		users:                users,
+		identities:           identities,
+		redis:                redisService,
+		jwtService:           jwtService,
+	}
+}
+
+// authorize starts a sign in and follows the authorization URL to the mock
+// provider, returning the parameters it redirects back with.
+func (e *externalLoginTest) authorize(t *testing.T, userID string) (*url.URL, *models.ExternalLoginCallback) {
+	t.Helper()
+	authorizationURL, err := e.start(context.Background(), "mock", userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := e.provider.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := location.Query()
+	parsed, _ := url.Parse(authorizationURL)
+	return parsed, &models.ExternalLoginCallback{
+		Code:             query.Get("code"),
+		State:            query.Get("state"),
+		Error:            query.Get("error"),
+		ErrorDescription: query.Get("error_description"),
+	}
+}
+
+// signIn signs in whoever the mock provider is set to sign in and returns
+// the session's access token claims.
+func (e *externalLoginTest) signIn(t *testing.T) (map[string]interface{}, error) {
+	t.Helper()
+	_, callback := e.authorize(t, "")
+	code, err := e.Callback(context.Background(), "mock", callback)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := e.Exchange(context.Background(), code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := e.jwtService.ValidateAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims, nil
+}
+
+func TestExternalLoginFirstSignInCreatesLinkedAccount(t *testing.T) {
+	e := newExternalLoginTest(t, nil)
+	e.provider.SignIn(map[string]interface{}{
+		"sub":            "alice-at-mock",
+		"email":          "Alice@Example.com",
+		"email_verified": true,
+		"name":           "Alice Liddell",
+	})
+
+	claims, err := e.signIn(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, _ := e.identities.Find("mock", "alice-at-mock")
+	if identity == nil {
+		t.Fatal("identity was not linked")
+	}
+	if claims["sub"] != identity.UserID {
+		t.Errorf("signed in as %v, want the linked user %s", claims["sub"], identity.UserID)
+	}
+	if amr := claimStrings(claims, "amr"); len(amr) != 1 || amr[0] != AuthMethodFederated {
+		t.Errorf("amr = %v, want [%s]", amr, AuthMethodFederated)
+	}
+	user := e.users.users[identity.UserID]
+	if user.Email != "alice@example.com" || user.DisplayName != "Alice Liddell" || user.Password != "" {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	// The second sign in finds the same account
+	claims, err = e.signIn(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["sub"] != identity.UserID || len(e.users.users) != 1 {
+		t.Error("second sign in didn't reuse the linked account")
+	}
+}
+
+func TestExternalLoginRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]interface{}
+	}{
+		{"nonce mismatch", map[string]interface{}{"nonce": "replayed-nonce"}},
+		{"audience mismatch", map[string]interface{}{"aud": "another-client"}},
+		{"issuer mismatch", map[string]interface{}{"iss": "https://evil.example.com"}},
+		{"expired", map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}},
+		{"several audiences without azp", map[string]interface{}{"aud": []string{"mock-client", "another-client"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newExternalLoginTest(t, nil)
+			e.provider.SignIn(map[string]interface{}{"sub": "alice-at-mock", "email": "alice@example.com", "email_verified": true})
+			e.provider.OverrideIDTokenClaims(tt.overrides)
+
+			_, err := e.signIn(t)
+			if !errors.Is(err, utils.ErrExternalLoginFailed) {
+				t.Errorf("err = %v, want %v", err, utils.ErrExternalLoginFailed)
+			}
+			if len(e.users.users) != 0 || len(e.identities.identities) != 0 {
+				t.Error("an invalid ID token created an account")
+			}
+		})
+	}
+}
+
+func TestExternalLoginUsesPKCE(t *testing.T) {
+	e := newExternalLoginTest(t, nil)
+	e.provider.SignIn(map[string]interface{}{"sub": "alice-at-mock", "email": "alice@example.com", "email_verified": true})
+
+	authorizationURL, callback := e.authorize(t, "")
+	query := authorizationURL.Query()
+	if query.Get("code_challenge_method") != PKCEMethodS256 || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization URL has no S256 code challenge: %s", authorizationURL)
+	}
+
+	// A code redeemed with another verifier than the one the challenge was
+	// made from is refused by the provider
+	value := e.redis.get("login_state:" + callback.State)
+	var state loginState
+	if err := json.Unmarshal([]byte(value), &state); err != nil {
+		t.Fatal(err)
+	}
+	if !verifyCodeChallenge(query.Get("code_challenge"), state.CodeVerifier) {
+		t.Fatal("code challenge doesn't match the stored verifier")
+	}
+	state.CodeVerifier, _ = generateCodeVerifier()
+	tampered, _ := json.Marshal(state)
+	e.redis.set("login_state:"+callback.State, string(tampered))
+
+	if _, err := e.Callback(context.Background(), "mock", callback); !errors.Is(err, utils.ErrExternalLoginFailed) {
+		t.Errorf("err = %v, want %v", err, utils.ErrExternalLoginFailed)
+	}
+}
+
+func TestExternalLoginStateIsSingleUse(t *testing.T) {
+	e := newExternalLoginTest(t, nil)
+	e.provider.SignIn(map[string]interface{}{"sub": "alice-at-mock", "email": "alice@example.com", "email_verified": true})
+
+	_, callback := e.authorize(t, "")
+	if _, err := e.Callback(context.Background(), "mock", callback); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Callback(context.Background(), "mock", callback); !errors.Is(err, utils.ErrExternalLoginFailed) {
+		t.Errorf("replayed callback: err = %v, want %v", err, utils.ErrExternalLoginFailed)
+	}
+}
+
+func TestExternalLoginMapsClaims(t *testing.T) {
+	e := newExternalLoginTest(t, func(cfg *IdentityProviderConfig) {
+		cfg.Claims = map[string]string{"email": "mail", "name": "displayName", "email_verified": "mail_confirmed"}
+	})
+	e.provider.SignIn(map[string]interface{}{
+		"sub":            "alice-at-mock",
+		"mail":           "alice@example.com",
+		"mail_confirmed": "true",
+		"displayName":    "Alice Liddell",
+		"given_name":     "Alice",
+		// Ignored, since email is mapped to mail
+		"email": "someone@example.com",
+	})
+
+	claims, err := e.signIn(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := e.users.users[claims["sub"].(string)]
+	if user.Email != "alice@example.com" || user.DisplayName != "Alice Liddell" || user.GivenName != "Alice" {
+		t.Errorf("unexpected user %+v", user)
+	}
+}
+
+func TestExternalLoginRequiresVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustEmail bool
+		verified   interface{}
+		wantErr    bool
+	}{
+		{"verified", false, true, false},
+		{"unverified", false, false, true},
+		{"not sent", false, nil, true},
+		{"not sent by a trusted provider", true, nil, false},
+		{"unverified at a trusted provider", true, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newExternalLoginTest(t, func(cfg *IdentityProviderConfig) { cfg.TrustEmail = tt.trustEmail })
+			claims := map[string]interface{}{"sub": "alice-at-mock", "email": "alice@example.com"}
+			if tt.verified != nil {
+				claims["email_verified"] = tt.verified
+			}
+			e.provider.SignIn(claims)
+
+			_, err := e.signIn(t)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExternalLoginAutoLink(t *testing.T) {
+	tests := []struct {
+		name     string
+		autoLink bool
+		verified bool
+		deleted  bool
+		wantErr  error
+	}{
+		{name: "auto link enabled", autoLink: true, verified: true},
+		{name: "auto link disabled", autoLink: false, verified: true, wantErr: utils.ErrEmailInUse},
+		{name: "unverified email", autoLink: true, verified: false, wantErr: utils.ErrExternalLoginFailed},
+		{name: "account awaiting deletion", autoLink: true, verified: true, deleted: true, wantErr: utils.ErrEmailInUse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newExternalLoginTest(t, func(cfg *IdentityProviderConfig) { cfg.AutoLink = tt.autoLink })
+			existing := &models.User{ID: "existing", Email: "alice@example.com", Password: "hash", Active: true}
+			if tt.deleted {
+				existing.DeletedAt.Time, existing.DeletedAt.Valid = time.Now(), true
+			}
+			e.users.users[existing.ID] = existing
+			e.provider.SignIn(map[string]interface{}{"sub": "alice-at-mock", "email": "alice@example.com", "email_verified": tt.verified})
+
+			claims, err := e.signIn(t)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+				if len(e.identities.identities) != 0 {
+					t.Error("identity was linked")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims["sub"] != existing.ID || len(e.users.users) != 1 {
+				t.Errorf("signed in as %v, want the existing account", claims["sub"])
+			}
+		})
+	}
+}
+
+func TestExternalLoginReplacesDanglingIdentity(t *testing.T) {
+	e := newExternalLoginTest(t, nil)
+	// Left behind by a user purged before purges deleted identities
+	e.identities.identities = []models.Identity{{ID: "dangling", UserID: "purged", Provider: "mock", Subject: "alice-at-mock"}}
+	e.provider.SignIn(map[string]interface{}{"sub": "alice-at-mock", "email": "alice@example.com", "email_verified": true})
+
+	claims, err := e.signIn(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, _ := e.identities.Find("mock", "alice-at-mock")
+	if identity == nil || identity.UserID == "purged" || claims["sub"] != identity.UserID {
+		t.Errorf("identity = %+v, signed in as %v", identity, claims["sub"])
+	}
+}
+
+func TestExternalLoginLinksToSignedInUser(t *testing.T) {
+	e := newExternalLoginTest(t, nil)
+	e.users.users["bob"] = &models.User{ID: "bob", Email: "bob@example.com", Password: "hash", Active: true}
+	// The provider's address doesn't have to match for explicit links
+	e.provider.SignIn(map[string]interface{}{"sub": "bob-at-mock", "email": "robert@example.org", "email_verified": false})
+
+	_, callback := e.authorize(t, "bob")
+	code, err := e.Callback(context.Background(), "mock", callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "" {
+		t.Error("linking returned a login code")
+	}
+	identities, _ := e.ListIdentities("bob")
+	if len(identities) != 1 || identities[0].Subject != "bob-at-mock" {
+		t.Errorf("identities = %+v", identities)
+	}
+}
+
+func TestExternalLoginOnlyRecordsVerifiedEmails(t *testing.T) {
+	e := newExternalLoginTest(t, nil)
+	e.provider.SignIn(map[string]interface{}{"sub": "alice-at-mock", "email": "alice@example.com", "email_verified": true})
+	if _, err := e.signIn(t); err != nil {
+		t.Fatal(err)
+	}
+
+	e.provider.SignIn(map[string]interface{}{"sub": "alice-at-mock", "email": "mallory@example.com", "email_verified": false})
+	if _, err := e.signIn(t); err != nil {
+		t.Fatal(err)
+	}
+	if identity, _ := e.identities.Find("mock", "alice-at-mock"); identity.Email != "alice@example.com" {
+		t.Errorf("identity email = %q after an unverified sign in", identity.Email)
+	}
+
+	e.provider.SignIn(map[string]interface{}{"sub": "alice-at-mock", "email": "alice@example.org", "email_verified": true})
+	if _, err := e.signIn(t); err != nil {
+		t.Fatal(err)
+	}
+	if identity, _ := e.identities.Find("mock", "alice-at-mock"); identity.Email != "alice@example.org" {
+		t.Errorf("identity email = %q after a verified sign in", identity.Email)
+	}
+}
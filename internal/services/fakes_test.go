@@ -0,0 +1,392 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// memoryRedis is a RedisService that keeps everything in a map and never
+// expires anything.
+type memoryRedis struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func newMemoryRedis() *memoryRedis {
+	return &memoryRedis{values: map[string]string{}}
+}
+
+func (r *memoryRedis) set(key, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[key] = value
+}
+
+func (r *memoryRedis) get(key string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.values[key]
+}
+
+func (r *memoryRedis) consume(key string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value := r.values[key]
+	delete(r.values, key)
+	return value
+}
+
+func (r *memoryRedis) StoreRefreshToken(ctx context.Context, userID, token string, expiry time.Duration) error {
+	r.set("refresh_token:"+userID, token)
+	return nil
+}
+
+func (r *memoryRedis) GetRefreshToken(ctx context.Context, userID string) (string, error) {
+	token := r.get("refresh_token:" + userID)
+	if token == "" {
+		return "", redis.Nil
+	}
+	return token, nil
+}
+
+func (r *memoryRedis) DeleteRefreshToken(ctx context.Context, userID string) error {
+	r.consume("refresh_token:" + userID)
+	return nil
+}
+
+func (r *memoryRedis) DeleteClientRefreshTokens(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.values {
+		if strings.HasPrefix(key, "refresh_token:"+userID+":") {
+			delete(r.values, key)
+		}
+	}
+	return nil
+}
+
+func (r *memoryRedis) DeleteRefreshTokensOfClient(ctx context.Context, clientID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.values {
+		if strings.HasPrefix(key, "refresh_token:") && strings.HasSuffix(key, ":"+clientID) {
+			delete(r.values, key)
+		}
+	}
+	return nil
+}
+
+func (r *memoryRedis) BlacklistToken(ctx context.Context, token string, expiry time.Duration) error {
+	r.set("blacklist:"+token, "1")
+	return nil
+}
+
+func (r *memoryRedis) IsTokenBlacklisted(ctx context.Context, token string) (bool, error) {
+	return r.get("blacklist:"+token) != "", nil
+}
+
+func (r *memoryRedis) SetRevocationWatermark(ctx context.Context, userID string, at time.Time, expiry time.Duration) error {
+	r.set("revoked_before:"+userID, at.Format(time.RFC3339Nano))
+	return nil
+}
+
+func (r *memoryRedis) GetRevocationWatermark(ctx context.Context, userID string) (int64, error) {
+	at, err := time.Parse(time.RFC3339Nano, r.get("revoked_before:"+userID))
+	if err != nil {
+		return 0, nil
+	}
+	return at.Unix(), nil
+}
+
+func (r *memoryRedis) StorePendingEmailChange(ctx context.Context, userID, value string, expiry time.Duration) error {
+	r.set("email_change:"+userID, value)
+	return nil
+}
+
+func (r *memoryRedis) GetPendingEmailChange(ctx context.Context, userID string) (string, error) {
+	return r.get("email_change:" + userID), nil
+}
+
+func (r *memoryRedis) DeletePendingEmailChange(ctx context.Context, userID string) error {
+	r.consume("email_change:" + userID)
+	return nil
+}
+
+func (r *memoryRedis) StoreAuthorizationCode(ctx context.Context, code, value string, expiry time.Duration) error {
+	r.set("auth_code:"+code, value)
+	return nil
+}
+
+func (r *memoryRedis) ConsumeAuthorizationCode(ctx context.Context, code string) (string, error) {
+	return r.consume("auth_code:" + code), nil
+}
+
+func (r *memoryRedis) MarkClientAssertionUsed(ctx context.Context, clientID, jti string, expiry time.Duration) (bool, error) {
+	key := "client_assertion:" + clientID + ":" + jti
+	if r.get(key) != "" {
+		return false, nil
+	}
+	r.set(key, "1")
+	return true, nil
+}
+
+func (r *memoryRedis) StoreDeviceCode(ctx context.Context, deviceCode, userCode, value string, expiry time.Duration) error {
+	r.set("device_code:"+deviceCode, value)
+	r.set("user_code:"+userCode, deviceCode)
+	return nil
+}
+
+func (r *memoryRedis) GetDeviceCode(ctx context.Context, deviceCode string) (string, error) {
+	return r.get("device_code:" + deviceCode), nil
+}
+
+func (r *memoryRedis) FindDeviceCode(ctx context.Context, userCode string) (string, error) {
+	return r.get("user_code:" + userCode), nil
+}
+
+func (r *memoryRedis) UpdateDeviceCode(ctx context.Context, deviceCode, value string) error {
+	if r.get("device_code:"+deviceCode) != "" {
+		r.set("device_code:"+deviceCode, value)
+	}
+	return nil
+}
+
+func (r *memoryRedis) ConsumeDeviceCode(ctx context.Context, deviceCode string) (string, error) {
+	return r.consume("device_code:" + deviceCode), nil
+}
+
+// MarkDeviceCodePolled ignores interval: a device code counts as polled
+// until forgetPoll is called.
+func (r *memoryRedis) MarkDeviceCodePolled(ctx context.Context, deviceCode string, interval time.Duration) (bool, error) {
+	key := "device_poll:" + deviceCode
+	if r.get(key) != "" {
+		return false, nil
+	}
+	r.set(key, "1")
+	return true, nil
+}
+
+func (r *memoryRedis) forgetPoll(deviceCode string) {
+	r.consume("device_poll:" + deviceCode)
+}
+
+func (r *memoryRedis) StoreLoginState(ctx context.Context, state, value string, expiry time.Duration) error {
+	r.set("login_state:"+state, value)
+	return nil
+}
+
+func (r *memoryRedis) ConsumeLoginState(ctx context.Context, state string) (string, error) {
+	return r.consume("login_state:" + state), nil
+}
+
+func (r *memoryRedis) StoreLoginCode(ctx context.Context, code, value string, expiry time.Duration) error {
+	r.set("login_code:"+code, value)
+	return nil
+}
+
+func (r *memoryRedis) ConsumeLoginCode(ctx context.Context, code string) (string, error) {
+	return r.consume("login_code:" + code), nil
+}
+
+func (r *memoryRedis) IncrementRequestCount(ctx context.Context, key string, window time.Duration) (int, error) {
+	return 1, nil
+}
+
+// fixedRBAC grants every user the same roles and permissions.
+type fixedRBAC struct {
+	RBACService
+	roles       []string
+	permissions []string
+}
+
+func (r *fixedRBAC) GetUserAuthorization(userID string) ([]string, []string, error) {
+	return r.roles, r.permissions, nil
+}
+
+func (r *fixedRBAC) GetUserRoles(userID string) ([]models.Role, error) {
+	roles := []models.Role{}
+	for _, name := range r.roles {
+		roles = append(roles, models.Role{Name: name})
+	}
+	return roles, nil
+}
+
+// noOrganizations is an OrganizationService for users who aren't members of
+// any organization.
+type noOrganizations struct {
+	OrganizationService
+}
+
+func (noOrganizations) ListUserOrganizations(userID string) ([]models.OrganizationMember, error) {
+	return []models.OrganizationMember{}, nil
+}
+
+// discardAudit drops every audit event.
+type discardAudit struct {
+	AuditService
+}
+
+func (discardAudit) Record(ctx context.Context, userID, eventType string, metadata models.JSONMap) {}
+
+func (discardAudit) ListUserEvents(userID string, types []string, limit int) ([]models.AuditEvent, error) {
+	return []models.AuditEvent{}, nil
+}
+
+// recordedAudit keeps the audit events it is given.
+type recordedAudit struct {
+	discardAudit
+	events []models.AuditEvent
+}
+
+func (a *recordedAudit) Record(ctx context.Context, userID, eventType string, metadata models.JSONMap) {
+	a.events = append(a.events, models.AuditEvent{UserID: &userID, Type: eventType, Metadata: metadata})
+}
+
+// memoryConsents is an OAuthConsentRepository over a slice.
+type memoryConsents struct {
+	repositories.OAuthConsentRepository
+	consents []models.OAuthConsent
+}
+
+func (r *memoryConsents) ListByUser(userID string) ([]models.OAuthConsent, error) {
+	consents := []models.OAuthConsent{}
+	for _, consent := range r.consents {
+		if consent.UserID == userID {
+			consents = append(consents, consent)
+		}
+	}
+	return consents, nil
+}
+
+// memoryUsers is a UserRepository over a map keyed by user ID. Soft deleted
+// users are those with DeletedAt set.
+type memoryUsers struct {
+	repositories.UserRepository
+	users map[string]*models.User
+}
+
+func newMemoryUsers(users ...*models.User) *memoryUsers {
+	r := &memoryUsers{users: map[string]*models.User{}}
+	for _, user := range users {
+		r.users[user.ID] = user
+	}
+	return r
+}
+
+func (r *memoryUsers) Create(user *models.User) (*models.User, error) {
+	if user.ID == "" {
+		user.ID = fmt.Sprintf("user-%d", len(r.users)+1)
+	}
+	// Like gorm, which leaves the zero value to the column default
+	if !user.Active {
+		user.Active = true
+	}
+	r.users[user.ID] = user
+	return user, nil
+}
+
+func (r *memoryUsers) FindByID(id string) (*models.User, error) {
+	if user, ok := r.users[id]; ok && !user.DeletedAt.Valid {
+		return user, nil
+	}
+	return nil, nil
+}
+
+func (r *memoryUsers) FindByIDUnscoped(id string) (*models.User, error) {
+	return r.users[id], nil
+}
+
+func (r *memoryUsers) FindByEmailUnscoped(email string) (*models.User, error) {
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryUsers) Update(user *models.User) error {
+	r.users[user.ID] = user
+	return nil
+}
+
+func (r *memoryUsers) Delete(id string) error {
+	if user, ok := r.users[id]; ok {
+		user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	}
+	return nil
+}
+
+// memoryIdentities is an IdentityRepository over a slice. It enforces the
+// same unique indexes as the database.
+type memoryIdentities struct {
+	users      *memoryUsers
+	identities []models.Identity
+}
+
+func (r *memoryIdentities) Find(provider, subject string) (*models.Identity, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryIdentities) Create(identity *models.Identity) error {
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider &&
+			(existing.Subject == identity.Subject || existing.UserID == identity.UserID) {
+			return fmt.Errorf("duplicate identity %s/%s", identity.Provider, identity.Subject)
+		}
+	}
+	identity.ID = fmt.Sprintf("identity-%d", len(r.identities)+1)
+	r.identities = append(r.identities, *identity)
+	return nil
+}
+
+func (r *memoryIdentities) CreateWithUser(user *models.User, identity *models.Identity) error {
+	if _, err := r.users.Create(user); err != nil {
+		return err
+	}
+	identity.UserID = user.ID
+	return r.Create(identity)
+}
+
+func (r *memoryIdentities) Update(identity *models.Identity) error {
+	for i, existing := range r.identities {
+		if existing.ID == identity.ID {
+			r.identities[i] = *identity
+		}
+	}
+	return nil
+}
+
+func (r *memoryIdentities) ListByUser(userID string) ([]models.Identity, error) {
+	var identities []models.Identity
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (r *memoryIdentities) Delete(userID, provider string) error {
+	var kept []models.Identity
+	for _, identity := range r.identities {
+		if identity.UserID != userID || identity.Provider != provider {
+			kept = append(kept, identity)
+		}
+	}
+	r.identities = kept
+	return nil
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+// MaxImportBatchSize bounds the number of users accepted in a single import.
+const MaxImportBatchSize = 1000
+
+type ImportService interface {
+	ImportUsers(req *models.UserImportRequest) (*models.UserImportResult, error)
+}
+
+type importService struct {
+	userRepo repositories.UserRepository
+}
+
+func NewImportService(userRepo repositories.UserRepository) ImportService {
+	return &importService{userRepo: userRepo}
+}
+
+// ImportUsers creates users with their existing password hashes. Users whose
+// email is already registered are skipped; invalid entries are reported per
+// index and do not abort the rest of the batch.
+func (s *importService) ImportUsers(req *models.UserImportRequest) (*models.UserImportResult, error) {
+	if len(req.Users) == 0 {
+		return nil, utils.ErrInvalidInput.WithMessage("no users to import")
+	}
+	if len(req.Users) > MaxImportBatchSize {
+		return nil, utils.ErrInvalidInput.WithMessagef("at most %d users can be imported per batch", MaxImportBatchSize)
+	}
+
+	result := &models.UserImportResult{}
+	for i, imported := range req.Users {
+		skipped, err := s.importUser(&imported, req.FirebaseScrypt)
+		switch {
+		case err != nil:
+			result.Failed++
+			result.Errors = append(result.Errors, models.UserImportError{
+				Index: i,
+				Email: imported.Email,
+				Error: err.Error(),
+			})
+		case skipped:
+			result.Skipped++
+		default:
+			result.Imported++
+		}
+	}
+
+	return result, nil
+}
+
+func (s *importService) importUser(imported *models.ImportedUser, firebase *models.FirebaseScryptParams) (bool, error) {
+	if err := utils.ValidateEmail(imported.Email); err != nil {
+		return false, err
+	}
+
+	hash, err := storedPasswordHash(imported, firebase)
+	if err != nil {
+		return false, err
+	}
+
+	existingUser, err := s.userRepo.FindByEmailUnscoped(imported.Email)
+	if err != nil {
+		return false, err
+	}
+	if existingUser != nil {
+		return true, nil
+	}
+
+	user := &models.User{
+		Email:    imported.Email,
+		Password: hash,
+		Active:   true,
+	}
+	if imported.Active != nil {
+		user.Active = *imported.Active
+	}
+
+	if _, err := s.userRepo.Create(user); err != nil {
+		return false, err
+	}
+	// GORM skips zero values on insert, so an inactive user would otherwise
+	// pick up the column default.
+	if !user.Active {
+		return false, s.userRepo.Update(user)
+	}
+	return false, nil
+}
+
+// storedPasswordHash converts an imported hash into the form VerifyPassword
+// understands and checks that it is well formed.
+func storedPasswordHash(imported *models.ImportedUser, firebase *models.FirebaseScryptParams) (string, error) {
+	algorithm := imported.HashAlgorithm
+	if algorithm == "" {
+		algorithm = utils.DetectHashAlgorithm(imported.PasswordHash)
+	}
+
+	hash := imported.PasswordHash
+	if algorithm == utils.HashFirebaseScrypt && utils.DetectHashAlgorithm(hash) != utils.HashFirebaseScrypt {
+		if firebase == nil {
+			return "", errors.New("firebase_scrypt parameters are required for firebase-scrypt hashes")
+		}
+		encoded, err := utils.EncodeFirebaseScryptHash(hash, imported.Salt,
+			firebase.SignerKey, firebase.SaltSeparator, firebase.Rounds, firebase.MemCost)
+		if err != nil {
+			return "", err
+		}
+		hash = encoded
+	}
+
+	if detected := utils.DetectHashAlgorithm(hash); detected != algorithm {
+		return "", fmt.Errorf("password hash does not match algorithm %q", algorithm)
+	}
+	if err := utils.ValidatePasswordHash(hash); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+const invitationTokenPurpose = "org_invitation"
+
+type InvitationService interface {
+	CreateInvitation(orgID, inviterID, email, role string) (*models.Invitation, error)
+	ListPending(orgID string) ([]models.Invitation, error)
+	Revoke(orgID, invitationID string) error
+	// Accept adds the invited email to the organization. If no account exists
+	// for the email one is created with the given password.
+	Accept(token, password string) (*models.OrganizationMember, error)
+	Decline(token string) error
+}
+
+type invitationService struct {
+	invitationRepo repositories.InvitationRepository
+	orgRepo        repositories.OrganizationRepository
+	roleRepo       repositories.RoleRepository
+	userRepo       repositories.UserRepository
+	authService    AuthService
+	jwtService     JWTService
+	emailService   EmailService
+	emails         utils.EmailNormalizer
+	expiry         time.Duration
+}
+
+func NewInvitationService(
+	invitationRepo repositories.InvitationRepository,
+	orgRepo repositories.OrganizationRepository,
+	roleRepo repositories.RoleRepository,
+	userRepo repositories.UserRepository,
+	authService AuthService,
+	jwtService JWTService,
+	emailService EmailService,
+	emails utils.EmailNormalizer,
+	expiry time.Duration,
+) InvitationService {
+	return &invitationService{
+		invitationRepo: invitationRepo,
+		orgRepo:        orgRepo,
+		roleRepo:       roleRepo,
+		userRepo:       userRepo,
+		authService:    authService,
+		jwtService:     jwtService,
+		emailService:   emailService,
+		emails:         emails,
+		expiry:         expiry,
+	}
+}
+
+func (s *invitationService) CreateInvitation(orgID, inviterID, email, roleName string) (*models.Invitation, error) {
+	email = s.emails.Normalize(email)
+	if err := utils.ValidateEmail(email); err != nil {
+		return nil, err
+	}
+	if roleName == "" {
+		roleName = OrgMemberRole
+	}
+
+	org, err := s.orgRepo.FindByID(orgID)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, utils.ErrNotFound.WithMessage("organization not found")
+	}
+
+	role, err := s.roleRepo.FindRoleByName(roleName, models.RoleScopeOrganization)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, utils.ErrInvalidInput.WithMessage("unknown organization role " + roleName)
+	}
+
+	if user, err := s.userRepo.FindByEmail(email); err != nil {
+		return nil, err
+	} else if user != nil {
+		member, err := s.orgRepo.FindMember(orgID, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if member != nil {
+			return nil, utils.ErrConflict.WithMessage("user is already a member")
+		}
+	}
+
+	pending, err := s.invitationRepo.FindPending(orgID, email)
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		return nil, utils.ErrConflict.WithMessage("a pending invitation already exists for this email")
+	}
+
+	invitation, err := s.invitationRepo.Create(&models.Invitation{
+		OrganizationID: orgID,
+		Email:          email,
+		RoleID:         role.ID,
+		InvitedByID:    inviterID,
+		Status:         models.InvitationPending,
+		ExpiresAt:      time.Now().Add(s.expiry),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.jwtService.GenerateActionToken(invitation.ID, invitationTokenPurpose, s.expiry, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body := fmt.Sprintf(
+		"You have been invited to join %s as %s.\n\nAccept the invitation:\n%s\n\nThis link expires on %s.",
+		org.Name, role.Name,
+		s.emailService.LinkURL("/invitations/accept", token),
+		invitation.ExpiresAt.Format(time.RFC1123),
+	)
+	if err := s.emailService.Send(email, "Invitation to join "+org.Name, body); err != nil {
+		return nil, fmt.Errorf("failed to send invitation email: %w", err)
+	}
+
+	invitation.Role = role
+	return invitation, nil
+}
+
+func (s *invitationService) ListPending(orgID string) ([]models.Invitation, error) {
+	return s.invitationRepo.ListPending(orgID)
+}
+
+func (s *invitationService) Revoke(orgID, invitationID string) error {
+	invitation, err := s.invitationRepo.FindByID(invitationID)
+	if err != nil {
+		return err
+	}
+	if invitation == nil || invitation.OrganizationID != orgID {
+		return utils.ErrNotFound.WithMessage("invitation not found")
+	}
+	if invitation.Status != models.InvitationPending {
+		return utils.ErrConflict.WithMessage("invitation is no longer pending")
+	}
+
+	return s.respond(invitation, models.InvitationRevoked)
+}
+
+func (s *invitationService) Accept(token, password string) (*models.OrganizationMember, error) {
+	invitation, err := s.pendingInvitation(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByEmail(invitation.Email)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		if password == "" {
+			return nil, utils.ErrInvalidInput.WithMessage("a password is required to create your account")
+		}
+		if user, err = s.authService.Register(invitation.Email, password); err != nil {
+			return nil, err
+		}
+	}
+
+	member, err := s.orgRepo.FindMember(invitation.OrganizationID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		member = &models.OrganizationMember{
+			OrganizationID: invitation.OrganizationID,
+			UserID:         user.ID,
+			Roles:          []models.Role{*invitation.Role},
+		}
+		if err := s.orgRepo.AddMember(member); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.respond(invitation, models.InvitationAccepted); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func (s *invitationService) Decline(token string) error {
+	invitation, err := s.pendingInvitation(token)
+	if err != nil {
+		return err
+	}
+	return s.respond(invitation, models.InvitationDeclined)
+}
+
+func (s *invitationService) pendingInvitation(token string) (*models.Invitation, error) {
+	claims, err := s.jwtService.ValidateActionToken(token, invitationTokenPurpose)
+	if err != nil {
+		return nil, utils.ErrInvalidLink.WithMessage("invalid or expired invitation")
+	}
+	invitationID, ok := claims["sub"].(string)
+	if !ok {
+		return nil, utils.ErrInvalidLink.WithMessage("invalid or expired invitation")
+	}
+
+	invitation, err := s.invitationRepo.FindByID(invitationID)
+	if err != nil {
+		return nil, err
+	}
+	if invitation == nil || invitation.Status != models.InvitationPending {
+		return nil, utils.ErrInvalidLink.WithMessage("invitation is no longer valid")
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		return nil, utils.ErrInvalidLink.WithMessage("invalid or expired invitation")
+	}
+	return invitation, nil
+}
+
+func (s *invitationService) respond(invitation *models.Invitation, status string) error {
+	now := time.Now()
+	invitation.Status = status
+	invitation.RespondedAt = &now
+	return s.invitationRepo.Update(invitation)
+}
@@ -8,10 +8,15 @@ import (
 )
 
 type JWTService interface {
-	GenerateAccessToken(userID string) (string, error)
-	GenerateRefreshToken(userID string) (string, error)
+	// An expiry of 0 uses the configured lifetime of the token type.
+	GenerateAccessToken(userID string, expiry time.Duration, extraClaims jwt.MapClaims) (string, error)
+	GenerateRefreshToken(userID string, expiry time.Duration, extraClaims jwt.MapClaims) (string, error)
 	ValidateAccessToken(token string) (jwt.MapClaims, error)
 	ValidateRefreshToken(token string) (jwt.MapClaims, error)
+	// Action tokens are single-purpose signed links (invitations, email
+	// confirmation, ...). They are never accepted as access or refresh tokens.
+	GenerateActionToken(subject, purpose string, expiry time.Duration, extraClaims jwt.MapClaims) (string, error)
+	ValidateActionToken(token, purpose string) (jwt.MapClaims, error)
 	GetAccessExpiry() time.Duration
 	GetRefreshExpiry() time.Duration
 }
@@ -30,57 +35,125 @@ func NewJWTService(secret string, accessExpiry, refreshExpiry time.Duration) JWT
 	}
 }
 
-func (s *jwtService) GenerateAccessToken(userID string) (string, error) {
-	claims := jwt.MapClaims{
-		"sub": userID,
-		"exp": time.Now().Add(s.accessExpiry).Unix(),
-		"iat": time.Now().Unix(),
+// GenerateAccessToken signs an access token for userID. extraClaims are
+// added to the payload but cannot override sub, exp or iat.
+func (s *jwtService) GenerateAccessToken(userID string, expiry time.Duration, extraClaims jwt.MapClaims) (string, error) {
+	if expiry <= 0 {
+		expiry = s.accessExpiry
 	}
 
+	claims := jwt.MapClaims{}
+	for key, value := range extraClaims {
+		claims[key] = value
+	}
+	claims["sub"] = userID
+	claims["exp"] = time.Now().Add(expiry).Unix()
+	claims["iat"] = time.Now().Unix()
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(s.secret))
 }
 
-func (s *jwtService) GenerateRefreshToken(userID string) (string, error) {
-	claims := jwt.MapClaims{
-		"sub": userID,
-		"exp": time.Now().Add(s.refreshExpiry).Unix(),
-		"iat": time.Now().Unix(),
+// refreshTokenUse marks refresh tokens, so they can't be used as access
+// tokens. Refresh tokens issued before the claim was added don't have it.
+const refreshTokenUse = "refresh"
+
+func (s *jwtService) GenerateRefreshToken(userID string, expiry time.Duration, extraClaims jwt.MapClaims) (string, error) {
+	if expiry <= 0 {
+		expiry = s.refreshExpiry
 	}
 
+	claims := jwt.MapClaims{}
+	for key, value := range extraClaims {
+		claims[key] = value
+	}
+	claims["token_use"] = refreshTokenUse
+	claims["sub"] = userID
+	claims["exp"] = time.Now().Add(expiry).Unix()
+	claims["iat"] = time.Now().Unix()
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(s.secret))
 }
 
 func (s *jwtService) ValidateAccessToken(token string) (jwt.MapClaims, error) {
-	return s.validateToken(token)
+	claims, err := s.validateSessionToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if IsRefreshToken(claims) {
+		return nil, errors.New("refresh tokens cannot be used for authentication")
+	}
+	return claims, nil
 }
 
 func (s *jwtService) ValidateRefreshToken(token string) (jwt.MapClaims, error) {
-	return s.validateToken(token)
+	return s.validateSessionToken(token)
+}
+
+func (s *jwtService) GenerateActionToken(subject, purpose string, expiry time.Duration, extraClaims jwt.MapClaims) (string, error) {
+	claims := jwt.MapClaims{}
+	for key, value := range extraClaims {
+		claims[key] = value
+	}
+	claims["sub"] = subject
+	claims["purpose"] = purpose
+	claims["exp"] = time.Now().Add(expiry).Unix()
+	claims["iat"] = time.Now().Unix()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(s.secret))
+}
+
+func (s *jwtService) ValidateActionToken(token, purpose string) (jwt.MapClaims, error) {
+	claims, err := s.validateToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if p, _ := claims["purpose"].(string); p != purpose {
+		return nil, errors.New("token was not issued for this purpose")
+	}
+	return claims, nil
+}
+
+func (s *jwtService) validateSessionToken(token string) (jwt.MapClaims, error) {
+	claims, err := s.validateToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := claims["purpose"]; ok {
+		return nil, errors.New("action tokens cannot be used for authentication")
+	}
+	return claims, nil
 }
 
 func (s *jwtService) validateToken(token string) (jwt.MapClaims, error) {
 	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
+			return nil, jwt.ErrSignatureInvalid
 		}
 		return []byte(s.secret), nil
-})
+	})
 
-if err != nil {
+	if err != nil {
 		return nil, err
-}
+	}
 
-if claims, ok := parsedToken.Claims.(jwt.MapClaims); ok && parsedToken.Valid {
+	if claims, ok := parsedToken.Claims.(jwt.MapClaims); ok && parsedToken.Valid {
 		// Verify the claims contain required fields
 		if _, ok := claims["sub"].(string); !ok {
-				return nil, errors.New("missing or invalid sub claim")
+			return nil, errors.New("missing or invalid sub claim")
 		}
 		return claims, nil
+	}
+
+	return nil, jwt.ErrInvalidKey
 }
 
-return nil, jwt.ErrInvalidKey
+// IsRefreshToken reports whether claims belong to a refresh token.
+func IsRefreshToken(claims jwt.MapClaims) bool {
+	use, _ := claims["token_use"].(string)
+	return use == refreshTokenUse
 }
 
 func (s *jwtService) GetAccessExpiry() time.Duration {
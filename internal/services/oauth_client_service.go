@@ -0,0 +1,471 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+const (
+	maxClientNameLength = 255
+	// maxClientAssertionLifetime bounds how long a client assertion's jti
+	// must be remembered to prevent replays.
+	maxClientAssertionLifetime = 10 * time.Minute
+
+	ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// clientAssertionAlgorithms are the signing algorithms accepted for
+// private_key_jwt client authentication.
+var clientAssertionAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// supportedGrantTypes lists the grant types clients can be registered for.
+// The values tell whether public clients may use the grant.
+var supportedGrantTypes = map[string]bool{
+	GrantTypeAuthorizationCode: true,
+	GrantTypeRefreshToken:      true,
+	GrantTypeClientCredentials: false,
+	GrantTypeDeviceCode:        true,
+	GrantTypeTokenExchange:     false,
+}
+
+// OAuthClientService manages the registry of OAuth clients.
+type OAuthClientService interface {
+	// CreateClient registers a client. For confidential clients it also
+	// returns the client secret, which is not stored and can't be shown again.
+	CreateClient(input models.OAuthClientInput) (*models.OAuthClient, string, error)
+	GetClient(clientID string) (*models.OAuthClient, error)
+	ListClients() ([]models.OAuthClient, error)
+	UpdateClient(clientID string, input models.OAuthClientInput) (*models.OAuthClient, error)
+	// DeleteClient deletes a client and revokes the tokens issued to it.
+	DeleteClient(ctx context.Context, clientID string) error
+	// RotateSecret issues a new secret for a confidential client. The
+	// current secret keeps working for the rollover period, so the client can
+	// be redeployed without downtime.
+	RotateSecret(clientID string) (*models.OAuthClient, string, error)
+	// RevokePreviousSecret ends a rollover early.
+	RevokePreviousSecret(clientID string) (*models.OAuthClient, error)
+	// AuthenticateClient returns the active client identified by auth if its
+	// secret or client assertion is valid. Public clients only send their
+	// client ID. Failures are utils.OAuthErrors.
+	AuthenticateClient(ctx context.Context, auth models.ClientAuthentication) (*models.OAuthClient, error)
+	// TokenLifetimes returns the lifetimes of tokens issued to client.
+	TokenLifetimes(client *models.OAuthClient) TokenLifetimes
+}
+
+type oauthClientService struct {
+	clientRepo   repositories.OAuthClientRepository
+	scopeService OAuthScopeService
+	jwtService   JWTService
+	redisService RedisService
+	// issuer is this server's base URL. Client assertions must be addressed
+	// to it or to its token endpoint.
+	issuer string
+	// secretRollover is how long a rotated secret keeps working.
+	secretRollover time.Duration
+}
+
+func NewOAuthClientService(
+	clientRepo repositories.OAuthClientRepository,
+	scopeService OAuthScopeService,
+	jwtService JWTService,
+	redisService RedisService,
+	issuer string,
+	secretRollover time.Duration,
+) OAuthClientService {
+	return &oauthClientService{
+		clientRepo:     clientRepo,
+		scopeService:   scopeService,
+		jwtService:     jwtService,
+		redisService:   redisService,
+		issuer:         strings.TrimSuffix(issuer, "/"),
+		secretRollover: secretRollover,
+	}
+}
+
+func (s *oauthClientService) CreateClient(input models.OAuthClientInput) (*models.OAuthClient, string, error) {
+	client := &models.OAuthClient{
+		Type:       models.ClientTypePublic,
+		GrantTypes: models.StringList{GrantTypeAuthorizationCode, GrantTypeRefreshToken},
+		Active:     true,
+	}
+	if input.Type != nil {
+		client.Type = *input.Type
+	}
+	if client.Type != models.ClientTypePublic && client.Type != models.ClientTypeConfidential {
+		return nil, "", utils.ErrInvalidInput.WithMessage("type must be public or confidential")
+	}
+	if err := s.applyInput(client, input); err != nil {
+		return nil, "", err
+	}
+
+	clientID, err := randomID()
+	if err != nil {
+		return nil, "", err
+	}
+	client.ClientID = clientID
+
+	// Clients with registered keys use private_key_jwt instead of a secret
+	var secret string
+	if client.Type == models.ClientTypeConfidential && len(client.JWKS) == 0 {
+		secret, err = generateClientSecret()
+		if err != nil {
+			return nil, "", err
+		}
+		client.SecretHash = hashClientSecret(secret)
+	}
+
+	client, err = s.clientRepo.Create(client)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+func (s *oauthClientService) GetClient(clientID string) (*models.OAuthClient, error) {
+	client, err := s.clientRepo.FindByClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, utils.ErrNotFound.WithMessage("client not found")
+	}
+	return client, nil
+}
+
+func (s *oauthClientService) ListClients() ([]models.OAuthClient, error) {
+	return s.clientRepo.List()
+}
+
+func (s *oauthClientService) UpdateClient(clientID string, input models.OAuthClientInput) (*models.OAuthClient, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if input.Type != nil && *input.Type != client.Type {
+		return nil, utils.ErrInvalidInput.WithMessage("the type of a client can't be changed")
+	}
+	if err := s.applyInput(client, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.clientRepo.Update(client); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (s *oauthClientService) DeleteClient(ctx context.Context, clientID string) error {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	// Revoke first, so a failure leaves the client in place to retry
+	if err := s.redisService.DeleteRefreshTokensOfClient(ctx, client.ClientID); err != nil {
+		return err
+	}
+	expiry := max(s.TokenLifetimes(client).Access, s.jwtService.GetAccessExpiry())
+	if err := s.redisService.SetRevocationWatermark(ctx, clientRevocationKey(client.ClientID), time.Now(), expiry); err != nil {
+		return err
+	}
+	return s.clientRepo.Delete(client.ID)
+}
+
+func (s *oauthClientService) RotateSecret(clientID string) (*models.OAuthClient, string, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, "", err
+	}
+	if client.Type != models.ClientTypeConfidential {
+		return nil, "", utils.ErrInvalidInput.WithMessage("public clients have no secret")
+	}
+
+	secret, err := generateClientSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// At most two secrets are valid: rotating again during a rollover ends
+	// the older one
+	expiresAt := time.Now().Add(s.secretRollover)
+	client.PreviousSecretHash = client.SecretHash
+	client.PreviousSecretExpiresAt = &expiresAt
+	client.SecretHash = hashClientSecret(secret)
+
+	if err := s.clientRepo.Update(client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+func (s *oauthClientService) RevokePreviousSecret(clientID string) (*models.OAuthClient, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	client.PreviousSecretHash = ""
+	client.PreviousSecretExpiresAt = nil
+	if err := s.clientRepo.Update(client); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (s *oauthClientService) AuthenticateClient(ctx context.Context, auth models.ClientAuthentication) (*models.OAuthClient, error) {
+	clientID := auth.ClientID
+	usesAssertion := auth.ClientAssertion != "" || auth.ClientAssertionType != ""
+	if usesAssertion {
+		if auth.ClientAssertionType != ClientAssertionTypeJWTBearer {
+			return nil, utils.ErrOAuthInvalidRequest.WithDescription("unsupported client_assertion_type")
+		}
+		if auth.ClientSecret != "" {
+			return nil, utils.ErrOAuthInvalidRequest.WithDescription("multiple client authentication methods used")
+		}
+
+		// The client ID is optional, the assertion's subject names the client
+		subject, err := assertionSubject(auth.ClientAssertion)
+		if err != nil || (clientID != "" && clientID != subject) {
+			return nil, utils.ErrOAuthInvalidClient.WithDescription("invalid client assertion")
+		}
+		clientID = subject
+	}
+	if clientID == "" {
+		return nil, utils.ErrOAuthInvalidRequest.WithDescription("client_id is required")
+	}
+
+	client, err := s.clientRepo.FindByClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil || !client.Active {
+		return nil, utils.ErrOAuthInvalidClient.WithDescription("unknown client")
+	}
+
+	switch {
+	case client.Type == models.ClientTypePublic:
+		if usesAssertion || auth.ClientSecret != "" {
+			return nil, utils.ErrOAuthInvalidClient.WithDescription("public clients can't authenticate")
+		}
+	case usesAssertion:
+		if err := s.verifyClientAssertion(ctx, client, auth.ClientAssertion); err != nil {
+			return nil, err
+		}
+	case !verifyClientSecret(client, auth.ClientSecret):
+		return nil, utils.ErrOAuthInvalidClient.WithDescription("client authentication failed")
+	}
+	return client, nil
+}
+
+// verifyClientAssertion checks a private_key_jwt assertion (RFC 7523) signed
+// with one of the client's registered keys. Each assertion can only be used
+// once.
+func (s *oauthClientService) verifyClientAssertion(ctx context.Context, client *models.OAuthClient, assertion string) error {
+	invalid := utils.ErrOAuthInvalidClient.WithDescription("invalid client assertion")
+	if len(client.JWKS) == 0 {
+		return utils.ErrOAuthInvalidClient.WithDescription("client has no registered keys")
+	}
+	keys, err := utils.ParseJWKSet(client.JWKS)
+	if err != nil {
+		return utils.ErrOAuthInvalidClient.WithDescription("client has no usable keys")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(assertion, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return keys.Find(kid)
+	},
+		jwt.WithValidMethods(clientAssertionAlgorithms),
+		jwt.WithIssuer(client.ClientID),
+		jwt.WithSubject(client.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return invalid
+	}
+
+	audience, _ := claims.GetAudience()
+	addressedToUs := false
+	for _, aud := range audience {
+		if aud == s.issuer || aud == s.issuer+"/oauth/token" {
+			addressedToUs = true
+		}
+	}
+	if !addressedToUs {
+		return invalid
+	}
+
+	exp, _ := claims.GetExpirationTime()
+	ttl := time.Until(exp.Time)
+	jti, _ := claims["jti"].(string)
+	if jti == "" || ttl > maxClientAssertionLifetime {
+		return invalid
+	}
+	firstUse, err := s.redisService.MarkClientAssertionUsed(ctx, client.ClientID, jti, ttl)
+	if err != nil {
+		return err
+	}
+	if !firstUse {
+		return utils.ErrOAuthInvalidClient.WithDescription("client assertion has already been used")
+	}
+	return nil
+}
+
+func (s *oauthClientService) TokenLifetimes(client *models.OAuthClient) TokenLifetimes {
+	return TokenLifetimes{
+		Access:  time.Duration(client.AccessTokenLifetime) * time.Second,
+		Refresh: time.Duration(client.RefreshTokenLifetime) * time.Second,
+	}
+}
+
+// applyInput validates input and copies it onto client.
+func (s *oauthClientService) applyInput(client *models.OAuthClient, input models.OAuthClientInput) error {
+	if input.Name != nil {
+		client.Name = strings.TrimSpace(*input.Name)
+	}
+	if client.Name == "" || len(client.Name) > maxClientNameLength {
+		return utils.ErrInvalidInput.WithMessagef("name must be 1 to %d characters", maxClientNameLength)
+	}
+
+	if input.FirstParty != nil {
+		client.FirstParty = *input.FirstParty
+	}
+
+	if input.LogoURL != nil {
+		if *input.LogoURL != "" && !utils.IsImageURLValid(*input.LogoURL) {
+			return utils.ErrInvalidInput.WithMessage("logo_url must be an http or https URL")
+		}
+		client.LogoURL = *input.LogoURL
+	}
+
+	if input.JWKS != nil {
+		if len(*input.JWKS) > 0 {
+			if client.Type != models.ClientTypeConfidential {
+				return utils.ErrInvalidInput.WithMessage("only confidential clients can register keys")
+			}
+			if _, err := utils.ParseJWKSet(*input.JWKS); err != nil {
+				return utils.ErrInvalidInput.WithMessagef("invalid jwks: %v", err)
+			}
+		}
+		client.JWKS = *input.JWKS
+	}
+
+	if input.RedirectURIs != nil {
+		for _, uri := range *input.RedirectURIs {
+			if !utils.IsRedirectURIValid(uri) {
+				return utils.ErrInvalidInput.WithMessagef("invalid redirect URI %q", uri)
+			}
+		}
+		client.RedirectURIs = models.StringList(*input.RedirectURIs)
+	}
+
+	if input.GrantTypes != nil {
+		for _, grantType := range *input.GrantTypes {
+			publicAllowed, ok := supportedGrantTypes[grantType]
+			if !ok {
+				return utils.ErrInvalidInput.WithMessagef("unsupported grant type %q", grantType)
+			}
+			if !publicAllowed && client.Type == models.ClientTypePublic {
+				return utils.ErrInvalidInput.WithMessagef("public clients can't use the %s grant", grantType)
+			}
+		}
+		client.GrantTypes = models.StringList(*input.GrantTypes)
+	}
+	if client.GrantTypes.Contains(GrantTypeAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		return utils.ErrInvalidInput.WithMessage("at least one redirect URI is required for the authorization_code grant")
+	}
+
+	if input.Scopes != nil {
+		if err := s.scopeService.Validate(*input.Scopes); err != nil {
+			return err
+		}
+		client.Scopes = models.StringList(*input.Scopes)
+	}
+
+	if input.ExchangeAudiences != nil {
+		for _, audience := range *input.ExchangeAudiences {
+			if audience == "" || len(audience) > maxClientNameLength || strings.ContainsAny(audience, " \t\n") {
+				return utils.ErrInvalidInput.WithMessagef("invalid exchange audience %q", audience)
+			}
+		}
+		client.ExchangeAudiences = models.StringList(*input.ExchangeAudiences)
+	}
+	if input.ExchangeImpersonation != nil {
+		client.ExchangeImpersonation = *input.ExchangeImpersonation
+	}
+
+	// Revocation state is only kept for the default lifetimes, so clients
+	// can shorten them but not extend them
+	if input.AccessTokenLifetime != nil {
+		client.AccessTokenLifetime = *input.AccessTokenLifetime
+	}
+	if max := int(s.jwtService.GetAccessExpiry().Seconds()); client.AccessTokenLifetime < 0 || client.AccessTokenLifetime > max {
+		return utils.ErrInvalidInput.WithMessagef("access_token_lifetime must be 0 to %d seconds", max)
+	}
+	if input.RefreshTokenLifetime != nil {
+		client.RefreshTokenLifetime = *input.RefreshTokenLifetime
+	}
+	if max := int(s.jwtService.GetRefreshExpiry().Seconds()); client.RefreshTokenLifetime < 0 || client.RefreshTokenLifetime > max {
+		return utils.ErrInvalidInput.WithMessagef("refresh_token_lifetime must be 0 to %d seconds", max)
+	}
+
+	if input.Active != nil {
+		client.Active = *input.Active
+	}
+	return nil
+}
+
+// assertionSubject reads the subject of a client assertion before its
+// signature can be checked, to find the client and its keys.
+func assertionSubject(assertion string) (string, error) {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(assertion, claims); err != nil {
+		return "", err
+	}
+	return claims.GetSubject()
+}
+
+func generateClientSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashClientSecret hashes a generated secret. Secrets are random and long,
+// so a fast hash is enough, unlike for passwords.
+func hashClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyClientSecret checks secret against the client's current secret and,
+// during a rollover, its previous one.
+func verifyClientSecret(client *models.OAuthClient, secret string) bool {
+	if secretMatches(secret, client.SecretHash) {
+		return true
+	}
+	return client.PreviousSecretExpiresAt != nil &&
+		time.Now().Before(*client.PreviousSecretExpiresAt) &&
+		secretMatches(secret, client.PreviousSecretHash)
+}
+
+// secretMatches compares secret with a stored hash in constant time.
+func secretMatches(secret, hash string) bool {
+	if secret == "" || hash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashClientSecret(secret)), []byte(hash)) == 1
+}
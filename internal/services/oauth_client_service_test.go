@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+// memoryClients is an OAuthClientRepository over a map keyed by client ID.
+type memoryClients struct {
+	repositories.OAuthClientRepository
+	clients map[string]*models.OAuthClient
+}
+
+func (r *memoryClients) FindByClientID(clientID string) (*models.OAuthClient, error) {
+	return r.clients[clientID], nil
+}
+
+func (r *memoryClients) Update(client *models.OAuthClient) error {
+	r.clients[client.ClientID] = client
+	return nil
+}
+
+func (r *memoryClients) Delete(id string) error {
+	for clientID, client := range r.clients {
+		if client.ID == id {
+			delete(r.clients, clientID)
+		}
+	}
+	return nil
+}
+
+// newTestOAuthClientService returns an oauthClientService for the clients,
+// sharing the fakes of s.
+func newTestOAuthClientService(s *oauthService, clients ...*models.OAuthClient) *oauthClientService {
+	repo := &memoryClients{clients: map[string]*models.OAuthClient{}}
+	for _, client := range clients {
+		repo.clients[client.ClientID] = client
+	}
+	return &oauthClientService{
+		clientRepo:     repo,
+		jwtService:     s.jwtService,
+		redisService:   s.redisService,
+		secretRollover: time.Hour,
+	}
+}
+
+func TestDeleteClientRevokesTokens(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestOAuthService(t)
+	clients := newTestOAuthClientService(s,
+		&models.OAuthClient{ID: "1", ClientID: "client-1", Active: true},
+		&models.OAuthClient{ID: "2", ClientID: "client-2", Active: true},
+	)
+	deleted := issueClientSession(t, s, "client-1")
+	kept := issueClientSession(t, s, "client-2")
+
+	if err := clients.DeleteClient(ctx, "client-1"); err != nil {
+		t.Fatal(err)
+	}
+	if client, _ := clients.clientRepo.FindByClientID("client-1"); client != nil {
+		t.Error("client was not deleted")
+	}
+
+	if _, err := s.authService.ValidateAccessToken(ctx, deleted.AccessToken); !errors.Is(err, utils.ErrTokenRevoked) {
+		t.Errorf("access token: err = %v, want %v", err, utils.ErrTokenRevoked)
+	}
+	if _, err := s.authService.ValidateRefreshToken(ctx, deleted.RefreshToken); err == nil {
+		t.Error("refresh token still works")
+	}
+	if _, err := s.authService.ValidateAccessToken(ctx, kept.AccessToken); err != nil {
+		t.Errorf("access token of another client: %v", err)
+	}
+	if _, err := s.authService.ValidateRefreshToken(ctx, kept.RefreshToken); err != nil {
+		t.Errorf("refresh token of another client: %v", err)
+	}
+}
+
+func TestRotateSecret(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestOAuthService(t)
+	client := &models.OAuthClient{ClientID: "client-1", Type: models.ClientTypeConfidential, Active: true}
+	clients := newTestOAuthClientService(s, client)
+	authenticate := func(secret string) error {
+		_, err := clients.AuthenticateClient(ctx, models.ClientAuthentication{ClientID: "client-1", ClientSecret: secret})
+		return err
+	}
+
+	_, oldSecret, err := clients.RotateSecret("client-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, newSecret, err := clients.RotateSecret("client-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both secrets work until the rollover deadline
+	if err := authenticate(newSecret); err != nil {
+		t.Errorf("new secret: %v", err)
+	}
+	if err := authenticate(oldSecret); err != nil {
+		t.Errorf("old secret before the deadline: %v", err)
+	}
+
+	expired := time.Now().Add(-time.Second)
+	client.PreviousSecretExpiresAt = &expired
+	if err := authenticate(oldSecret); !errors.Is(err, utils.ErrOAuthInvalidClient) {
+		t.Errorf("old secret after the deadline: err = %v, want invalid_client", err)
+	}
+	if err := authenticate(newSecret); err != nil {
+		t.Errorf("new secret after the deadline: %v", err)
+	}
+
+	// Revoking ends the rollover early
+	if _, _, err := clients.RotateSecret("client-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := authenticate(newSecret); err != nil {
+		t.Errorf("previous secret before revoking it: %v", err)
+	}
+	if _, err := clients.RevokePreviousSecret("client-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := authenticate(newSecret); !errors.Is(err, utils.ErrOAuthInvalidClient) {
+		t.Errorf("revoked previous secret: err = %v, want invalid_client", err)
+	}
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+// OAuthConsentService keeps track of which scopes users have granted to
+// OAuth clients.
+type OAuthConsentService interface {
+	// Covers reports whether the user has already consented to the client
+	// getting scope. First-party clients need no consent.
+	Covers(userID string, client *models.OAuthClient, scope string) (bool, error)
+	// Prompt describes what the user is asked to consent to.
+	Prompt(client *models.OAuthClient, scope string) (*models.ConsentPrompt, error)
+	// Grant adds scope to the user's consent for the client.
+	Grant(userID, clientID, scope string) error
+	ListConsents(userID string) ([]models.UserConsent, error)
+	// RevokeConsent removes the user's consent and ends the client's session
+	// for the user, including its access tokens.
+	RevokeConsent(ctx context.Context, userID, clientID string) error
+}
+
+type oauthConsentService struct {
+	consentRepo  repositories.OAuthConsentRepository
+	clientRepo   repositories.OAuthClientRepository
+	scopeService OAuthScopeService
+	authService  AuthService
+	auditService AuditService
+}
+
+func NewOAuthConsentService(
+	consentRepo repositories.OAuthConsentRepository,
+	clientRepo repositories.OAuthClientRepository,
+	scopeService OAuthScopeService,
+	authService AuthService,
+	auditService AuditService,
+) OAuthConsentService {
+	return &oauthConsentService{
+		consentRepo:  consentRepo,
+		clientRepo:   clientRepo,
+		scopeService: scopeService,
+		authService:  authService,
+		auditService: auditService,
+	}
+}
+
+func (s *oauthConsentService) Covers(userID string, client *models.OAuthClient, scope string) (bool, error) {
+	if client.FirstParty {
+		return true, nil
+	}
+
+	consent, err := s.consentRepo.Find(userID, client.ClientID)
+	if err != nil || consent == nil {
+		return false, err
+	}
+	for _, requested := range strings.Fields(scope) {
+		if !consent.Scopes.Contains(requested) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s *oauthConsentService) Prompt(client *models.OAuthClient, scope string) (*models.ConsentPrompt, error) {
+	scopes, err := s.scopeService.Describe(strings.Fields(scope))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ConsentPrompt{
+		ClientID:   client.ClientID,
+		ClientName: client.Name,
+		LogoURL:    client.LogoURL,
+		Scopes:     scopes,
+	}, nil
+}
+
+func (s *oauthConsentService) Grant(userID, clientID, scope string) error {
+	consent, err := s.consentRepo.Find(userID, clientID)
+	if err != nil {
+		return err
+	}
+	if consent == nil {
+		consent = &models.OAuthConsent{UserID: userID, ClientID: clientID, Scopes: models.StringList{}}
+	}
+
+	for _, granted := range strings.Fields(scope) {
+		if !consent.Scopes.Contains(granted) {
+			consent.Scopes = append(consent.Scopes, granted)
+		}
+	}
+	return s.consentRepo.Save(consent)
+}
+
+func (s *oauthConsentService) ListConsents(userID string) ([]models.UserConsent, error) {
+	consents, err := s.consentRepo.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.UserConsent, 0, len(consents))
+	for _, consent := range consents {
+		client, err := s.clientRepo.FindByClientID(consent.ClientID)
+		if err != nil {
+			return nil, err
+		}
+		if client == nil {
+			continue
+		}
+		scopes, err := s.scopeService.Describe(consent.Scopes)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, models.UserConsent{
+			ClientID:   client.ClientID,
+			ClientName: client.Name,
+			LogoURL:    client.LogoURL,
+			Scopes:     scopes,
+			GrantedAt:  consent.CreatedAt,
+			UpdatedAt:  consent.UpdatedAt,
+		})
+	}
+	return result, nil
+}
+
+func (s *oauthConsentService) RevokeConsent(ctx context.Context, userID, clientID string) error {
+	consent, err := s.consentRepo.Find(userID, clientID)
+	if err != nil {
+		return err
+	}
+	if consent == nil {
+		return utils.ErrNotFound.WithMessage("consent not found")
+	}
+
+	if err := s.consentRepo.Delete(userID, clientID); err != nil {
+		return err
+	}
+	if err := s.authService.RevokeClientSession(ctx, userID, clientID); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, userID, models.AuditOAuthConsentRevoked, models.JSONMap{"client_id": clientID})
+	return nil
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+const maxScopeDescriptionLength = 1000
+
+// defaultScopes are the built-in OpenID Connect scopes.
+var defaultScopes = map[string]string{
+	ScopeOpenID:  "Sign you in",
+	ScopeProfile: "View your name, username, picture, locale and time zone",
+	ScopeEmail:   "View your email address",
+}
+
+// OAuthScopeService manages the registry of scopes OAuth clients can be
+// allowed to request.
+type OAuthScopeService interface {
+	ListScopes() ([]models.OAuthScope, error)
+	CreateScope(name, description string) (*models.OAuthScope, error)
+	// DeleteScope fails while any client may still request the scope.
+	DeleteScope(name string) error
+	// Validate returns a utils.AppError naming the first scope that isn't
+	// registered.
+	Validate(names []string) error
+	// Describe returns the registered scopes among names, in the order
+	// given.
+	Describe(names []string) ([]models.OAuthScope, error)
+	// SeedDefaults registers the built-in scopes if they are missing.
+	SeedDefaults() error
+}
+
+type oauthScopeService struct {
+	scopeRepo  repositories.OAuthScopeRepository
+	clientRepo repositories.OAuthClientRepository
+}
+
+func NewOAuthScopeService(
+	scopeRepo repositories.OAuthScopeRepository,
+	clientRepo repositories.OAuthClientRepository,
+) OAuthScopeService {
+	return &oauthScopeService{
+		scopeRepo:  scopeRepo,
+		clientRepo: clientRepo,
+	}
+}
+
+func (s *oauthScopeService) ListScopes() ([]models.OAuthScope, error) {
+	return s.scopeRepo.List()
+}
+
+func (s *oauthScopeService) CreateScope(name, description string) (*models.OAuthScope, error) {
+	if !isScopeTokenValid(name) {
+		return nil, utils.ErrInvalidInput.WithMessage("invalid scope name")
+	}
+	description = strings.TrimSpace(description)
+	if len(description) > maxScopeDescriptionLength {
+		return nil, utils.ErrInvalidInput.WithMessagef("description must be at most %d characters", maxScopeDescriptionLength)
+	}
+
+	existing, err := s.scopeRepo.FindByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, utils.ErrConflict.WithMessage("scope already exists")
+	}
+
+	return s.scopeRepo.Create(&models.OAuthScope{Name: name, Description: description})
+}
+
+func (s *oauthScopeService) DeleteScope(name string) error {
+	scope, err := s.scopeRepo.FindByName(name)
+	if err != nil {
+		return err
+	}
+	if scope == nil {
+		return utils.ErrNotFound.WithMessage("scope not found")
+	}
+
+	inUse, err := s.clientRepo.UsesScope(name)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return utils.ErrConflict.WithMessage("scope is still allowed for some clients")
+	}
+
+	return s.scopeRepo.Delete(scope.ID)
+}
+
+func (s *oauthScopeService) Validate(names []string) error {
+	scopes, err := s.scopeRepo.FindByNames(names)
+	if err != nil {
+		return err
+	}
+	registered := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		registered[scope.Name] = true
+	}
+	for _, name := range names {
+		if !registered[name] {
+			return utils.ErrInvalidInput.WithMessagef("unknown scope %q", name)
+		}
+	}
+	return nil
+}
+
+func (s *oauthScopeService) Describe(names []string) ([]models.OAuthScope, error) {
+	scopes, err := s.scopeRepo.FindByNames(names)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]models.OAuthScope, len(scopes))
+	for _, scope := range scopes {
+		byName[scope.Name] = scope
+	}
+
+	described := make([]models.OAuthScope, 0, len(names))
+	for _, name := range names {
+		if scope, ok := byName[name]; ok {
+			described = append(described, scope)
+		}
+	}
+	return described, nil
+}
+
+func (s *oauthScopeService) SeedDefaults() error {
+	names := make([]string, 0, len(defaultScopes))
+	for name := range defaultScopes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	existing, err := s.scopeRepo.FindByNames(names)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool, len(existing))
+	for _, scope := range existing {
+		have[scope.Name] = true
+	}
+
+	for _, name := range names {
+		if have[name] {
+			continue
+		}
+		if _, err := s.scopeRepo.Create(&models.OAuthScope{Name: name, Description: defaultScopes[name]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isScopeTokenValid checks a single scope value against the characters
+// RFC 6749 section 3.3 allows.
+func isScopeTokenValid(scope string) bool {
+	if scope == "" {
+		return false
+	}
+	for _, r := range scope {
+		if r < 0x21 || r > 0x7e || r == '"' || r == '\\' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,703 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+// OAuth grant types and PKCE methods supported by the token endpoint.
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	PKCEMethodS256 = "S256"
+)
+
+// Token type identifiers of the token exchange grant (RFC 8693). Access
+// tokens are JWTs, so either identifier is accepted for them.
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// PKCE code verifiers are 43 to 128 unreserved characters (RFC 7636).
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+// OAuthService implements the OAuth 2.0 authorization code grant with
+// mandatory PKCE, the client credentials and token exchange grants and the
+// token endpoint side of the device authorization grant. Grants for the openid scope also
+// return an OpenID Connect ID token.
+type OAuthService interface {
+	// CheckAuthorizationRequest validates req before the user signs in. An
+	// unknown client or redirect URI is returned as a utils.AppError and the
+	// user must not be redirected. Other problems are reported to the client:
+	// they are returned as a URL to redirect the user to.
+	CheckAuthorizationRequest(req *models.AuthorizationRequest) (errorRedirect string, err error)
+	// Authorize issues an authorization code for the signed-in user and
+	// returns the URL to redirect the user to. Errors are handled as in
+	// CheckAuthorizationRequest. If the user hasn't consented to the client
+	// getting the requested scope, no code is issued and the consent prompt
+	// is returned instead; the request is then repeated with req.Consent
+	// set to the user's answer.
+	Authorize(ctx context.Context, userID string, authTime int64, amr []string, req *models.AuthorizationRequest) (string, *models.ConsentPrompt, error)
+	// Token handles a token endpoint request from the client authenticated
+	// by auth. Failures are utils.OAuthErrors.
+	Token(ctx context.Context, auth models.ClientAuthentication, req *models.TokenRequest) (*models.OAuthTokenResponse, error)
+	// Introspect describes an access or refresh token to the confidential
+	// client authenticated by auth (RFC 7662). Tokens that don't validate
+	// are reported as inactive; only client authentication failures are
+	// returned as errors.
+	Introspect(ctx context.Context, auth models.ClientAuthentication, req *models.IntrospectionRequest) (*models.IntrospectionResponse, error)
+	// Revoke revokes a token issued to the client authenticated by auth
+	// (RFC 7009). Revoking a refresh token ends its session. Tokens that are
+	// already invalid are ignored.
+	Revoke(ctx context.Context, auth models.ClientAuthentication, req *models.TokenRevocationRequest) error
+}
+
+type oauthService struct {
+	clientService  OAuthClientService
+	authService    AuthService
+	oidcService    OIDCService
+	deviceService  DeviceAuthorizationService
+	consentService OAuthConsentService
+	jwtService     JWTService
+	redisService   RedisService
+	auditService   AuditService
+	codeExpiry     time.Duration
+}
+
+func NewOAuthService(
+	clientService OAuthClientService,
+	authService AuthService,
+	oidcService OIDCService,
+	deviceService DeviceAuthorizationService,
+	consentService OAuthConsentService,
+	jwtService JWTService,
+	redisService RedisService,
+	auditService AuditService,
+	codeExpiry time.Duration,
+) OAuthService {
+	return &oauthService{
+		clientService:  clientService,
+		authService:    authService,
+		oidcService:    oidcService,
+		deviceService:  deviceService,
+		consentService: consentService,
+		jwtService:     jwtService,
+		redisService:   redisService,
+		auditService:   auditService,
+		codeExpiry:     codeExpiry,
+	}
+}
+
+func (s *oauthService) CheckAuthorizationRequest(req *models.AuthorizationRequest) (string, error) {
+	_, redirectURI, err := s.checkAuthorizationRequest(req)
+	return s.authorizationError(redirectURI, req.State, err)
+}
+
+func (s *oauthService) Authorize(ctx context.Context, userID string, authTime int64, amr []string, req *models.AuthorizationRequest) (string, *models.ConsentPrompt, error) {
+	client, redirectURI, err := s.checkAuthorizationRequest(req)
+	if err != nil {
+		redirectTo, err := s.authorizationError(redirectURI, req.State, err)
+		return redirectTo, nil, err
+	}
+
+	scope := normalizeScope(req.Scope)
+	switch req.Consent {
+	case models.ConsentDeny:
+		redirectTo, err := s.authorizationError(redirectURI, req.State, utils.ErrOAuthAccessDenied.WithDescription("the user denied the request"))
+		return redirectTo, nil, err
+	case models.ConsentGrant:
+		if err := s.consentService.Grant(userID, client.ClientID, scope); err != nil {
+			return "", nil, err
+		}
+	case "":
+		covered, err := s.consentService.Covers(userID, client, scope)
+		if err != nil {
+			return "", nil, err
+		}
+		if !covered {
+			prompt, err := s.consentService.Prompt(client, scope)
+			return "", prompt, err
+		}
+	default:
+		return "", nil, utils.ErrInvalidInput.WithMessage("consent must be grant or deny")
+	}
+
+	code, err := randomID()
+	if err != nil {
+		return "", nil, err
+	}
+	value, err := json.Marshal(models.AuthorizationCode{
+		ClientID:        client.ClientID,
+		UserID:          userID,
+		RedirectURI:     redirectURI,
+		RedirectURISent: req.RedirectURI != "",
+		Scope:           scope,
+		CodeChallenge:   req.CodeChallenge,
+		AuthTime:        authTime,
+		AMR:             amr,
+		Nonce:           req.Nonce,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.redisService.StoreAuthorizationCode(ctx, code, string(value), s.codeExpiry); err != nil {
+		return "", nil, fmt.Errorf("failed to store authorization code: %w", err)
+	}
+
+	s.auditService.Record(ctx, userID, models.AuditOAuthAuthorized, models.JSONMap{
+		"client_id": client.ClientID,
+		"scope":     scope,
+	})
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return redirectWithParams(redirectURI, params), nil, nil
+}
+
+// checkAuthorizationRequest returns the client and the redirect URI to
+// answer on. err is a utils.AppError when there is no redirect URI to report
+// it to, and a utils.OAuthError otherwise.
+func (s *oauthService) checkAuthorizationRequest(req *models.AuthorizationRequest) (*models.OAuthClient, string, error) {
+	if req.ClientID == "" {
+		return nil, "", utils.ErrInvalidInput.WithMessage("client_id is required")
+	}
+	client, err := s.clientService.GetClient(req.ClientID)
+	if errors.Is(err, utils.ErrNotFound) || (err == nil && !client.Active) {
+		return nil, "", utils.ErrInvalidInput.WithMessage("unknown client")
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The redirect URI may only be omitted when just one is registered
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !client.RedirectURIs.Contains(redirectURI) {
+		return nil, "", utils.ErrInvalidInput.WithMessage("redirect_uri is not registered for this client")
+	}
+
+	if req.ResponseType != "code" {
+		return nil, redirectURI, utils.ErrOAuthUnsupportedResponseType.WithDescription("response_type must be code")
+	}
+	if !client.GrantTypes.Contains(GrantTypeAuthorizationCode) {
+		return nil, redirectURI, utils.ErrOAuthUnauthorizedClient
+	}
+	for _, scope := range strings.Fields(req.Scope) {
+		if !client.Scopes.Contains(scope) {
+			return nil, redirectURI, utils.ErrOAuthInvalidScope.WithDescription("scope " + scope + " is not allowed for this client")
+		}
+	}
+	if req.CodeChallenge == "" {
+		return nil, redirectURI, utils.ErrOAuthInvalidRequest.WithDescription("code_challenge is required")
+	}
+	if req.CodeChallengeMethod != PKCEMethodS256 {
+		return nil, redirectURI, utils.ErrOAuthInvalidRequest.WithDescription("code_challenge_method must be S256")
+	}
+	// A base64url encoded SHA-256 digest without padding
+	if len(req.CodeChallenge) != 43 {
+		return nil, redirectURI, utils.ErrOAuthInvalidRequest.WithDescription("invalid code_challenge")
+	}
+
+	return client, redirectURI, nil
+}
+
+// authorizationError turns an OAuth error into a redirect back to the
+// client. Other errors are returned as they are.
+func (s *oauthService) authorizationError(redirectURI, state string, err error) (string, error) {
+	var oauthErr *utils.OAuthError
+	if err == nil || !errors.As(err, &oauthErr) {
+		return "", err
+	}
+
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+	return redirectWithParams(redirectURI, params), nil
+}
+
+func (s *oauthService) Token(ctx context.Context, auth models.ClientAuthentication, req *models.TokenRequest) (*models.OAuthTokenResponse, error) {
+	if req.GrantType == "" {
+		return nil, utils.ErrOAuthInvalidRequest.WithDescription("grant_type is required")
+	}
+	if _, ok := supportedGrantTypes[req.GrantType]; !ok {
+		return nil, utils.ErrOAuthUnsupportedGrantType
+	}
+
+	client, err := s.clientService.AuthenticateClient(ctx, auth)
+	if err != nil {
+		return nil, err
+	}
+	if !client.GrantTypes.Contains(req.GrantType) {
+		return nil, utils.ErrOAuthUnauthorizedClient
+	}
+
+	switch req.GrantType {
+	case GrantTypeAuthorizationCode:
+		return s.exchangeCode(ctx, client, req)
+	case GrantTypeRefreshToken:
+		return s.refresh(ctx, client, req)
+	case GrantTypeClientCredentials:
+		return s.clientCredentials(client, req)
+	case GrantTypeDeviceCode:
+		return s.redeemDeviceCode(ctx, client, req)
+	case GrantTypeTokenExchange:
+		return s.exchangeToken(ctx, client, req)
+	default:
+		return nil, utils.ErrOAuthUnsupportedGrantType
+	}
+}
+
+func (s *oauthService) exchangeCode(ctx context.Context, client *models.OAuthClient, req *models.TokenRequest) (*models.OAuthTokenResponse, error) {
+	if req.Code == "" {
+		return nil, utils.ErrOAuthInvalidRequest.WithDescription("code is required")
+	}
+	if !codeVerifierPattern.MatchString(req.CodeVerifier) {
+		return nil, utils.ErrOAuthInvalidRequest.WithDescription("code_verifier is missing or malformed")
+	}
+
+	// Consuming the code up front makes it single use even when the
+	// exchange fails
+	value, err := s.redisService.ConsumeAuthorizationCode(ctx, req.Code)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, utils.ErrOAuthInvalidGrant.WithDescription("invalid or expired authorization code")
+	}
+	var code models.AuthorizationCode
+	if err := json.Unmarshal([]byte(value), &code); err != nil {
+		return nil, err
+	}
+
+	if code.ClientID != client.ClientID {
+		return nil, utils.ErrOAuthInvalidGrant.WithDescription("authorization code was issued to another client")
+	}
+	// redirect_uri is only required if the authorization request had one
+	// (RFC 6749 section 4.1.3), but must match whenever it is sent
+	if (code.RedirectURISent || req.RedirectURI != "") && code.RedirectURI != req.RedirectURI {
+		return nil, utils.ErrOAuthInvalidGrant.WithDescription("redirect_uri does not match the authorization request")
+	}
+	if !verifyCodeChallenge(code.CodeChallenge, req.CodeVerifier) {
+		return nil, utils.ErrOAuthInvalidGrant.WithDescription("code_verifier does not match the code challenge")
+	}
+
+	return s.issueUserTokens(ctx, client, &code)
+}
+
+func (s *oauthService) redeemDeviceCode(ctx context.Context, client *models.OAuthClient, req *models.TokenRequest) (*models.OAuthTokenResponse, error) {
+	code, err := s.deviceService.Redeem(ctx, client, req.DeviceCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueUserTokens(ctx, client, &models.AuthorizationCode{
+		ClientID: code.ClientID,
+		UserID:   code.UserID,
+		Scope:    code.Scope,
+		AuthTime: code.AuthTime,
+		AMR:      code.AMR,
+	})
+}
+
+// issueUserTokens starts the client's session for the user who approved
+// grant.
+func (s *oauthService) issueUserTokens(ctx context.Context, client *models.OAuthClient, grant *models.AuthorizationCode) (*models.OAuthTokenResponse, error) {
+	user, err := s.authService.GetUser(grant.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.Active {
+		return nil, utils.ErrOAuthInvalidGrant.WithDescription(utils.ErrAccountDisabled.Message)
+	}
+
+	lifetimes := s.clientService.TokenLifetimes(client)
+	tokens, err := s.authService.IssueClientTokens(ctx, user.ID, client.ClientID, grant.Scope, grant.AuthTime, grant.AMR, lifetimes)
+	if err != nil {
+		return nil, err
+	}
+	response := s.tokenResponse(tokens, grant.Scope, lifetimes)
+
+	if hasScope(grant.Scope, ScopeOpenID) {
+		response.IDToken, err = s.oidcService.IDToken(grant, tokens.AccessToken, lifetimes.Access)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign ID token: %w", err)
+		}
+	}
+	return response, nil
+}
+
+func (s *oauthService) refresh(ctx context.Context, client *models.OAuthClient, req *models.TokenRequest) (*models.OAuthTokenResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, utils.ErrOAuthInvalidRequest.WithDescription("refresh_token is required")
+	}
+
+	lifetimes := s.clientService.TokenLifetimes(client)
+	tokens, err := s.authService.RefreshClientToken(ctx, client.ClientID, req.RefreshToken, lifetimes)
+	if err != nil {
+		var appErr *utils.AppError
+		if errors.As(err, &appErr) {
+			return nil, utils.ErrOAuthInvalidGrant.WithDescription(appErr.Message)
+		}
+		return nil, err
+	}
+
+	// The new tokens keep the scope of the session
+	claims, err := s.jwtService.ValidateRefreshToken(tokens.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	scope, _ := claims["scope"].(string)
+	return s.tokenResponse(tokens, scope, lifetimes), nil
+}
+
+func (s *oauthService) Introspect(ctx context.Context, auth models.ClientAuthentication, req *models.IntrospectionRequest) (*models.IntrospectionResponse, error) {
+	client, err := s.clientService.AuthenticateClient(ctx, auth)
+	if err != nil {
+		return nil, err
+	}
+	if client.Type != models.ClientTypeConfidential {
+		return nil, utils.ErrOAuthInvalidClient.WithDescription("only confidential clients can introspect tokens")
+	}
+	if req.Token == "" {
+		return nil, utils.ErrOAuthInvalidRequest.WithDescription("token is required")
+	}
+
+	claims, tokenType, err := s.validateToken(ctx, req.Token, req.TokenTypeHint)
+	if err != nil {
+		var appErr *utils.AppError
+		if errors.As(err, &appErr) {
+			return &models.IntrospectionResponse{Active: false}, nil
+		}
+		return nil, err
+	}
+
+	response := &models.IntrospectionResponse{Active: true, TokenType: tokenType}
+	response.Scope, _ = claims["scope"].(string)
+	response.ClientID, _ = claims["client_id"].(string)
+	response.Sub, _ = claims["sub"].(string)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		response.Exp = exp.Unix()
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		response.Iat = iat.Unix()
+	}
+	return response, nil
+}
+
+func (s *oauthService) Revoke(ctx context.Context, auth models.ClientAuthentication, req *models.TokenRevocationRequest) error {
+	client, err := s.clientService.AuthenticateClient(ctx, auth)
+	if err != nil {
+		return err
+	}
+	if req.Token == "" {
+		return utils.ErrOAuthInvalidRequest.WithDescription("token is required")
+	}
+
+	claims, tokenType, err := s.validateToken(ctx, req.Token, req.TokenTypeHint)
+	if err != nil {
+		var appErr *utils.AppError
+		if errors.As(err, &appErr) {
+			return nil
+		}
+		return err
+	}
+
+	if clientID, _ := claims["client_id"].(string); clientID != client.ClientID {
+		return utils.ErrOAuthUnauthorizedClient.WithDescription("token was issued to another client")
+	}
+	userID := claims["sub"].(string)
+
+	if tokenType == models.TokenTypeHintRefreshToken {
+		if err := s.authService.RevokeClientSession(ctx, userID, client.ClientID); err != nil {
+			return err
+		}
+		s.auditService.Record(ctx, userID, models.AuditOAuthRevoked, models.JSONMap{"client_id": client.ClientID})
+		return nil
+	}
+
+	// Access tokens only need to stay blacklisted until they expire. Tokens
+	// without exp aren't issued here; blacklist them for as long as the
+	// ones that are.
+	expiry := s.jwtService.GetAccessExpiry()
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		expiry = time.Until(exp.Time)
+	}
+	return s.redisService.BlacklistToken(ctx, req.Token, expiry)
+}
+
+// validateToken validates an access or refresh token with the same checks
+// as when it is used, and returns its claims and type hint. hint only
+// decides which type is tried first for refresh tokens issued before they
+// were marked as such. Invalid tokens are reported as utils.AppErrors.
+func (s *oauthService) validateToken(ctx context.Context, token, hint string) (jwt.MapClaims, string, error) {
+	claims, err := s.jwtService.ValidateRefreshToken(token)
+	if err != nil {
+		return nil, "", utils.ErrInvalidToken
+	}
+
+	if IsRefreshToken(claims) || hint == models.TokenTypeHintRefreshToken {
+		refreshClaims, err := s.authService.ValidateRefreshToken(ctx, token)
+		if err == nil || IsRefreshToken(claims) {
+			return refreshClaims, models.TokenTypeHintRefreshToken, err
+		}
+	}
+
+	claims, err = s.authService.ValidateAccessToken(ctx, token)
+	return claims, models.TokenTypeHintAccessToken, err
+}
+
+// clientCredentials issues an access token to the client itself. The token
+// has no user and no refresh token.
+func (s *oauthService) clientCredentials(client *models.OAuthClient, req *models.TokenRequest) (*models.OAuthTokenResponse, error) {
+	scope := normalizeScope(req.Scope)
+	for _, requested := range strings.Fields(scope) {
+		if !client.Scopes.Contains(requested) {
+			return nil, utils.ErrOAuthInvalidScope.WithDescription("scope " + requested + " is not allowed for this client")
+		}
+		if isUserScope(requested) {
+			return nil, utils.ErrOAuthInvalidScope.WithDescription("scope " + requested + " requires a user")
+		}
+	}
+	// Without a requested scope the client gets everything it is allowed
+	if scope == "" {
+		var allowed []string
+		for _, s := range client.Scopes {
+			if !isUserScope(s) {
+				allowed = append(allowed, s)
+			}
+		}
+		scope = strings.Join(allowed, " ")
+	}
+
+	lifetimes := s.clientService.TokenLifetimes(client)
+	accessToken, err := s.jwtService.GenerateAccessToken(client.ClientID, lifetimes.Access, jwt.MapClaims{
+		"client_id": client.ClientID,
+		"scope":     scope,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.tokenResponse(&models.TokenPair{AccessToken: accessToken}, scope, lifetimes), nil
+}
+
+// exchangeToken trades a token for one with a narrower scope meant for one
+// of the client's exchange audiences (RFC 8693). The new token names who
+// acts on the subject's behalf in its act claim: the actor token's subject,
+// or the client itself unless it may impersonate users.
+func (s *oauthService) exchangeToken(ctx context.Context, client *models.OAuthClient, req *models.TokenRequest) (*models.OAuthTokenResponse, error) {
+	if req.SubjectToken == "" || !isExchangeTokenType(req.SubjectTokenType) {
+		return nil, utils.ErrOAuthInvalidRequest.WithDescription("subject_token must be an access token")
+	}
+	if (req.ActorToken == "" && req.ActorTokenType != "") || (req.ActorToken != "" && !isExchangeTokenType(req.ActorTokenType)) {
+		return nil, utils.ErrOAuthInvalidRequest.WithDescription("actor_token must be an access token")
+	}
+	if req.RequestedTokenType != "" && req.RequestedTokenType != TokenTypeAccessToken {
+		return nil, utils.ErrOAuthInvalidRequest.WithDescription("only access tokens can be requested")
+	}
+
+	subject, err := s.exchangedTokenClaims(ctx, req.SubjectToken)
+	if err != nil {
+		return nil, err
+	}
+	subjectID := subject["sub"].(string)
+
+	audience := req.Audience
+	if audience == "" && len(client.ExchangeAudiences) == 1 {
+		audience = client.ExchangeAudiences[0]
+	}
+	if audience == "" {
+		return nil, utils.ErrOAuthInvalidRequest.WithDescription("audience is required")
+	}
+	if !client.ExchangeAudiences.Contains(audience) {
+		return nil, utils.ErrOAuthInvalidTarget.WithDescription("audience " + audience + " is not allowed for this client")
+	}
+
+	// Exchanged tokens can only narrow the subject token's scope
+	var allowed []string
+	subjectScope, _ := subject["scope"].(string)
+	for _, scope := range client.Scopes {
+		if subjectScope == "" || hasScope(subjectScope, scope) {
+			allowed = append(allowed, scope)
+		}
+	}
+	scope := normalizeScope(req.Scope)
+	for _, requested := range strings.Fields(scope) {
+		if !models.StringList(allowed).Contains(requested) {
+			return nil, utils.ErrOAuthInvalidScope.WithDescription("scope " + requested + " is not allowed")
+		}
+	}
+	if scope == "" {
+		scope = strings.Join(allowed, " ")
+	}
+
+	claims := jwt.MapClaims{
+		"client_id": client.ClientID,
+		"aud":       audience,
+		"scope":     scope,
+	}
+	var act jwt.MapClaims
+	if req.ActorToken != "" {
+		actor, err := s.exchangedTokenClaims(ctx, req.ActorToken)
+		if err != nil {
+			return nil, err
+		}
+		act = jwt.MapClaims{"sub": actor["sub"]}
+	} else if !client.ExchangeImpersonation {
+		act = jwt.MapClaims{"sub": client.ClientID}
+	}
+	// Earlier actors of a delegated subject token stay in the chain
+	if priorAct, ok := subject["act"]; ok {
+		if act == nil {
+			claims["act"] = priorAct
+		} else {
+			act["act"] = priorAct
+		}
+	}
+	if act != nil {
+		claims["act"] = act
+	}
+
+	// Exchanged tokens never outlive the subject token
+	expiry := s.clientService.TokenLifetimes(client).Access
+	if expiry <= 0 {
+		expiry = s.jwtService.GetAccessExpiry()
+	}
+	if exp, err := subject.GetExpirationTime(); err == nil && exp != nil && time.Until(exp.Time) < expiry {
+		expiry = time.Until(exp.Time)
+	}
+
+	accessToken, err := s.jwtService.GenerateAccessToken(subjectID, expiry, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if IsUserToken(subject) {
+		s.auditService.Record(ctx, subjectID, models.AuditOAuthTokenExchanged, models.JSONMap{
+			"client_id": client.ClientID,
+			"audience":  audience,
+			"scope":     scope,
+			"act":       claims["act"],
+		})
+	}
+
+	response := s.tokenResponse(&models.TokenPair{AccessToken: accessToken}, scope, TokenLifetimes{Access: expiry})
+	response.IssuedTokenType = TokenTypeAccessToken
+	return response, nil
+}
+
+// exchangedTokenClaims validates a subject or actor token like any other
+// access token. Tokens of users that have since been disabled are rejected.
+func (s *oauthService) exchangedTokenClaims(ctx context.Context, token string) (jwt.MapClaims, error) {
+	claims, err := s.authService.ValidateAccessToken(ctx, token)
+	if err != nil {
+		var appErr *utils.AppError
+		if errors.As(err, &appErr) {
+			return nil, utils.ErrOAuthInvalidGrant.WithDescription(appErr.Message)
+		}
+		return nil, err
+	}
+
+	if IsUserToken(claims) {
+		user, err := s.authService.GetUser(claims["sub"].(string))
+		if err != nil {
+			return nil, err
+		}
+		if user == nil || !user.Active {
+			return nil, utils.ErrOAuthInvalidGrant.WithDescription(utils.ErrAccountDisabled.Message)
+		}
+	}
+	return claims, nil
+}
+
+func (s *oauthService) tokenResponse(tokens *models.TokenPair, scope string, lifetimes TokenLifetimes) *models.OAuthTokenResponse {
+	expiresIn := lifetimes.Access
+	if expiresIn <= 0 {
+		expiresIn = s.jwtService.GetAccessExpiry()
+	}
+	return &models.OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(expiresIn.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        scope,
+	}
+}
+
+// IsUserToken reports whether claims belong to a token issued for a user,
+// rather than to a client for itself (client credentials grant).
+func IsUserToken(claims jwt.MapClaims) bool {
+	clientID, _ := claims["client_id"].(string)
+	return clientID == "" || clientID != claims["sub"]
+}
+
+func isExchangeTokenType(tokenType string) bool {
+	return tokenType == TokenTypeAccessToken || tokenType == TokenTypeJWT
+}
+
+// isUserScope reports whether scope is an OpenID Connect scope, which only
+// makes sense for tokens issued on behalf of a user.
+func isUserScope(scope string) bool {
+	_, ok := scopeClaims[scope]
+	return ok || scope == ScopeOpenID
+}
+
+// verifyCodeChallenge checks an S256 code verifier against the challenge.
+func verifyCodeChallenge(challenge, verifier string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// normalizeScope removes duplicate and surplus whitespace from a
+// space-delimited scope list.
+func normalizeScope(scope string) string {
+	seen := map[string]bool{}
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return strings.Join(scopes, " ")
+}
+
+// redirectWithParams adds params to the query of uri, keeping any query the
+// redirect URI was registered with.
+func redirectWithParams(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
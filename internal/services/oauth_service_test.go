@@ -0,0 +1,541 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+const testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func testCodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// newTestOAuthService returns an oauthService backed by memory fakes, with
+// one active user, user-1.
+func newTestOAuthService(t *testing.T) (*oauthService, *memoryRedis) {
+	t.Helper()
+	redisService := newMemoryRedis()
+	jwtService := NewJWTService("test-secret", time.Minute, time.Hour)
+	users := newMemoryUsers(&models.User{ID: "user-1", Email: "user@example.com", Active: true})
+	authService := &authService{userRepo: users, jwtService: jwtService, redisService: redisService}
+
+	return &oauthService{
+		clientService: &oauthClientService{},
+		authService:   authService,
+		jwtService:    jwtService,
+		redisService:  redisService,
+		auditService:  discardAudit{},
+		codeExpiry:    time.Minute,
+	}, redisService
+}
+
+// storeCode issues an authorization code for grant.
+func storeCode(t *testing.T, redisService *memoryRedis, grant models.AuthorizationCode) string {
+	t.Helper()
+	value, err := json.Marshal(grant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := randomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redisService.StoreAuthorizationCode(context.Background(), code, string(value), time.Minute)
+	return code
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	challenge := testCodeChallenge(testCodeVerifier)
+	if !verifyCodeChallenge(challenge, testCodeVerifier) {
+		t.Error("matching verifier was rejected")
+	}
+	if verifyCodeChallenge(challenge, strings.Repeat("a", 43)) {
+		t.Error("wrong verifier was accepted")
+	}
+	// The RFC 7636 appendix B example
+	if !verifyCodeChallenge("E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", testCodeVerifier) {
+		t.Error("RFC 7636 example was rejected")
+	}
+}
+
+func TestExchangeCode(t *testing.T) {
+	client := &models.OAuthClient{ClientID: "client-1"}
+	grant := models.AuthorizationCode{
+		ClientID:        client.ClientID,
+		UserID:          "user-1",
+		RedirectURI:     "https://app.example.com/callback",
+		RedirectURISent: true,
+		Scope:           "profile",
+		CodeChallenge:   testCodeChallenge(testCodeVerifier),
+		AuthTime:        time.Now().Unix(),
+	}
+	withoutRedirectURI := grant
+	withoutRedirectURI.RedirectURISent = false
+	otherClient := grant
+	otherClient.ClientID = "client-2"
+
+	tests := []struct {
+		name    string
+		grant   models.AuthorizationCode
+		req     models.TokenRequest
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			grant: grant,
+			req:   models.TokenRequest{CodeVerifier: testCodeVerifier, RedirectURI: grant.RedirectURI},
+		},
+		{
+			name:    "wrong code verifier",
+			grant:   grant,
+			req:     models.TokenRequest{CodeVerifier: strings.Repeat("a", 43), RedirectURI: grant.RedirectURI},
+			wantErr: true,
+		},
+		{
+			name:    "malformed code verifier",
+			grant:   grant,
+			req:     models.TokenRequest{CodeVerifier: "short", RedirectURI: grant.RedirectURI},
+			wantErr: true,
+		},
+		{
+			name:    "redirect URI missing",
+			grant:   grant,
+			req:     models.TokenRequest{CodeVerifier: testCodeVerifier},
+			wantErr: true,
+		},
+		{
+			name:    "redirect URI mismatch",
+			grant:   grant,
+			req:     models.TokenRequest{CodeVerifier: testCodeVerifier, RedirectURI: "https://evil.example.com/callback"},
+			wantErr: true,
+		},
+		{
+			name:  "redirect URI not sent in either request",
+			grant: withoutRedirectURI,
+			req:   models.TokenRequest{CodeVerifier: testCodeVerifier},
+		},
+		{
+			name:    "redirect URI only sent to the token endpoint and wrong",
+			grant:   withoutRedirectURI,
+			req:     models.TokenRequest{CodeVerifier: testCodeVerifier, RedirectURI: "https://evil.example.com/callback"},
+			wantErr: true,
+		},
+		{
+			name:    "code of another client",
+			grant:   otherClient,
+			req:     models.TokenRequest{CodeVerifier: testCodeVerifier, RedirectURI: grant.RedirectURI},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, redisService := newTestOAuthService(t)
+			tt.req.Code = storeCode(t, redisService, tt.grant)
+
+			resp, err := s.exchangeCode(context.Background(), client, &tt.req)
+			if tt.wantErr {
+				var oauthErr *utils.OAuthError
+				if !errors.As(err, &oauthErr) {
+					t.Fatalf("err = %v, want an OAuth error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.AccessToken == "" || resp.RefreshToken == "" || resp.Scope != "profile" {
+				t.Errorf("unexpected response %+v", resp)
+			}
+		})
+	}
+}
+
+func TestExchangeCodeIsSingleUse(t *testing.T) {
+	s, redisService := newTestOAuthService(t)
+	client := &models.OAuthClient{ClientID: "client-1"}
+	code := storeCode(t, redisService, models.AuthorizationCode{
+		ClientID:      client.ClientID,
+		UserID:        "user-1",
+		CodeChallenge: testCodeChallenge(testCodeVerifier),
+	})
+	req := &models.TokenRequest{Code: code, CodeVerifier: testCodeVerifier}
+
+	if _, err := s.exchangeCode(context.Background(), client, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.exchangeCode(context.Background(), client, req); err == nil {
+		t.Error("code was redeemed twice")
+	}
+}
+
+func TestExchangeCodeConsumesCodeOnFailure(t *testing.T) {
+	s, redisService := newTestOAuthService(t)
+	client := &models.OAuthClient{ClientID: "client-1"}
+	code := storeCode(t, redisService, models.AuthorizationCode{
+		ClientID:      client.ClientID,
+		UserID:        "user-1",
+		CodeChallenge: testCodeChallenge(testCodeVerifier),
+	})
+
+	wrong := &models.TokenRequest{Code: code, CodeVerifier: strings.Repeat("a", 43)}
+	if _, err := s.exchangeCode(context.Background(), client, wrong); err == nil {
+		t.Fatal("wrong code verifier was accepted")
+	}
+	right := &models.TokenRequest{Code: code, CodeVerifier: testCodeVerifier}
+	if _, err := s.exchangeCode(context.Background(), client, right); err == nil {
+		t.Error("code could be retried after a failed exchange")
+	}
+}
+
+func TestExchangeToken(t *testing.T) {
+	client := &models.OAuthClient{
+		ClientID:          "gateway",
+		Scopes:            models.StringList{"orders:read", "orders:write", "billing"},
+		ExchangeAudiences: models.StringList{"orders-api"},
+	}
+	impersonator := *client
+	impersonator.ExchangeImpersonation = true
+	twoAudiences := *client
+	twoAudiences.ExchangeAudiences = models.StringList{"orders-api", "billing-api"}
+
+	subjectClaims := jwt.MapClaims{"client_id": "web-app", "scope": "openid orders:read orders:write"}
+	delegatedClaims := jwt.MapClaims{"client_id": "web-app", "act": map[string]interface{}{"sub": "frontend"}}
+
+	tests := []struct {
+		name      string
+		client    *models.OAuthClient
+		subject   jwt.MapClaims // nil for an invalid subject token
+		actor     string        // subject of an actor token, if any
+		audience  string
+		scope     string
+		wantErr   error
+		wantScope string
+		wantAct   interface{}
+	}{
+		{
+			name:      "defaults to the only audience and narrows the scope",
+			client:    client,
+			subject:   subjectClaims,
+			wantScope: "orders:read orders:write",
+			wantAct:   map[string]interface{}{"sub": "gateway"},
+		},
+		{
+			name:      "requested scope",
+			client:    client,
+			subject:   subjectClaims,
+			audience:  "orders-api",
+			scope:     "orders:read",
+			wantScope: "orders:read",
+			wantAct:   map[string]interface{}{"sub": "gateway"},
+		},
+		{
+			name:    "scope beyond the subject token",
+			client:  client,
+			subject: subjectClaims,
+			scope:   "billing",
+			wantErr: utils.ErrOAuthInvalidScope,
+		},
+		{
+			name:     "audience not allowed",
+			client:   client,
+			subject:  subjectClaims,
+			audience: "billing-api",
+			wantErr:  utils.ErrOAuthInvalidTarget,
+		},
+		{
+			name:    "audience required with several allowed",
+			client:  &twoAudiences,
+			subject: subjectClaims,
+			wantErr: utils.ErrOAuthInvalidRequest,
+		},
+		{
+			name:      "impersonation leaves out act",
+			client:    &impersonator,
+			subject:   subjectClaims,
+			wantScope: "orders:read orders:write",
+		},
+		{
+			name:      "actor token",
+			client:    client,
+			subject:   subjectClaims,
+			actor:     "batch-job",
+			wantScope: "orders:read orders:write",
+			wantAct:   map[string]interface{}{"sub": "batch-job"},
+		},
+		{
+			name:      "earlier actors stay in the chain",
+			client:    client,
+			subject:   delegatedClaims,
+			wantScope: "orders:read orders:write billing",
+			wantAct:   map[string]interface{}{"sub": "gateway", "act": map[string]interface{}{"sub": "frontend"}},
+		},
+		{
+			name:    "invalid subject token",
+			client:  client,
+			wantErr: utils.ErrOAuthInvalidGrant,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestOAuthService(t)
+			req := &models.TokenRequest{
+				SubjectToken:     "not-a-token",
+				SubjectTokenType: TokenTypeAccessToken,
+				Audience:         tt.audience,
+				Scope:            tt.scope,
+			}
+			if tt.subject != nil {
+				req.SubjectToken = signTestToken(t, s, "user-1", 0, tt.subject)
+			}
+			if tt.actor != "" {
+				req.ActorToken = signTestToken(t, s, tt.actor, 0, jwt.MapClaims{"client_id": tt.actor})
+				req.ActorTokenType = TokenTypeJWT
+			}
+
+			resp, err := s.exchangeToken(context.Background(), tt.client, req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Scope != tt.wantScope || resp.IssuedTokenType != TokenTypeAccessToken || resp.RefreshToken != "" {
+				t.Errorf("unexpected response %+v", resp)
+			}
+
+			claims, err := s.jwtService.ValidateAccessToken(resp.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims["sub"] != "user-1" || claims["aud"] != "orders-api" || claims["client_id"] != "gateway" || claims["scope"] != tt.wantScope {
+				t.Errorf("unexpected claims %v", claims)
+			}
+			if !reflect.DeepEqual(claims["act"], tt.wantAct) {
+				t.Errorf("act = %v, want %v", claims["act"], tt.wantAct)
+			}
+		})
+	}
+}
+
+func TestExchangeTokenRejectsMalformedRequests(t *testing.T) {
+	s, _ := newTestOAuthService(t)
+	client := &models.OAuthClient{ClientID: "gateway", ExchangeAudiences: models.StringList{"orders-api"}}
+	subject := signTestToken(t, s, "user-1", 0, nil)
+
+	for _, req := range []models.TokenRequest{
+		{SubjectTokenType: TokenTypeAccessToken},
+		{SubjectToken: subject, SubjectTokenType: "urn:ietf:params:oauth:token-type:refresh_token"},
+		{SubjectToken: subject, SubjectTokenType: TokenTypeAccessToken, ActorTokenType: TokenTypeJWT},
+		{SubjectToken: subject, SubjectTokenType: TokenTypeAccessToken, ActorToken: subject},
+		{SubjectToken: subject, SubjectTokenType: TokenTypeAccessToken, RequestedTokenType: TokenTypeJWT},
+	} {
+		if _, err := s.exchangeToken(context.Background(), client, &req); !errors.Is(err, utils.ErrOAuthInvalidRequest) {
+			t.Errorf("%+v: err = %v, want invalid_request", req, err)
+		}
+	}
+}
+
+func TestExchangeTokenDoesNotOutliveSubjectToken(t *testing.T) {
+	s, _ := newTestOAuthService(t)
+	client := &models.OAuthClient{
+		ClientID:            "gateway",
+		ExchangeAudiences:   models.StringList{"orders-api"},
+		AccessTokenLifetime: 3600,
+	}
+	req := &models.TokenRequest{
+		SubjectToken:     signTestToken(t, s, "user-1", 30*time.Second, nil),
+		SubjectTokenType: TokenTypeAccessToken,
+	}
+
+	resp, err := s.exchangeToken(context.Background(), client, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ExpiresIn > 30 {
+		t.Errorf("expires_in = %d, want at most 30", resp.ExpiresIn)
+	}
+}
+
+func TestExchangeTokenRejectsDisabledUsers(t *testing.T) {
+	s, _ := newTestOAuthService(t)
+	client := &models.OAuthClient{ClientID: "gateway", ExchangeAudiences: models.StringList{"orders-api"}}
+	req := &models.TokenRequest{
+		SubjectToken:     signTestToken(t, s, "user-1", 0, nil),
+		SubjectTokenType: TokenTypeAccessToken,
+	}
+	user, _ := s.authService.GetUser("user-1")
+	user.Active = false
+
+	if _, err := s.exchangeToken(context.Background(), client, req); !errors.Is(err, utils.ErrOAuthInvalidGrant) {
+		t.Errorf("err = %v, want invalid_grant", err)
+	}
+}
+
+// signTestToken signs an access token for subject with the service's
+// JWTService.
+func signTestToken(t *testing.T, s *oauthService, subject string, expiry time.Duration, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := s.jwtService.GenerateAccessToken(subject, expiry, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// issueClientSession starts a session of clientID for user-1.
+func issueClientSession(t *testing.T, s *oauthService, clientID string) *models.TokenPair {
+	t.Helper()
+	tokens, err := s.authService.IssueClientTokens(context.Background(), "user-1", clientID, "profile", time.Now().Unix(), nil, TokenLifetimes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func TestRevokeRefreshTokenEndsSession(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestOAuthService(t)
+	s.clientService = &fixedClient{client: &models.OAuthClient{ClientID: "client-1"}}
+	tokens := issueClientSession(t, s, "client-1")
+
+	if err := s.Revoke(ctx, models.ClientAuthentication{}, &models.TokenRevocationRequest{Token: tokens.RefreshToken}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.authService.ValidateRefreshToken(ctx, tokens.RefreshToken); err == nil {
+		t.Error("refresh token still works")
+	}
+	// The session's access tokens go with it
+	if _, err := s.authService.ValidateAccessToken(ctx, tokens.AccessToken); !errors.Is(err, utils.ErrTokenRevoked) {
+		t.Errorf("access token: err = %v, want %v", err, utils.ErrTokenRevoked)
+	}
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestOAuthService(t)
+	s.clientService = &fixedClient{client: &models.OAuthClient{ClientID: "client-1"}}
+	tokens := issueClientSession(t, s, "client-1")
+
+	if err := s.Revoke(ctx, models.ClientAuthentication{}, &models.TokenRevocationRequest{Token: tokens.AccessToken}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.authService.ValidateAccessToken(ctx, tokens.AccessToken); err == nil {
+		t.Error("access token still works")
+	}
+	if _, err := s.authService.ValidateRefreshToken(ctx, tokens.RefreshToken); err != nil {
+		t.Errorf("revoking the access token ended the session: %v", err)
+	}
+
+	// Tokens without exp aren't issued, but if one turns up it is revoked
+	// rather than reported as an error
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user-1", "client_id": "client-1"}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revoke(ctx, models.ClientAuthentication{}, &models.TokenRevocationRequest{Token: token}); err != nil {
+		t.Fatalf("token without exp: err = %v", err)
+	}
+	if _, err := s.authService.ValidateAccessToken(ctx, token); err == nil {
+		t.Error("token without exp still works")
+	}
+
+	// Invalid tokens are not an error (RFC 7009 section 2.2)
+	if err := s.Revoke(ctx, models.ClientAuthentication{}, &models.TokenRevocationRequest{Token: "not-a-token"}); err != nil {
+		t.Errorf("invalid token: err = %v", err)
+	}
+}
+
+func TestRevokeTokenOfAnotherClient(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestOAuthService(t)
+	s.clientService = &fixedClient{client: &models.OAuthClient{ClientID: "client-2"}}
+	tokens := issueClientSession(t, s, "client-1")
+
+	for name, token := range map[string]string{"refresh token": tokens.RefreshToken, "access token": tokens.AccessToken} {
+		err := s.Revoke(ctx, models.ClientAuthentication{}, &models.TokenRevocationRequest{Token: token})
+		if !errors.Is(err, utils.ErrOAuthUnauthorizedClient) {
+			t.Errorf("%s: err = %v, want unauthorized_client", name, err)
+		}
+	}
+	if _, err := s.authService.ValidateRefreshToken(ctx, tokens.RefreshToken); err != nil {
+		t.Errorf("refresh token was revoked: %v", err)
+	}
+	if _, err := s.authService.ValidateAccessToken(ctx, tokens.AccessToken); err != nil {
+		t.Errorf("access token was revoked: %v", err)
+	}
+}
+
+func TestIntrospect(t *testing.T) {
+	ctx := context.Background()
+	s, redisService := newTestOAuthService(t)
+	s.clientService = &fixedClient{client: &models.OAuthClient{ClientID: "api", Type: models.ClientTypeConfidential}}
+	introspect := func(token, hint string) *models.IntrospectionResponse {
+		t.Helper()
+		resp, err := s.Introspect(ctx, models.ClientAuthentication{}, &models.IntrospectionRequest{Token: token, TokenTypeHint: hint})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Tokens of other clients are described to any resource server
+	tokens := issueClientSession(t, s, "client-1")
+	resp := introspect(tokens.AccessToken, "")
+	if !resp.Active || resp.TokenType != models.TokenTypeHintAccessToken || resp.ClientID != "client-1" ||
+		resp.Sub != "user-1" || resp.Scope != "profile" || resp.Exp == 0 || resp.Iat == 0 {
+		t.Errorf("access token: unexpected response %+v", resp)
+	}
+	resp = introspect(tokens.RefreshToken, models.TokenTypeHintAccessToken)
+	if !resp.Active || resp.TokenType != models.TokenTypeHintRefreshToken || resp.ClientID != "client-1" {
+		t.Errorf("refresh token: unexpected response %+v", resp)
+	}
+
+	// Blacklisted
+	redisService.BlacklistToken(ctx, tokens.AccessToken, time.Minute)
+	if resp := introspect(tokens.AccessToken, ""); *resp != (models.IntrospectionResponse{}) {
+		t.Errorf("blacklisted token: response %+v, want only active=false", resp)
+	}
+
+	// Revoked by the session's watermark
+	tokens = issueClientSession(t, s, "client-2")
+	if err := s.authService.RevokeClientSession(ctx, "user-1", "client-2"); err != nil {
+		t.Fatal(err)
+	}
+	if resp := introspect(tokens.AccessToken, ""); resp.Active {
+		t.Errorf("revoked access token: response %+v", resp)
+	}
+	if resp := introspect(tokens.RefreshToken, ""); resp.Active {
+		t.Errorf("revoked refresh token: response %+v", resp)
+	}
+
+	if resp := introspect("not-a-token", ""); resp.Active {
+		t.Errorf("invalid token: response %+v", resp)
+	}
+}
+
+func TestIntrospectRequiresConfidentialClient(t *testing.T) {
+	s, _ := newTestOAuthService(t)
+	s.clientService = &fixedClient{client: &models.OAuthClient{ClientID: "spa", Type: models.ClientTypePublic}}
+	tokens := issueClientSession(t, s, "spa")
+
+	_, err := s.Introspect(context.Background(), models.ClientAuthentication{}, &models.IntrospectionRequest{Token: tokens.AccessToken})
+	if !errors.Is(err, utils.ErrOAuthInvalidClient) {
+		t.Errorf("err = %v, want invalid_client", err)
+	}
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+// OpenID Connect scopes.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// scopeClaims maps the OpenID Connect scopes to the profile claims they
+// release. See profileClaimValues for how claims map to user fields.
+var scopeClaims = map[string][]string{
+	ScopeProfile: {"name", "given_name", "family_name", "preferred_username", "locale", "zoneinfo", "picture"},
+	ScopeEmail:   {"email"},
+}
+
+// OIDCService implements the OpenID Connect parts of the authorization
+// server: ID tokens, the userinfo endpoint and discovery.
+type OIDCService interface {
+	// IDToken signs an ID token for the user who approved grant, an
+	// authorization code or an equivalent grant. It is valid as long as the
+	// access token it comes with.
+	IDToken(grant *models.AuthorizationCode, accessToken string, expiry time.Duration) (string, error)
+	// UserInfo returns the claims the scope releases about the user.
+	UserInfo(userID, scope string) (jwt.MapClaims, error)
+	Discovery() *models.OpenIDConfiguration
+	// KeySet returns the public keys ID tokens are signed with.
+	KeySet() utils.JWKSet
+}
+
+type oidcService struct {
+	userRepo   repositories.UserRepository
+	jwtService JWTService
+	signingKey *rsa.PrivateKey
+	keyID      string
+	issuer     string
+}
+
+func NewOIDCService(
+	userRepo repositories.UserRepository,
+	jwtService JWTService,
+	signingKey *rsa.PrivateKey,
+	issuer string,
+) OIDCService {
+	return &oidcService{
+		userRepo:   userRepo,
+		jwtService: jwtService,
+		signingKey: signingKey,
+		keyID:      utils.RSAThumbprint(&signingKey.PublicKey),
+		issuer:     strings.TrimSuffix(issuer, "/"),
+	}
+}
+
+func (s *oidcService) IDToken(grant *models.AuthorizationCode, accessToken string, expiry time.Duration) (string, error) {
+	user, err := s.userRepo.FindByID(grant.UserID)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", utils.ErrUserNotFound
+	}
+	if expiry <= 0 {
+		expiry = s.jwtService.GetAccessExpiry()
+	}
+
+	claims := userClaims(user, grant.Scope)
+	now := time.Now()
+	claims["iss"] = s.issuer
+	claims["aud"] = grant.ClientID
+	claims["exp"] = now.Add(expiry).Unix()
+	claims["iat"] = now.Unix()
+	claims["auth_time"] = grant.AuthTime
+	if len(grant.AMR) > 0 {
+		claims["amr"] = grant.AMR
+	}
+	if acr := authContextClass(grant.AMR); acr != "" {
+		claims["acr"] = acr
+	}
+	claims["at_hash"] = accessTokenHash(accessToken)
+	if grant.Nonce != "" {
+		claims["nonce"] = grant.Nonce
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.keyID
+	return token.SignedString(s.signingKey)
+}
+
+func (s *oidcService) UserInfo(userID, scope string) (jwt.MapClaims, error) {
+	if !hasScope(scope, ScopeOpenID) {
+		return nil, utils.ErrOAuthInsufficientScope.WithDescription("the openid scope is required")
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.Active {
+		return nil, utils.ErrAccountDisabled
+	}
+	return userClaims(user, scope), nil
+}
+
+func (s *oidcService) Discovery() *models.OpenIDConfiguration {
+	var grantTypes []string
+	for grantType := range supportedGrantTypes {
+		grantTypes = append(grantTypes, grantType)
+	}
+	sort.Strings(grantTypes)
+
+	claims := []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "amr", "acr", "at_hash", "updated_at"}
+	for _, names := range scopeClaims {
+		claims = append(claims, names...)
+	}
+	sort.Strings(claims)
+
+	return &models.OpenIDConfiguration{
+		Issuer:                                     s.issuer,
+		AuthorizationEndpoint:                      s.issuer + "/oauth/authorize",
+		TokenEndpoint:                              s.issuer + "/oauth/token",
+		UserinfoEndpoint:                           s.issuer + "/oauth/userinfo",
+		IntrospectionEndpoint:                      s.issuer + "/oauth/introspect",
+		RevocationEndpoint:                         s.issuer + "/oauth/revoke",
+		DeviceAuthorizationEndpoint:                s.issuer + "/oauth/device_authorization",
+		JWKSURI:                                    s.issuer + "/oauth/jwks",
+		ScopesSupported:                            []string{ScopeOpenID, ScopeProfile, ScopeEmail},
+		ResponseTypesSupported:                     []string{"code"},
+		GrantTypesSupported:                        grantTypes,
+		SubjectTypesSupported:                      []string{"public"},
+		IDTokenSigningAlgValuesSupported:           []string{jwt.SigningMethodRS256.Alg()},
+		TokenEndpointAuthMethodsSupported:          []string{"client_secret_basic", "client_secret_post", "private_key_jwt", "none"},
+		TokenEndpointAuthSigningAlgValuesSupported: clientAssertionAlgorithms,
+		CodeChallengeMethodsSupported:              []string{PKCEMethodS256},
+		ClaimsSupported:                            claims,
+	}
+}
+
+func (s *oidcService) KeySet() utils.JWKSet {
+	return utils.JWKSet{Keys: []utils.JWK{
+		utils.NewRSAJWK(&s.signingKey.PublicKey, s.keyID, jwt.SigningMethodRS256.Alg()),
+	}}
+}
+
+// userClaims returns the sub claim and the profile claims released by
+// scope.
+func userClaims(user *models.User, scope string) jwt.MapClaims {
+	var names []string
+	for _, granted := range strings.Fields(scope) {
+		names = append(names, scopeClaims[granted]...)
+	}
+
+	claims := ProfileClaims(user, names)
+	claims["sub"] = user.ID
+	if hasScope(scope, ScopeProfile) {
+		claims["updated_at"] = user.UpdatedAt.Unix()
+	}
+	return claims
+}
+
+// authContextClass returns the acr claim of a session authenticated with
+// amr. A password is single-factor authentication (ISO/IEC 29115 level 1).
+// How strongly users were authenticated at an identity provider isn't
+// known, so those sessions have no acr.
+func authContextClass(amr []string) string {
+	for _, method := range amr {
+		if method == AuthMethodPassword {
+			return "1"
+		}
+	}
+	return ""
+}
+
+// accessTokenHash is the at_hash claim: the left half of the access token's
+// SHA-256 digest, base64url encoded.
+func accessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// hasScope reports whether the space-delimited scope list contains want.
+func hasScope(scope, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
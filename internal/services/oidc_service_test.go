@@ -0,0 +1,187 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+// newTestOIDCService returns an oidcService for two users: user-1, who is
+// active, and user-2, who is disabled.
+func newTestOIDCService(t *testing.T) *oidcService {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := newMemoryUsers(
+		&models.User{ID: "user-1", Email: "user@example.com", DisplayName: "Alice Liddell", Locale: "en-GB", Active: true},
+		&models.User{ID: "user-2", Email: "disabled@example.com"},
+	)
+	jwtService := NewJWTService("test-secret", time.Minute, time.Hour)
+	return NewOIDCService(users, jwtService, key, "https://auth.example.com/").(*oidcService)
+}
+
+// parseIDToken verifies idToken with the service's published key.
+func parseIDToken(t *testing.T, s *oidcService, idToken string) jwt.MapClaims {
+	t.Helper()
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return &s.signingKey.PublicKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := token.Header["kid"]; kid != s.KeySet().Keys[0].Kid {
+		t.Errorf("kid = %v, want the published key %s", kid, s.KeySet().Keys[0].Kid)
+	}
+	return claims
+}
+
+func TestIDToken(t *testing.T) {
+	s := newTestOIDCService(t)
+	grant := &models.AuthorizationCode{
+		ClientID: "client-1",
+		UserID:   "user-1",
+		Scope:    "openid email",
+		AuthTime: 1700000000,
+		AMR:      []string{AuthMethodPassword},
+		Nonce:    "n-0S6_WzA2Mj",
+	}
+
+	idToken, err := s.IDToken(grant, "access-token", 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := parseIDToken(t, s, idToken)
+
+	want := map[string]interface{}{
+		"iss":       "https://auth.example.com",
+		"aud":       "client-1",
+		"sub":       "user-1",
+		"email":     "user@example.com",
+		"auth_time": float64(1700000000),
+		"amr":       []interface{}{AuthMethodPassword},
+		"acr":       "1",
+		"nonce":     "n-0S6_WzA2Mj",
+		"at_hash":   accessTokenHash("access-token"),
+	}
+	for name, value := range want {
+		if !reflect.DeepEqual(claims[name], value) {
+			t.Errorf("%s = %v, want %v", name, claims[name], value)
+		}
+	}
+	// Only the claims of the granted scopes are released
+	if _, ok := claims["name"]; ok {
+		t.Error("name released without the profile scope")
+	}
+	exp, _ := claims.GetExpirationTime()
+	if exp == nil || time.Until(exp.Time) > 5*time.Minute {
+		t.Errorf("exp = %v, want the access token's lifetime", exp)
+	}
+}
+
+func TestIDTokenAuthenticationContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		amr     []string
+		wantACR string
+	}{
+		{"password", []string{AuthMethodPassword}, "1"},
+		// The assurance level of identity providers is unknown
+		{"identity provider", []string{AuthMethodFederated}, ""},
+		// Sessions started before amr was recorded
+		{"unknown", nil, ""},
+	}
+	s := newTestOIDCService(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grant := &models.AuthorizationCode{ClientID: "client-1", UserID: "user-1", Scope: "openid", AMR: tt.amr}
+			idToken, err := s.IDToken(grant, "access-token", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims := parseIDToken(t, s, idToken)
+
+			if amr := claimStrings(claims, "amr"); !reflect.DeepEqual(amr, tt.amr) {
+				t.Errorf("amr = %v, want %v", claims["amr"], tt.amr)
+			}
+			acr, _ := claims["acr"].(string)
+			if acr != tt.wantACR {
+				t.Errorf("acr = %q, want %q", acr, tt.wantACR)
+			}
+			if _, ok := claims["nonce"]; ok {
+				t.Error("nonce set without one in the authorization request")
+			}
+		})
+	}
+}
+
+func TestIDTokenOfDeletedUser(t *testing.T) {
+	s := newTestOIDCService(t)
+	_, err := s.IDToken(&models.AuthorizationCode{ClientID: "client-1", UserID: "deleted"}, "access-token", 0)
+	if !errors.Is(err, utils.ErrUserNotFound) {
+		t.Errorf("err = %v, want %v", err, utils.ErrUserNotFound)
+	}
+}
+
+func TestUserInfo(t *testing.T) {
+	s := newTestOIDCService(t)
+
+	claims, err := s.UserInfo("user-1", "openid profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["sub"] != "user-1" || claims["name"] != "Alice Liddell" || claims["locale"] != "en-GB" {
+		t.Errorf("unexpected claims %v", claims)
+	}
+	if _, ok := claims["updated_at"]; !ok {
+		t.Error("updated_at missing with the profile scope")
+	}
+	if _, ok := claims["email"]; ok {
+		t.Error("email released without the email scope")
+	}
+
+	if _, err := s.UserInfo("user-1", "profile"); !errors.Is(err, utils.ErrOAuthInsufficientScope) {
+		t.Errorf("without openid: err = %v, want insufficient_scope", err)
+	}
+	if _, err := s.UserInfo("user-2", "openid"); !errors.Is(err, utils.ErrAccountDisabled) {
+		t.Errorf("disabled user: err = %v, want %v", err, utils.ErrAccountDisabled)
+	}
+	if _, err := s.UserInfo("deleted", "openid"); !errors.Is(err, utils.ErrAccountDisabled) {
+		t.Errorf("deleted user: err = %v, want %v", err, utils.ErrAccountDisabled)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	s := newTestOIDCService(t)
+	config := s.Discovery()
+
+	if config.Issuer != "https://auth.example.com" {
+		t.Errorf("issuer = %q, want it without the trailing slash", config.Issuer)
+	}
+	if config.TokenEndpoint != "https://auth.example.com/oauth/token" || config.JWKSURI != "https://auth.example.com/oauth/jwks" {
+		t.Errorf("unexpected endpoints %+v", config)
+	}
+	if !sort.StringsAreSorted(config.GrantTypesSupported) || len(config.GrantTypesSupported) != len(supportedGrantTypes) {
+		t.Errorf("grant_types_supported = %v", config.GrantTypesSupported)
+	}
+	for _, claim := range []string{"sub", "amr", "acr", "email", "preferred_username"} {
+		if i := sort.SearchStrings(config.ClaimsSupported, claim); i == len(config.ClaimsSupported) || config.ClaimsSupported[i] != claim {
+			t.Errorf("claims_supported is missing %s", claim)
+		}
+	}
+
+	keys := s.KeySet().Keys
+	if len(keys) != 1 || keys[0].Kid != utils.RSAThumbprint(&s.signingKey.PublicKey) || keys[0].Alg != "RS256" {
+		t.Errorf("unexpected key set %+v", keys)
+	}
+}
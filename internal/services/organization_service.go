@@ -0,0 +1,254 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,62}[a-z0-9])?$`)
+
+type OrganizationService interface {
+	CreateOrganization(userID, name, slug string) (*models.Organization, error)
+	GetOrganization(orgID string) (*models.Organization, error)
+	UpdateOrganization(orgID, name string) (*models.Organization, error)
+	DeleteOrganization(orgID string) error
+	ListUserOrganizations(userID string) ([]models.OrganizationMember, error)
+
+	ListMembers(orgID string) ([]models.OrganizationMember, error)
+	AddMember(orgID, userID string, roles []string) (*models.OrganizationMember, error)
+	UpdateMemberRoles(orgID, userID string, roles []string) (*models.OrganizationMember, error)
+	RemoveMember(orgID, userID string) error
+
+	// GetMemberAuthorization returns the user's role names and permissions in
+	// the organization, or an error if the user is not a member.
+	GetMemberAuthorization(orgID, userID string) (roles []string, permissions []string, err error)
+}
+
+type organizationService struct {
+	orgRepo  repositories.OrganizationRepository
+	roleRepo repositories.RoleRepository
+	userRepo repositories.UserRepository
+}
+
+func NewOrganizationService(
+	orgRepo repositories.OrganizationRepository,
+	roleRepo repositories.RoleRepository,
+	userRepo repositories.UserRepository,
+) OrganizationService {
+	return &organizationService{
+		orgRepo:  orgRepo,
+		roleRepo: roleRepo,
+		userRepo: userRepo,
+	}
+}
+
+func (s *organizationService) CreateOrganization(userID, name, slug string) (*models.Organization, error) {
+	if name == "" || len(name) > 255 {
+		return nil, utils.ErrInvalidInput.WithMessage("invalid organization name")
+	}
+	if !slugPattern.MatchString(slug) {
+		return nil, utils.ErrInvalidInput.WithMessage("slug must be 1-64 lowercase letters, digits or dashes")
+	}
+
+	existing, err := s.orgRepo.FindBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, utils.ErrConflict.WithMessage("organization slug already taken")
+	}
+
+	owner, err := s.roleRepo.FindRoleByName(OrgOwnerRole, models.RoleScopeOrganization)
+	if err != nil {
+		return nil, err
+	}
+	if owner == nil {
+		return nil, errors.New("organization roles have not been seeded")
+	}
+
+	return s.orgRepo.Create(
+		&models.Organization{Name: name, Slug: slug},
+		&models.OrganizationMember{UserID: userID, Roles: []models.Role{*owner}},
+	)
+}
+
+func (s *organizationService) GetOrganization(orgID string) (*models.Organization, error) {
+	return s.orgRepo.FindByID(orgID)
+}
+
+func (s *organizationService) UpdateOrganization(orgID, name string) (*models.Organization, error) {
+	org, err := s.orgRepo.FindByID(orgID)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, utils.ErrNotFound.WithMessage("organization not found")
+	}
+
+	if name == "" || len(name) > 255 {
+		return nil, utils.ErrInvalidInput.WithMessage("invalid organization name")
+	}
+	org.Name = name
+
+	if err := s.orgRepo.Update(org); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func (s *organizationService) DeleteOrganization(orgID string) error {
+	return s.orgRepo.Delete(orgID)
+}
+
+func (s *organizationService) ListUserOrganizations(userID string) ([]models.OrganizationMember, error) {
+	return s.orgRepo.ListMemberships(userID)
+}
+
+func (s *organizationService) ListMembers(orgID string) ([]models.OrganizationMember, error) {
+	return s.orgRepo.ListMembers(orgID)
+}
+
+func (s *organizationService) AddMember(orgID, userID string, roles []string) (*models.OrganizationMember, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, utils.ErrUserNotFound
+	}
+
+	existing, err := s.orgRepo.FindMember(orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, utils.ErrConflict.WithMessage("user is already a member")
+	}
+
+	if len(roles) == 0 {
+		roles = []string{OrgMemberRole}
+	}
+	resolved, err := s.resolveRoles(roles)
+	if err != nil {
+		return nil, err
+	}
+
+	member := &models.OrganizationMember{
+		OrganizationID: orgID,
+		UserID:         userID,
+		Roles:          resolved,
+	}
+	if err := s.orgRepo.AddMember(member); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func (s *organizationService) UpdateMemberRoles(orgID, userID string, roles []string) (*models.OrganizationMember, error) {
+	member, err := s.orgRepo.FindMember(orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, utils.ErrNotFound.WithMessage("member not found")
+	}
+
+	resolved, err := s.resolveRoles(roles)
+	if err != nil {
+		return nil, err
+	}
+	if len(resolved) == 0 {
+		return nil, utils.ErrInvalidInput.WithMessage("a member needs at least one role")
+	}
+
+	if hasRole(member.Roles, OrgOwnerRole) && !hasRole(resolved, OrgOwnerRole) {
+		if err := s.ensureAnotherOwner(orgID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.orgRepo.SetMemberRoles(member, resolved); err != nil {
+		return nil, err
+	}
+	member.Roles = resolved
+	return member, nil
+}
+
+func (s *organizationService) RemoveMember(orgID, userID string) error {
+	member, err := s.orgRepo.FindMember(orgID, userID)
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		return utils.ErrNotFound.WithMessage("member not found")
+	}
+
+	if hasRole(member.Roles, OrgOwnerRole) {
+		if err := s.ensureAnotherOwner(orgID); err != nil {
+			return err
+		}
+	}
+
+	return s.orgRepo.RemoveMember(orgID, userID)
+}
+
+func (s *organizationService) GetMemberAuthorization(orgID, userID string) ([]string, []string, error) {
+	member, err := s.orgRepo.FindMember(orgID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if member == nil {
+		return nil, nil, utils.ErrForbidden.WithMessage("not a member of this organization")
+	}
+
+	roles, permissions := flattenRoles(member.Roles)
+	return roles, permissions, nil
+}
+
+// ensureAnotherOwner stops the last owner from being removed or demoted.
+func (s *organizationService) ensureAnotherOwner(orgID string) error {
+	owner, err := s.roleRepo.FindRoleByName(OrgOwnerRole, models.RoleScopeOrganization)
+	if err != nil {
+		return err
+	}
+
+	count, err := s.orgRepo.CountMembersWithRole(orgID, owner.ID)
+	if err != nil {
+		return err
+	}
+	if count <= 1 {
+		return utils.ErrConflict.WithMessage("an organization must keep at least one owner")
+	}
+	return nil
+}
+
+func (s *organizationService) resolveRoles(names []string) ([]models.Role, error) {
+	roles, err := s.roleRepo.FindRolesByName(names, models.RoleScopeOrganization)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		found[role.Name] = true
+	}
+	for _, name := range names {
+		if !found[name] {
+			return nil, utils.ErrInvalidInput.WithMessage("unknown organization role " + name)
+		}
+	}
+	return roles, nil
+}
+
+func hasRole(roles []models.Role, name string) bool {
+	for _, role := range roles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
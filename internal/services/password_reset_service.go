@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+const passwordResetTokenPurpose = "password_reset"
+
+type PasswordResetService interface {
+	// SendResetLink emails the user a link to choose a new password.
+	SendResetLink(user *models.User) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+}
+
+type passwordResetService struct {
+	userRepo     repositories.UserRepository
+	authService  AuthService
+	jwtService   JWTService
+	emailService EmailService
+	auditService AuditService
+	expiry       time.Duration
+}
+
+func NewPasswordResetService(
+	userRepo repositories.UserRepository,
+	authService AuthService,
+	jwtService JWTService,
+	emailService EmailService,
+	auditService AuditService,
+	expiry time.Duration,
+) PasswordResetService {
+	return &passwordResetService{
+		userRepo:     userRepo,
+		authService:  authService,
+		jwtService:   jwtService,
+		emailService: emailService,
+		auditService: auditService,
+		expiry:       expiry,
+	}
+}
+
+func (s *passwordResetService) SendResetLink(user *models.User) error {
+	token, err := s.jwtService.GenerateActionToken(user.ID, passwordResetTokenPurpose, s.expiry, jwt.MapClaims{
+		"pwh": passwordFingerprint(user.Password),
+	})
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf(
+		"A password reset was requested for your account.\n\nChoose a new password:\n%s\n\nThis link expires in %s.",
+		s.emailService.LinkURL("/password/reset", token), s.expiry,
+	)
+	return s.emailService.Send(user.Email, "Reset your password", body)
+}
+
+func (s *passwordResetService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	claims, err := s.jwtService.ValidateActionToken(token, passwordResetTokenPurpose)
+	if err != nil {
+		return utils.ErrInvalidLink.WithMessage("invalid or expired reset link")
+	}
+
+	user, err := s.userRepo.FindByID(claims["sub"].(string))
+	if err != nil {
+		return err
+	}
+	// The fingerprint changes with the password, so a link works only once
+	if user == nil || claims["pwh"] != passwordFingerprint(user.Password) {
+		return utils.ErrInvalidLink.WithMessage("invalid or expired reset link")
+	}
+
+	if !utils.IsPasswordValid(newPassword) {
+		return utils.ErrWeakPassword
+	}
+
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	user.Password = hashedPassword
+	user.PasswordResetRequired = false
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	if err := s.authService.RevokeSessions(ctx, user.ID); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, user.ID, models.AuditPasswordReset, nil)
+	return nil
+}
+
+// passwordFingerprint identifies the current password hash without
+// revealing it.
+func passwordFingerprint(hash string) string {
+	sum := sha256.Sum256([]byte(hash))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,421 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+// Built-in permissions guarding this service's own admin API.
+const (
+	PermUsersRead    = "users:read"
+	PermUsersWrite   = "users:write"
+	PermUsersImport  = "users:import"
+	PermRolesRead    = "roles:read"
+	PermRolesWrite   = "roles:write"
+	PermClientsRead  = "oauth_clients:read"
+	PermClientsWrite = "oauth_clients:write"
+
+	AdminRole = "admin"
+)
+
+// Built-in organization permissions, checked against the active organization.
+const (
+	PermOrgRead         = "org:read"
+	PermOrgUpdate       = "org:update"
+	PermOrgDelete       = "org:delete"
+	PermOrgMembersRead  = "org:members:read"
+	PermOrgMembersWrite = "org:members:write"
+
+	OrgOwnerRole  = "owner"
+	OrgAdminRole  = "admin"
+	OrgMemberRole = "member"
+)
+
+var defaultPermissions = map[string]string{
+	PermUsersRead:    "View user accounts",
+	PermUsersWrite:   "Create, update and delete user accounts",
+	PermUsersImport:  "Bulk import user accounts",
+	PermRolesRead:    "View roles and permissions",
+	PermRolesWrite:   "Manage roles, permissions and role assignments",
+	PermClientsRead:  "View OAuth clients",
+	PermClientsWrite: "Register and manage OAuth clients",
+
+	PermOrgRead:         "View the organization",
+	PermOrgUpdate:       "Update organization settings",
+	PermOrgDelete:       "Delete the organization",
+	PermOrgMembersRead:  "View organization members",
+	PermOrgMembersWrite: "Manage organization members and their roles",
+}
+
+var globalRolePermissions = map[string][]string{
+	AdminRole: {
+		PermUsersRead, PermUsersWrite, PermUsersImport, PermRolesRead, PermRolesWrite,
+		PermClientsRead, PermClientsWrite,
+	},
+}
+
+var organizationRolePermissions = map[string][]string{
+	OrgOwnerRole:  {PermOrgRead, PermOrgUpdate, PermOrgDelete, PermOrgMembersRead, PermOrgMembersWrite},
+	OrgAdminRole:  {PermOrgRead, PermOrgUpdate, PermOrgMembersRead, PermOrgMembersWrite},
+	OrgMemberRole: {PermOrgRead, PermOrgMembersRead},
+}
+
+type RBACService interface {
+	CreateRole(name, scope, description string, permissions []string) (*models.Role, error)
+	UpdateRole(id, name, description string, permissions []string) (*models.Role, error)
+	DeleteRole(id string) error
+	GetRole(id string) (*models.Role, error)
+	ListRoles() ([]models.Role, error)
+
+	CreatePermission(name, description string) (*models.Permission, error)
+	ListPermissions() ([]models.Permission, error)
+
+	GetUserRoles(userID string) ([]models.Role, error)
+	AssignRole(userID, roleName string) error
+	RemoveRole(userID, roleID string) error
+	// GetUserAuthorization returns the user's role names and the union of
+	// their permissions, both sorted, for embedding in access tokens.
+	GetUserAuthorization(userID string) (roles []string, permissions []string, err error)
+
+	SeedDefaults(adminEmails []string) error
+}
+
+type rbacService struct {
+	roleRepo repositories.RoleRepository
+	userRepo repositories.UserRepository
+}
+
+func NewRBACService(roleRepo repositories.RoleRepository, userRepo repositories.UserRepository) RBACService {
+	return &rbacService{
+		roleRepo: roleRepo,
+		userRepo: userRepo,
+	}
+}
+
+func (s *rbacService) CreateRole(name, scope, description string, permissions []string) (*models.Role, error) {
+	if !isValidRBACName(name) {
+		return nil, utils.ErrInvalidInput.WithMessage("invalid role name")
+	}
+	if scope == "" {
+		scope = models.RoleScopeGlobal
+	}
+	if scope != models.RoleScopeGlobal && scope != models.RoleScopeOrganization {
+		return nil, utils.ErrInvalidInput.WithMessage("invalid role scope")
+	}
+
+	existing, err := s.roleRepo.FindRoleByName(name, scope)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, utils.ErrConflict.WithMessage("role already exists")
+	}
+
+	perms, err := s.resolvePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.roleRepo.CreateRole(&models.Role{
+		Name:        name,
+		Scope:       scope,
+		Description: description,
+		Permissions: perms,
+	})
+}
+
+func (s *rbacService) UpdateRole(id, name, description string, permissions []string) (*models.Role, error) {
+	role, err := s.roleRepo.FindRoleByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, utils.ErrNotFound.WithMessage("role not found")
+	}
+
+	if name != "" && name != role.Name {
+		if isBuiltInRole(role) {
+			return nil, utils.ErrForbidden.WithMessage("built-in roles cannot be renamed")
+		}
+		if !isValidRBACName(name) {
+			return nil, utils.ErrInvalidInput.WithMessage("invalid role name")
+		}
+		role.Name = name
+	}
+	role.Description = description
+
+	perms, err := s.resolvePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+	role.Permissions = perms
+
+	if err := s.roleRepo.UpdateRole(role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (s *rbacService) DeleteRole(id string) error {
+	role, err := s.roleRepo.FindRoleByID(id)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return utils.ErrNotFound.WithMessage("role not found")
+	}
+	if isBuiltInRole(role) {
+		return utils.ErrForbidden.WithMessage("built-in roles cannot be deleted")
+	}
+	return s.roleRepo.DeleteRole(id)
+}
+
+func (s *rbacService) GetRole(id string) (*models.Role, error) {
+	return s.roleRepo.FindRoleByID(id)
+}
+
+func (s *rbacService) ListRoles() ([]models.Role, error) {
+	return s.roleRepo.ListRoles()
+}
+
+func (s *rbacService) CreatePermission(name, description string) (*models.Permission, error) {
+	if !isValidRBACName(name) {
+		return nil, utils.ErrInvalidInput.WithMessage("invalid permission name")
+	}
+
+	existing, err := s.roleRepo.FindPermissionsByName([]string{name})
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return nil, utils.ErrConflict.WithMessage("permission already exists")
+	}
+
+	return s.roleRepo.CreatePermission(&models.Permission{
+		Name:        name,
+		Description: description,
+	})
+}
+
+func (s *rbacService) ListPermissions() ([]models.Permission, error) {
+	return s.roleRepo.ListPermissions()
+}
+
+func (s *rbacService) GetUserRoles(userID string) ([]models.Role, error) {
+	return s.roleRepo.FindUserRoles(userID)
+}
+
+func (s *rbacService) AssignRole(userID, roleName string) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return utils.ErrUserNotFound
+	}
+
+	role, err := s.roleRepo.FindRoleByName(roleName, models.RoleScopeGlobal)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return utils.ErrNotFound.WithMessage("role not found")
+	}
+
+	return s.roleRepo.AssignRole(userID, role.ID)
+}
+
+func (s *rbacService) RemoveRole(userID, roleID string) error {
+	return s.roleRepo.RemoveRole(userID, roleID)
+}
+
+func (s *rbacService) GetUserAuthorization(userID string) ([]string, []string, error) {
+	roles, err := s.roleRepo.FindUserRoles(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roleNames, permissions := flattenRoles(roles)
+	return roleNames, permissions, nil
+}
+
+// SeedDefaults creates the built-in permissions, the global admin role and
+// the organization roles if they are missing, and grants the admin role to
+// the given (existing) users.
+func (s *rbacService) SeedDefaults(adminEmails []string) error {
+	names := make([]string, 0, len(defaultPermissions))
+	for name := range defaultPermissions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	existing, err := s.roleRepo.FindPermissionsByName(names)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool, len(existing))
+	for _, permission := range existing {
+		have[permission.Name] = true
+	}
+	for _, name := range names {
+		if have[name] {
+			continue
+		}
+		if _, err := s.roleRepo.CreatePermission(&models.Permission{
+			Name:        name,
+			Description: defaultPermissions[name],
+		}); err != nil {
+			return fmt.Errorf("failed to create permission %s: %w", name, err)
+		}
+	}
+
+	for name, permissions := range globalRolePermissions {
+		if _, err := s.seedRole(name, models.RoleScopeGlobal, permissions); err != nil {
+			return err
+		}
+	}
+	for name, permissions := range organizationRolePermissions {
+		if _, err := s.seedRole(name, models.RoleScopeOrganization, permissions); err != nil {
+			return err
+		}
+	}
+
+	admin, err := s.roleRepo.FindRoleByName(AdminRole, models.RoleScopeGlobal)
+	if err != nil {
+		return err
+	}
+
+	for _, email := range adminEmails {
+		email = strings.TrimSpace(email)
+		if email == "" {
+			continue
+		}
+		user, err := s.userRepo.FindByEmail(email)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			log.Printf("WARNING: bootstrap admin %s is not registered yet", email)
+			continue
+		}
+		if err := s.roleRepo.AssignRole(user.ID, admin.ID); err != nil {
+			return fmt.Errorf("failed to grant admin role to %s: %w", email, err)
+		}
+	}
+
+	return nil
+}
+
+// seedRole creates a built-in role, or adds built-in permissions that were
+// introduced after it was first created. Permissions granted by operators are
+// left in place.
+func (s *rbacService) seedRole(name, scope string, permissions []string) (*models.Role, error) {
+	perms, err := s.roleRepo.FindPermissionsByName(permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.roleRepo.FindRoleByName(name, scope)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role, err = s.roleRepo.CreateRole(&models.Role{
+			Name:        name,
+			Scope:       scope,
+			Description: "Built-in " + scope + " role",
+			Permissions: perms,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s role %s: %w", scope, name, err)
+		}
+		return role, nil
+	}
+
+	role.Permissions = mergePermissions(role.Permissions, perms)
+	if err := s.roleRepo.UpdateRole(role); err != nil {
+		return nil, fmt.Errorf("failed to update %s role %s: %w", scope, name, err)
+	}
+	return role, nil
+}
+
+func (s *rbacService) resolvePermissions(names []string) ([]models.Permission, error) {
+	perms, err := s.roleRepo.FindPermissionsByName(names)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(perms))
+	for _, permission := range perms {
+		found[permission.Name] = true
+	}
+	for _, name := range names {
+		if !found[name] {
+			return nil, utils.ErrInvalidInput.WithMessagef("unknown permission %q", name)
+		}
+	}
+	return perms, nil
+}
+
+// flattenRoles returns the sorted role names and the sorted union of their
+// permissions.
+func flattenRoles(roles []models.Role) ([]string, []string) {
+	roleNames := make([]string, 0, len(roles))
+	permissionSet := make(map[string]struct{})
+	for _, role := range roles {
+		roleNames = append(roleNames, role.Name)
+		for _, permission := range role.Permissions {
+			permissionSet[permission.Name] = struct{}{}
+		}
+	}
+
+	permissions := make([]string, 0, len(permissionSet))
+	for name := range permissionSet {
+		permissions = append(permissions, name)
+	}
+	sort.Strings(roleNames)
+	sort.Strings(permissions)
+
+	return roleNames, permissions
+}
+
+func mergePermissions(current, required []models.Permission) []models.Permission {
+	seen := make(map[string]bool, len(current))
+	for _, permission := range current {
+		seen[permission.ID] = true
+	}
+	for _, permission := range required {
+		if !seen[permission.ID] {
+			current = append(current, permission)
+		}
+	}
+	return current
+}
+
+func isBuiltInRole(role *models.Role) bool {
+	if role.Scope == models.RoleScopeOrganization {
+		_, ok := organizationRolePermissions[role.Name]
+		return ok
+	}
+	_, ok := globalRolePermissions[role.Name]
+	return ok
+}
+
+// isValidRBACName accepts lowercase names such as "admin" or "users:write".
+func isValidRBACName(name string) bool {
+	if name == "" || len(name) > 64 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == ':' || r == '_' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -8,12 +8,61 @@ import (
 )
 
 type RedisService interface {
-	// Token Management
+	// Token Management. Refresh tokens are stored per session: the user's
+	// own session is keyed by the user ID, OAuth client sessions by
+	// "<userID>:<clientID>".
 	StoreRefreshToken(ctx context.Context, userID, token string, expiry time.Duration) error
 	GetRefreshToken(ctx context.Context, userID string) (string, error)
 	DeleteRefreshToken(ctx context.Context, userID string) error
+	// DeleteClientRefreshTokens ends all of the user's OAuth client sessions.
+	DeleteClientRefreshTokens(ctx context.Context, userID string) error
+	// DeleteRefreshTokensOfClient ends every user's session with an OAuth
+	// client.
+	DeleteRefreshTokensOfClient(ctx context.Context, clientID string) error
 	BlacklistToken(ctx context.Context, token string, expiry time.Duration) error
 	IsTokenBlacklisted(ctx context.Context, token string) (bool, error)
+	// Revocation watermarks invalidate every access token issued to a user
+	// up to a point in time, including the rest of its second. They only
+	// need to live as long as the longest access token lifetime. Client
+	// sessions have their own watermark, keyed by "<userID>:<clientID>", and
+	// so do deleted clients, keyed by "client:<clientID>".
+	SetRevocationWatermark(ctx context.Context, userID string, at time.Time, expiry time.Duration) error
+	GetRevocationWatermark(ctx context.Context, userID string) (int64, error) // 0 if none
+
+	// Pending email changes hold the requested address until it is
+	// confirmed. GetPendingEmailChange returns "" if there is none.
+	StorePendingEmailChange(ctx context.Context, userID, value string, expiry time.Duration) error
+	GetPendingEmailChange(ctx context.Context, userID string) (string, error)
+	DeletePendingEmailChange(ctx context.Context, userID string) error
+
+	// Authorization codes are single use: ConsumeAuthorizationCode deletes
+	// the code and returns "" if it doesn't exist.
+	StoreAuthorizationCode(ctx context.Context, code, value string, expiry time.Duration) error
+	ConsumeAuthorizationCode(ctx context.Context, code string) (string, error)
+	// MarkClientAssertionUsed records the jti of a client assertion until it
+	// expires and reports whether it was the first use.
+	MarkClientAssertionUsed(ctx context.Context, clientID, jti string, expiry time.Duration) (bool, error)
+
+	// Device codes (RFC 8628) are also found by their user code.
+	// GetDeviceCode and FindDeviceCode return "" if the code doesn't exist,
+	// UpdateDeviceCode keeps its expiry and ConsumeDeviceCode deletes it.
+	StoreDeviceCode(ctx context.Context, deviceCode, userCode, value string, expiry time.Duration) error
+	GetDeviceCode(ctx context.Context, deviceCode string) (string, error)
+	FindDeviceCode(ctx context.Context, userCode string) (string, error)
+	UpdateDeviceCode(ctx context.Context, deviceCode, value string) error
+	ConsumeDeviceCode(ctx context.Context, deviceCode string) (string, error)
+	// MarkDeviceCodePolled reports false if the device code was already
+	// polled within interval.
+	MarkDeviceCodePolled(ctx context.Context, deviceCode string, interval time.Duration) (bool, error)
+
+	// Sign ins at upstream identity providers keep their state until the
+	// provider redirects back, and end with a login code the frontend
+	// exchanges for tokens. Both are single use: the Consume methods delete
+	// them and return "" if they don't exist.
+	StoreLoginState(ctx context.Context, state, value string, expiry time.Duration) error
+	ConsumeLoginState(ctx context.Context, state string) (string, error)
+	StoreLoginCode(ctx context.Context, code, value string, expiry time.Duration) error
+	ConsumeLoginCode(ctx context.Context, code string) (string, error)
 
 	// Rate Limiting
 	IncrementRequestCount(ctx context.Context, key string, window time.Duration) (int, error)
@@ -39,6 +88,26 @@ func (r *redisService) DeleteRefreshToken(ctx context.Context, userID string) er
 	return r.client.Del(ctx, "refresh:"+userID).Err()
 }
 
+func (r *redisService) DeleteClientRefreshTokens(ctx context.Context, userID string) error {
+	iter := r.client.Scan(ctx, 0, "refresh:"+userID+":*", 100).Iterator()
+	for iter.Next(ctx) {
+		if err := r.client.Del(ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+func (r *redisService) DeleteRefreshTokensOfClient(ctx context.Context, clientID string) error {
+	iter := r.client.Scan(ctx, 0, "refresh:*:"+clientID, 100).Iterator()
+	for iter.Next(ctx) {
+		if err := r.client.Del(ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
 func (r *redisService) BlacklistToken(ctx context.Context, token string, expiry time.Duration) error {
 	return r.client.Set(ctx, "blacklist:"+token, "1", expiry).Err()
 }
@@ -48,6 +117,118 @@ func (r *redisService) IsTokenBlacklisted(ctx context.Context, token string) (bo
 	return res > 0, err
 }
 
+func (r *redisService) SetRevocationWatermark(ctx context.Context, userID string, at time.Time, expiry time.Duration) error {
+	return r.client.Set(ctx, "revoked_before:"+userID, at.Unix(), expiry).Err()
+}
+
+func (r *redisService) GetRevocationWatermark(ctx context.Context, userID string) (int64, error) {
+	ts, err := r.client.Get(ctx, "revoked_before:"+userID).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return ts, err
+}
+
+func (r *redisService) StorePendingEmailChange(ctx context.Context, userID, value string, expiry time.Duration) error {
+	return r.client.Set(ctx, "email_change:"+userID, value, expiry).Err()
+}
+
+func (r *redisService) GetPendingEmailChange(ctx context.Context, userID string) (string, error) {
+	value, err := r.client.Get(ctx, "email_change:"+userID).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+func (r *redisService) DeletePendingEmailChange(ctx context.Context, userID string) error {
+	return r.client.Del(ctx, "email_change:"+userID).Err()
+}
+
+func (r *redisService) StoreAuthorizationCode(ctx context.Context, code, value string, expiry time.Duration) error {
+	return r.client.Set(ctx, "oauth_code:"+code, value, expiry).Err()
+}
+
+func (r *redisService) ConsumeAuthorizationCode(ctx context.Context, code string) (string, error) {
+	value, err := r.client.GetDel(ctx, "oauth_code:"+code).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+func (r *redisService) MarkClientAssertionUsed(ctx context.Context, clientID, jti string, expiry time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, "client_assertion:"+clientID+":"+jti, "1", expiry).Result()
+}
+
+func (r *redisService) StoreDeviceCode(ctx context.Context, deviceCode, userCode, value string, expiry time.Duration) error {
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, "device_code:"+deviceCode, value, expiry)
+	pipe.Set(ctx, "user_code:"+userCode, deviceCode, expiry)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *redisService) GetDeviceCode(ctx context.Context, deviceCode string) (string, error) {
+	value, err := r.client.Get(ctx, "device_code:"+deviceCode).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+func (r *redisService) FindDeviceCode(ctx context.Context, userCode string) (string, error) {
+	deviceCode, err := r.client.Get(ctx, "user_code:"+userCode).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return deviceCode, err
+}
+
+func (r *redisService) UpdateDeviceCode(ctx context.Context, deviceCode, value string) error {
+	err := r.client.SetArgs(ctx, "device_code:"+deviceCode, value, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
+
+func (r *redisService) ConsumeDeviceCode(ctx context.Context, deviceCode string) (string, error) {
+	value, err := r.client.GetDel(ctx, "device_code:"+deviceCode).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+func (r *redisService) MarkDeviceCodePolled(ctx context.Context, deviceCode string, interval time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, "device_poll:"+deviceCode, "1", interval).Result()
+}
+
+func (r *redisService) StoreLoginState(ctx context.Context, state, value string, expiry time.Duration) error {
+	return r.client.Set(ctx, "login_state:"+state, value, expiry).Err()
+}
+
+func (r *redisService) ConsumeLoginState(ctx context.Context, state string) (string, error) {
+	value, err := r.client.GetDel(ctx, "login_state:"+state).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+func (r *redisService) StoreLoginCode(ctx context.Context, code, value string, expiry time.Duration) error {
+	return r.client.Set(ctx, "login_code:"+code, value, expiry).Err()
+}
+
+func (r *redisService) ConsumeLoginCode(ctx context.Context, code string) (string, error) {
+	value, err := r.client.GetDel(ctx, "login_code:"+code).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
 func (r *redisService) IncrementRequestCount(ctx context.Context, key string, window time.Duration) (int, error) {
 	// Using Redis transactions for atomic increment
 	var count int
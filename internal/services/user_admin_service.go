@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/repositories"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+const (
+	defaultUsersPerPage = 20
+	maxUsersPerPage     = 100
+)
+
+type UserAdminService interface {
+	ListUsers(filter models.UserFilter) (*models.UserList, error)
+	GetUser(userID string) (*models.User, error)
+	// CreateUser creates an account. When password is empty the user is sent
+	// a link to choose one.
+	CreateUser(email, password string) (*models.User, error)
+	UpdateEmail(ctx context.Context, userID, email string) (*models.User, error)
+	SetActive(ctx context.Context, userID string, active bool) (*models.User, error)
+	ForcePasswordReset(ctx context.Context, userID string) error
+	// UpdateAppMetadata replaces the user's app_metadata, which users cannot
+	// change themselves.
+	UpdateAppMetadata(ctx context.Context, userID string, metadata models.JSONMap) (*models.User, error)
+	// DeleteUser soft-deletes the account; it is purged after the grace period
+	// unless restored first.
+	DeleteUser(ctx context.Context, userID string) error
+	RestoreUser(ctx context.Context, userID string) (*models.User, error)
+	RevokeSessions(ctx context.Context, userID string) error
+}
+
+type userAdminService struct {
+	userRepo             repositories.UserRepository
+	authService          AuthService
+	passwordResetService PasswordResetService
+	auditService         AuditService
+	emails               utils.EmailNormalizer
+}
+
+func NewUserAdminService(
+	userRepo repositories.UserRepository,
+	authService AuthService,
+	passwordResetService PasswordResetService,
+	auditService AuditService,
+	emails utils.EmailNormalizer,
+) UserAdminService {
+	return &userAdminService{
+		userRepo:             userRepo,
+		authService:          authService,
+		passwordResetService: passwordResetService,
+		auditService:         auditService,
+		emails:               emails,
+	}
+}
+
+func (s *userAdminService) ListUsers(filter models.UserFilter) (*models.UserList, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PerPage < 1 {
+		filter.PerPage = defaultUsersPerPage
+	}
+	if filter.PerPage > maxUsersPerPage {
+		filter.PerPage = maxUsersPerPage
+	}
+
+	users, total, err := s.userRepo.List(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.UserList{
+		Users:   users,
+		Total:   total,
+		Page:    filter.Page,
+		PerPage: filter.PerPage,
+	}, nil
+}
+
+func (s *userAdminService) GetUser(userID string) (*models.User, error) {
+	return s.userRepo.FindByID(userID)
+}
+
+func (s *userAdminService) CreateUser(email, password string) (*models.User, error) {
+	email = s.emails.Normalize(email)
+	if password != "" {
+		return s.authService.Register(email, password)
+	}
+
+	if err := utils.ValidateEmail(email); err != nil {
+		return nil, err
+	}
+
+	existingUser, err := s.userRepo.FindByEmailUnscoped(email)
+	if err != nil {
+		return nil, err
+	}
+	if existingUser != nil {
+		return nil, utils.ErrUserExists
+	}
+
+	// An empty hash never verifies, so the account is unusable until the
+	// user follows the reset link.
+	user, err := s.userRepo.Create(&models.User{Email: email})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.passwordResetService.SendResetLink(user); err != nil {
+		log.Printf("WARNING: failed to send password setup link to %s: %v", user.Email, err)
+	}
+	return user, nil
+}
+
+func (s *userAdminService) UpdateEmail(ctx context.Context, userID, email string) (*models.User, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	email = s.emails.Normalize(email)
+	if err := utils.ValidateEmail(email); err != nil {
+		return nil, err
+	}
+
+	existingUser, err := s.userRepo.FindByEmailUnscoped(email)
+	if err != nil {
+		return nil, err
+	}
+	if existingUser != nil && existingUser.ID != user.ID {
+		return nil, utils.ErrUserExists
+	}
+
+	oldEmail := user.Email
+	user.Email = email
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	s.auditService.Record(ctx, user.ID, models.AuditEmailChanged, models.JSONMap{"old_email": oldEmail, "new_email": email})
+	return user, nil
+}
+
+func (s *userAdminService) SetActive(ctx context.Context, userID string, active bool) (*models.User, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Active = active
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	eventType := models.AuditAccountReactivated
+	if !active {
+		if err := s.authService.RevokeSessions(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		eventType = models.AuditAccountDeactivated
+	}
+
+	s.auditService.Record(ctx, user.ID, eventType, nil)
+	return user, nil
+}
+
+func (s *userAdminService) ForcePasswordReset(ctx context.Context, userID string) error {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return err
+	}
+
+	user.PasswordResetRequired = true
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	if err := s.authService.RevokeSessions(ctx, user.ID); err != nil {
+		return err
+	}
+	return s.passwordResetService.SendResetLink(user)
+}
+
+func (s *userAdminService) UpdateAppMetadata(ctx context.Context, userID string, metadata models.JSONMap) (*models.User, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata == nil {
+		metadata = models.JSONMap{}
+	}
+	if err := checkMetadataSize(metadata); err != nil {
+		return nil, err
+	}
+
+	user.AppMetadata = metadata
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *userAdminService) DeleteUser(ctx context.Context, userID string) error {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.Delete(user.ID); err != nil {
+		return err
+	}
+	if err := s.authService.RevokeSessions(ctx, user.ID); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, user.ID, models.AuditAccountDeleted, nil)
+	return nil
+}
+
+func (s *userAdminService) RestoreUser(ctx context.Context, userID string) (*models.User, error) {
+	restored, err := s.userRepo.Restore(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !restored {
+		return nil, utils.ErrUserNotFound
+	}
+
+	s.auditService.Record(ctx, userID, models.AuditAccountRestored, nil)
+	return s.findUser(userID)
+}
+
+func (s *userAdminService) RevokeSessions(ctx context.Context, userID string) error {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.authService.RevokeSessions(ctx, user.ID); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, user.ID, models.AuditSessionsRevoked, nil)
+	return nil
+}
+
+func (s *userAdminService) findUser(userID string) (*models.User, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, utils.ErrUserNotFound
+	}
+	return user, nil
+}
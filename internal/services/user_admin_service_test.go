@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kimutaiwycliff/auth-service/internal/models"
+	"github.com/kimutaiwycliff/auth-service/internal/utils"
+)
+
+func TestUpdateEmailNormalizesOnce(t *testing.T) {
+	users := newMemoryUsers(
+		&models.User{ID: "user-1", Email: "alice@example.com", Active: true},
+		&models.User{ID: "user-2", Email: "bob@xn--bcher-kva.example", Active: true},
+	)
+	audit := &recordedAudit{}
+	s := NewUserAdminService(users, nil, nil, audit, utils.EmailNormalizer{IDN: true})
+
+	user, err := s.UpdateEmail(context.Background(), "user-1", " Alice@Bücher.example ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "alice@xn--bcher-kva.example" {
+		t.Errorf("stored email = %q, want the punycode form", user.Email)
+	}
+	if len(audit.events) != 1 || audit.events[0].Metadata["new_email"] != user.Email {
+		t.Errorf("audit events = %+v, want new_email %q", audit.events, user.Email)
+	}
+
+	// The unicode form of another user's email is the same address
+	_, err = s.UpdateEmail(context.Background(), "user-1", "bob@bücher.example")
+	if !errors.Is(err, utils.ErrUserExists) {
+		t.Errorf("err = %v, want %v", err, utils.ErrUserExists)
+	}
+}
+
+func TestDeactivatingUserRevokesAccessTokens(t *testing.T) {
+	users := newMemoryUsers(&models.User{ID: "user-1", Email: "alice@example.com", Active: true})
+	auth := &authService{
+		userRepo:     users,
+		jwtService:   NewJWTService("test-secret", time.Minute, time.Hour),
+		redisService: newMemoryRedis(),
+		rbacService:  &fixedRBAC{},
+	}
+	s := NewUserAdminService(users, auth, nil, discardAudit{}, utils.EmailNormalizer{})
+
+	tokens, err := auth.issueTokens(context.Background(), session{userID: "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetActive(context.Background(), "user-1", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Issued within the second of the revocation
+	if _, err := auth.ValidateAccessToken(context.Background(), tokens.AccessToken); !errors.Is(err, utils.ErrTokenRevoked) {
+		t.Errorf("access token: err = %v, want %v", err, utils.ErrTokenRevoked)
+	}
+	if _, err := auth.RefreshToken(context.Background(), tokens.RefreshToken); err == nil {
+		t.Error("refresh token still works")
+	}
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"strings"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -9,14 +11,47 @@ func HashPassword(password string) (string, error) {
 	return string(bytes), err
 }
 
+// VerifyPassword checks a password against a stored hash. Besides native
+// bcrypt hashes it understands the foreign formats accepted by the user
+// import (see DetectHashAlgorithm).
 func VerifyPassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	switch DetectHashAlgorithm(hash) {
+	case HashBcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(normalizeBcryptHash(hash)), []byte(password))
+		return err == nil
+	case HashPBKDF2SHA256, HashPBKDF2SHA1:
+		return verifyDjangoPBKDF2(password, hash)
+	case HashScrypt:
+		return verifyScrypt(password, hash)
+	case HashFirebaseScrypt:
+		return verifyFirebaseScrypt(password, hash)
+	case HashSHA256Crypt, HashSHA512Crypt:
+		return verifySHACrypt(password, hash)
+	default:
+		return false
+	}
+}
+
+// NeedsRehash reports whether a stored hash should be replaced with a fresh
+// native hash the next time the plaintext password is available.
+func NeedsRehash(hash string) bool {
+	if DetectHashAlgorithm(hash) != HashBcrypt {
+		return true
+	}
+	if !strings.HasPrefix(hash, "$2a$") && !strings.HasPrefix(hash, "$2b$") {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < bcrypt.DefaultCost
 }
 
-func IsEmailValid(email string) bool {
-	// Simple regex check - replace with proper validation
-	return len(email) >= 3 && len(email) <= 254
+// normalizeBcryptHash maps the PHP/crypt_blowfish "$2y$" and "$2x$" prefixes
+// onto "$2a$", which is what the Go implementation expects.
+func normalizeBcryptHash(hash string) string {
+	if strings.HasPrefix(hash, "$2y$") || strings.HasPrefix(hash, "$2x$") {
+		return "$2a$" + hash[4:]
+	}
+	return hash
 }
 
 func IsPasswordValid(password string) bool {
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// EmailNormalizer returns the canonical form used to store and look up
+// emails: trimmed and lowercased, with the domain in punycode when IDN is
+// set. Enabling IDN on an existing database requires rewriting stored emails
+// first, see cmd/emaildedup.
+type EmailNormalizer struct {
+	IDN bool
+}
+
+// Normalize returns email in canonical form. Emails that can't be
+// normalized are returned trimmed and lowercased so validation can reject
+// them.
+func (n EmailNormalizer) Normalize(email string) string {
+	email = NormalizeEmail(email)
+	if !n.IDN {
+		return email
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	return email[:at+1] + NormalizeEmailDomain(email[at+1:])
+}
+
+// NormalizeEmail trims and lowercases email, leaving international domains
+// as they are.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizeEmailDomain lowercases domain and converts it to punycode.
+// Domains that aren't valid IDNs are returned lowercased.
+func NormalizeEmailDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return domain
+	}
+	return ascii
+}
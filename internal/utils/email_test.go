@@ -0,0 +1,39 @@
+package utils
+
+import "testing"
+
+func TestEmailNormalizer(t *testing.T) {
+	tests := []struct {
+		email string
+		idn   bool
+		want  string
+	}{
+		{" User@Example.COM ", false, "user@example.com"},
+		{" User@Example.COM ", true, "user@example.com"},
+		{"user@Bücher.example", false, "user@bücher.example"},
+		{"user@Bücher.example", true, "user@xn--bcher-kva.example"},
+		{"user@xn--bcher-kva.example", true, "user@xn--bcher-kva.example"},
+		{"not an email", true, "not an email"},
+	}
+	for _, tt := range tests {
+		n := EmailNormalizer{IDN: tt.idn}
+		if got := n.Normalize(tt.email); got != tt.want {
+			t.Errorf("EmailNormalizer{IDN: %v}.Normalize(%q) = %q, want %q", tt.idn, tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestEmailDomainPolicyMatchesIDNDomains(t *testing.T) {
+	p, err := NewEmailDomainPolicy(nil, []string{"bücher.example"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, domain := range []string{"bücher.example", "xn--bcher-kva.example", "mail.BÜCHER.example"} {
+		if reason := p.check(domain); reason != EmailReasonDomainBlocked {
+			t.Errorf("check(%q) = %q, want %q", domain, reason, EmailReasonDomainBlocked)
+		}
+	}
+	if reason := p.check("example.com"); reason != "" {
+		t.Errorf("check(example.com) = %q, want it accepted", reason)
+	}
+}
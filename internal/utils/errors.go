@@ -1 +1,137 @@
 package utils
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// AppError is an error that is safe to show to clients. Status is the HTTP
+// status it is reported with and Code a stable machine-readable identifier.
+// Errors that are not AppErrors are reported as internal errors.
+type AppError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func NewAppError(status int, code, message string) *AppError {
+	return &AppError{Status: status, Code: code, Message: message}
+}
+
+func (e *AppError) Error() string {
+	return e.Message
+}
+
+// Is matches errors by code, so errors.Is(err, ErrInvalidInput) also holds
+// for ErrInvalidInput.WithMessage(...).
+func (e *AppError) Is(target error) bool {
+	t, ok := target.(*AppError)
+	return ok && t.Code == e.Code
+}
+
+// WithMessage returns a copy of e with a more specific message.
+func (e *AppError) WithMessage(message string) *AppError {
+	return &AppError{Status: e.Status, Code: e.Code, Message: message}
+}
+
+func (e *AppError) WithMessagef(format string, args ...interface{}) *AppError {
+	return e.WithMessage(fmt.Sprintf(format, args...))
+}
+
+// Authentication
+var (
+	ErrUnauthorized       = NewAppError(http.StatusUnauthorized, "unauthorized", "authentication required")
+	ErrInvalidCredentials = NewAppError(http.StatusUnauthorized, "invalid_credentials", "invalid credentials")
+	// ErrAccountDisabled is returned when a deactivated user tries to log in
+	// or refresh a session.
+	ErrAccountDisabled          = NewAppError(http.StatusForbidden, "account_disabled", "account is disabled")
+	ErrPasswordResetRequired    = NewAppError(http.StatusForbidden, "password_reset_required", "password reset required")
+	ErrReauthenticationRequired = NewAppError(http.StatusUnauthorized, "reauthentication_required", "recent authentication required")
+	ErrWeakPassword             = NewAppError(http.StatusBadRequest, "weak_password", "password must be at least 8 characters")
+	// ErrExternalLoginFailed means signing in with an upstream identity
+	// provider didn't succeed, e.g. because the user cancelled it there or
+	// the provider's response didn't check out.
+	ErrExternalLoginFailed = NewAppError(http.StatusBadRequest, "external_login_failed", "sign in with the identity provider failed")
+)
+
+// Tokens and links
+var (
+	ErrInvalidToken     = NewAppError(http.StatusUnauthorized, "invalid_token", "invalid token")
+	ErrTokenInvalidated = NewAppError(http.StatusUnauthorized, "token_invalidated", "token is invalidated")
+	// ErrTokenRevoked means the token was issued before the user's sessions
+	// were revoked (see RedisService.SetRevocationWatermark).
+	ErrTokenRevoked = NewAppError(http.StatusUnauthorized, "token_revoked", "token has been revoked")
+	// ErrTokenReused means a refresh token was presented after it had been
+	// rotated, which suggests it was stolen.
+	ErrTokenReused = NewAppError(http.StatusUnauthorized, "token_reused", "refresh token has already been used")
+	ErrInvalidLink = NewAppError(http.StatusBadRequest, "invalid_link", "invalid or expired link")
+)
+
+// Requests and resources
+var (
+	ErrInvalidInput     = NewAppError(http.StatusBadRequest, "invalid_input", "invalid request")
+	ErrValidationFailed = NewAppError(http.StatusUnprocessableEntity, "validation_failed", "validation failed")
+	ErrInvalidEmail     = NewAppError(http.StatusBadRequest, "invalid_email", "invalid email address")
+	ErrForbidden        = NewAppError(http.StatusForbidden, "forbidden", "insufficient permissions")
+	ErrNotFound         = NewAppError(http.StatusNotFound, "not_found", "not found")
+	ErrUserNotFound     = NewAppError(http.StatusNotFound, "user_not_found", "user not found")
+	ErrConflict         = NewAppError(http.StatusConflict, "conflict", "conflict")
+	ErrUserExists       = NewAppError(http.StatusConflict, "user_exists", "user already exists")
+	ErrEmailInUse       = NewAppError(http.StatusConflict, "email_in_use", "email is already in use")
+	ErrUsernameTaken    = NewAppError(http.StatusConflict, "username_taken", "username is already taken")
+	ErrRateLimited      = NewAppError(http.StatusTooManyRequests, "rate_limited", "too many requests")
+	ErrInternal         = NewAppError(http.StatusInternalServerError, "internal_error", "internal server error")
+)
+
+// OAuthError is an error from the OAuth endpoints. It is reported in the
+// RFC 6749 format ({"error": ..., "error_description": ...}) rather than as
+// problem details, and the authorization endpoint passes it back to the
+// client's redirect URI.
+type OAuthError struct {
+	Status      int
+	Code        string
+	Description string
+}
+
+func NewOAuthError(status int, code, description string) *OAuthError {
+	return &OAuthError{Status: status, Code: code, Description: description}
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func (e *OAuthError) Is(target error) bool {
+	t, ok := target.(*OAuthError)
+	return ok && t.Code == e.Code
+}
+
+// WithDescription returns a copy of e with a human-readable description.
+func (e *OAuthError) WithDescription(description string) *OAuthError {
+	return &OAuthError{Status: e.Status, Code: e.Code, Description: description}
+}
+
+// OAuth error codes from RFC 6749.
+var (
+	ErrOAuthInvalidRequest          = NewOAuthError(http.StatusBadRequest, "invalid_request", "")
+	ErrOAuthInvalidClient           = NewOAuthError(http.StatusUnauthorized, "invalid_client", "")
+	ErrOAuthInvalidGrant            = NewOAuthError(http.StatusBadRequest, "invalid_grant", "")
+	ErrOAuthUnauthorizedClient      = NewOAuthError(http.StatusBadRequest, "unauthorized_client", "")
+	ErrOAuthUnsupportedGrantType    = NewOAuthError(http.StatusBadRequest, "unsupported_grant_type", "")
+	ErrOAuthUnsupportedResponseType = NewOAuthError(http.StatusBadRequest, "unsupported_response_type", "")
+	ErrOAuthInvalidScope            = NewOAuthError(http.StatusBadRequest, "invalid_scope", "")
+	ErrOAuthAccessDenied            = NewOAuthError(http.StatusBadRequest, "access_denied", "")
+	// ErrOAuthInsufficientScope is from RFC 6750. It is returned by resource
+	// endpoints such as /oauth/userinfo.
+	ErrOAuthInsufficientScope = NewOAuthError(http.StatusForbidden, "insufficient_scope", "")
+	// Token endpoint errors of the device authorization grant (RFC 8628).
+	ErrOAuthAuthorizationPending = NewOAuthError(http.StatusBadRequest, "authorization_pending", "")
+	ErrOAuthSlowDown             = NewOAuthError(http.StatusBadRequest, "slow_down", "")
+	ErrOAuthExpiredToken         = NewOAuthError(http.StatusBadRequest, "expired_token", "")
+	// ErrOAuthInvalidTarget is from RFC 8693: the requested audience is not
+	// allowed.
+	ErrOAuthInvalidTarget = NewOAuthError(http.StatusBadRequest, "invalid_target", "")
+)
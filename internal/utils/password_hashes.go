@@ -0,0 +1,285 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Password hash algorithms understood by VerifyPassword. Everything other
+// than HashBcrypt is only accepted through the user import and is replaced
+// with a native hash after the first successful login.
+const (
+	HashBcrypt         = "bcrypt"
+	HashPBKDF2SHA256   = "pbkdf2_sha256"
+	HashPBKDF2SHA1     = "pbkdf2_sha1"
+	HashScrypt         = "scrypt"
+	HashFirebaseScrypt = "firebase-scrypt"
+	HashSHA256Crypt    = "sha256-crypt"
+	HashSHA512Crypt    = "sha512-crypt"
+)
+
+const firebaseScryptPrefix = "$firebase-scrypt$"
+
+// DetectHashAlgorithm identifies the format of a stored password hash and
+// returns one of the Hash* constants, or "" when the format is unknown.
+func DetectHashAlgorithm(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"),
+		strings.HasPrefix(hash, "$2y$"), strings.HasPrefix(hash, "$2x$"),
+		strings.HasPrefix(hash, "$2$"):
+		return HashBcrypt
+	case strings.HasPrefix(hash, "pbkdf2_sha256$"):
+		return HashPBKDF2SHA256
+	case strings.HasPrefix(hash, "pbkdf2_sha1$"):
+		return HashPBKDF2SHA1
+	case strings.HasPrefix(hash, "$scrypt$"):
+		return HashScrypt
+	case strings.HasPrefix(hash, firebaseScryptPrefix):
+		return HashFirebaseScrypt
+	case strings.HasPrefix(hash, "$5$"):
+		return HashSHA256Crypt
+	case strings.HasPrefix(hash, "$6$"):
+		return HashSHA512Crypt
+	default:
+		return ""
+	}
+}
+
+// ValidatePasswordHash checks that a hash is in a supported format and that
+// its parameters can be parsed, without needing the plaintext password.
+func ValidatePasswordHash(hash string) error {
+	var err error
+	switch DetectHashAlgorithm(hash) {
+	case HashBcrypt:
+		if len(hash) < 59 {
+			err = fmt.Errorf("bcrypt hash too short")
+		}
+	case HashPBKDF2SHA256, HashPBKDF2SHA1:
+		_, _, _, _, err = parseDjangoPBKDF2(hash)
+	case HashScrypt:
+		_, err = parseScrypt(hash)
+	case HashFirebaseScrypt:
+		_, err = parseFirebaseScrypt(hash)
+	case HashSHA256Crypt, HashSHA512Crypt:
+		_, err = parseSHACrypt(hash)
+	default:
+		err = fmt.Errorf("unsupported password hash format")
+	}
+	return err
+}
+
+// maxPBKDF2Iterations caps the cost of imported PBKDF2 hashes; Django's
+// current default is 1,000,000.
+const maxPBKDF2Iterations = 5000000
+
+// Django: pbkdf2_sha256$<iterations>$<salt>$<base64 hash>
+func parseDjangoPBKDF2(encoded string) (func() hash.Hash, int, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 {
+		return nil, 0, nil, nil, fmt.Errorf("malformed pbkdf2 hash")
+	}
+
+	var h func() hash.Hash
+	switch parts[0] {
+	case "pbkdf2_sha256":
+		h = sha256.New
+	case "pbkdf2_sha1":
+		h = sha1.New
+	default:
+		return nil, 0, nil, nil, fmt.Errorf("unsupported pbkdf2 digest %q", parts[0])
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return nil, 0, nil, nil, fmt.Errorf("invalid pbkdf2 iteration count")
+	}
+	if iterations > maxPBKDF2Iterations {
+		return nil, 0, nil, nil, fmt.Errorf("pbkdf2 iteration count too high")
+	}
+
+	sum, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(sum) == 0 {
+		return nil, 0, nil, nil, fmt.Errorf("invalid pbkdf2 hash encoding")
+	}
+
+	return h, iterations, []byte(parts[2]), sum, nil
+}
+
+func verifyDjangoPBKDF2(password, encoded string) bool {
+	h, iterations, salt, sum, err := parseDjangoPBKDF2(encoded)
+	if err != nil {
+		return false
+	}
+	derived := pbkdf2.Key([]byte(password), salt, iterations, len(sum), h)
+	return subtle.ConstantTimeCompare(derived, sum) == 1
+}
+
+// Limits on the parameters of imported scrypt hashes. Verifying one takes
+// 128·N·r bytes of memory and p times as long, so a hash with huge
+// parameters could take the server down on every login attempt.
+const (
+	maxScryptMemory      = 256 << 20
+	maxScryptParallelism = 16
+)
+
+type scryptParams struct {
+	n, r, p int
+	salt    []byte
+	sum     []byte
+}
+
+// passlib: $scrypt$ln=<log2 N>,r=<r>,p=<p>$<salt>$<hash>, using the "adapted"
+// base64 alphabet ('.' instead of '+') without padding.
+func parseScrypt(encoded string) (*scryptParams, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != "scrypt" {
+		return nil, fmt.Errorf("malformed scrypt hash")
+	}
+
+	params := &scryptParams{}
+	for _, kv := range strings.Split(parts[2], ",") {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed scrypt parameters")
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid scrypt parameter %q", key)
+		}
+		switch key {
+		case "ln":
+			if n > 30 {
+				return nil, fmt.Errorf("scrypt cost too high")
+			}
+			params.n = 1 << n
+		case "r":
+			params.r = n
+		case "p":
+			params.p = n
+		default:
+			return nil, fmt.Errorf("unknown scrypt parameter %q", key)
+		}
+	}
+	if params.n == 0 || params.r == 0 || params.p == 0 {
+		return nil, fmt.Errorf("incomplete scrypt parameters")
+	}
+	if params.r > maxScryptMemory/128/params.n {
+		return nil, fmt.Errorf("scrypt memory cost too high")
+	}
+	if params.p > maxScryptParallelism {
+		return nil, fmt.Errorf("scrypt parallelism too high")
+	}
+
+	var err error
+	if params.salt, err = decodeAdaptedBase64(parts[3]); err != nil {
+		return nil, fmt.Errorf("invalid scrypt salt encoding")
+	}
+	if params.sum, err = decodeAdaptedBase64(parts[4]); err != nil || len(params.sum) == 0 {
+		return nil, fmt.Errorf("invalid scrypt hash encoding")
+	}
+	return params, nil
+}
+
+func verifyScrypt(password, encoded string) bool {
+	params, err := parseScrypt(encoded)
+	if err != nil {
+		return false
+	}
+	derived, err := scrypt.Key([]byte(password), params.salt, params.n, params.r, params.p, len(params.sum))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(derived, params.sum) == 1
+}
+
+func decodeAdaptedBase64(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.ReplaceAll(strings.TrimRight(s, "="), ".", "+"))
+}
+
+type firebaseScryptParams struct {
+	rounds        int
+	memCost       int
+	saltSeparator []byte
+	signerKey     []byte
+	salt          []byte
+	sum           []byte
+}
+
+// EncodeFirebaseScryptHash packs a hash exported from Firebase Auth together
+// with the project's hash parameters into a single self-describing string:
+//
+//	$firebase-scrypt$r=<rounds>,m=<mem_cost>$<salt separator>$<signer key>$<salt>$<hash>
+//
+// All binary values are the standard base64 strings Firebase exports.
+func EncodeFirebaseScryptHash(hash, salt, signerKey, saltSeparator string, rounds, memCost int) (string, error) {
+	encoded := fmt.Sprintf("%sr=%d,m=%d$%s$%s$%s$%s",
+		firebaseScryptPrefix, rounds, memCost, saltSeparator, signerKey, salt, hash)
+	if _, err := parseFirebaseScrypt(encoded); err != nil {
+		return "", err
+	}
+	return encoded, nil
+}
+
+func parseFirebaseScrypt(encoded string) (*firebaseScryptParams, error) {
+	parts := strings.Split(strings.TrimPrefix(encoded, firebaseScryptPrefix), "$")
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("malformed firebase-scrypt hash")
+	}
+
+	params := &firebaseScryptParams{}
+	if _, err := fmt.Sscanf(parts[0], "r=%d,m=%d", &params.rounds, &params.memCost); err != nil {
+		return nil, fmt.Errorf("malformed firebase-scrypt parameters")
+	}
+	if params.rounds < 1 || params.rounds > 8 || params.memCost < 1 || params.memCost > 14 {
+		return nil, fmt.Errorf("firebase-scrypt parameters out of range")
+	}
+
+	fields := []*[]byte{&params.saltSeparator, &params.signerKey, &params.salt, &params.sum}
+	for i, field := range fields {
+		value, err := base64.StdEncoding.DecodeString(parts[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid firebase-scrypt encoding")
+		}
+		*field = value
+	}
+	if len(params.signerKey) == 0 || len(params.sum) == 0 {
+		return nil, fmt.Errorf("firebase-scrypt hash is missing the signer key or hash")
+	}
+	return params, nil
+}
+
+// verifyFirebaseScrypt implements Firebase's modified scrypt: the scrypt
+// output is used as an AES-256-CTR key (zero IV) to encrypt the project's
+// signer key, and the ciphertext is the stored hash.
+func verifyFirebaseScrypt(password, encoded string) bool {
+	params, err := parseFirebaseScrypt(encoded)
+	if err != nil {
+		return false
+	}
+
+	salt := append(append([]byte{}, params.salt...), params.saltSeparator...)
+	key, err := scrypt.Key([]byte(password), salt, 1<<params.memCost, params.rounds, 1, 32)
+	if err != nil {
+		return false
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return false
+	}
+	derived := make([]byte, len(params.signerKey))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(derived, params.signerKey)
+
+	return subtle.ConstantTimeCompare(derived, params.sum) == 1
+}
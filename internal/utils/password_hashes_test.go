@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// The foreign hashes below were made with Python's hashlib and crypt
+// modules and OpenSSL, for the password testPassword.
+const testPassword = "correct horse battery staple"
+
+func TestVerifyPasswordForeignHashes(t *testing.T) {
+	firebase, err := EncodeFirebaseScryptHash(
+		"0MSeef4wYKv4y35WORq9U7xDS/7w8c93jpJPky4SQE0q4WUtAfb88FUYrutJFXjs9VvYAhZmm0OGm76S3HhXvg==",
+		"42xEC+ixf3L2lw==",
+		"jxspr8Ki0RYycVU8zykbdLGjFQ3McFUH0uiiTvC8pVMXAn210wjLNmdZJzxUECKbm0QsEmYUSDzZvpjeJ9WmXA==",
+		"Bw==", 8, 14,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcrypt, err := HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		algorithm string
+		hash      string
+	}{
+		{HashBcrypt, bcrypt},
+		{HashBcrypt, "$2y$" + bcrypt[4:]},
+		{HashPBKDF2SHA256, "pbkdf2_sha256$1000$seasalt$3xmXbyk2QpiyNcnoBbzRPwEBsYPTbDlRdtmLyBvQltA="},
+		{HashPBKDF2SHA1, "pbkdf2_sha1$1000$seasalt$9iRYj0as1r5j+cCBxB+HMlxkyr4="},
+		{HashScrypt, "$scrypt$ln=10,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$7AnzIswxwEinpwz.ntydndYfVHPvOACmX9Vvo8hO1qM"},
+		{HashFirebaseScrypt, firebase},
+		{HashSHA256Crypt, "$5$saltstring$hixOXgchwauyzVtlSM/e7UnQx0qiTk74JE/YU53IbE0"},
+		{HashSHA256Crypt, "$5$rounds=10000$saltstring$MuBxgejRwjAPjTa68X2wDjyAd/FsSde92bM6uLyMQy7"},
+		{HashSHA512Crypt, "$6$saltstring$qvPJY4PeugKzKQqyIJ0gRdJnpS0uaaiZ.X1SaheFedsK/yZPwlluTLS90fJPM41sD5JxCHKgGr1..qt5HqEY8."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hash, func(t *testing.T) {
+			if got := DetectHashAlgorithm(tt.hash); got != tt.algorithm {
+				t.Errorf("DetectHashAlgorithm = %q, want %q", got, tt.algorithm)
+			}
+			if err := ValidatePasswordHash(tt.hash); err != nil {
+				t.Errorf("ValidatePasswordHash: %v", err)
+			}
+			if !VerifyPassword(testPassword, tt.hash) {
+				t.Error("correct password was rejected")
+			}
+			if VerifyPassword(testPassword+"!", tt.hash) {
+				t.Error("wrong password was accepted")
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcrypt, err := HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NeedsRehash(bcrypt) {
+		t.Error("native bcrypt hash needs rehash")
+	}
+	for _, hash := range []string{
+		"$2y$" + bcrypt[4:],
+		"pbkdf2_sha256$1000$seasalt$3xmXbyk2QpiyNcnoBbzRPwEBsYPTbDlRdtmLyBvQltA=",
+		"$5$saltstring$hixOXgchwauyzVtlSM/e7UnQx0qiTk74JE/YU53IbE0",
+	} {
+		if !NeedsRehash(hash) {
+			t.Errorf("NeedsRehash(%q) = false", hash)
+		}
+	}
+}
+
+func TestValidatePasswordHashRejectsExpensiveScrypt(t *testing.T) {
+	const salt, sum = "MDEyMzQ1Njc4OWFiY2RlZg", "7AnzIswxwEinpwz.ntydndYfVHPvOACmX9Vvo8hO1qM"
+	tests := []struct {
+		params string
+		ok     bool
+	}{
+		// passlib's defaults take 64 MiB, the limit is 256 MiB
+		{"ln=16,r=8,p=1", true},
+		{"ln=18,r=8,p=16", true},
+		// 2 GiB
+		{"ln=20,r=16,p=1", false},
+		// r alone overflowing the limit
+		{"ln=1,r=9223372036854775807,p=1", false},
+		{"ln=31,r=1,p=1", false},
+		{"ln=16,r=8,p=64", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.params, func(t *testing.T) {
+			hash := strings.Join([]string{"", "scrypt", tt.params, salt, sum}, "$")
+			if err := ValidatePasswordHash(hash); (err == nil) != tt.ok {
+				t.Errorf("ValidatePasswordHash = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidatePasswordHashRejectsExpensiveIterations(t *testing.T) {
+	tests := []struct {
+		hash string
+		ok   bool
+	}{
+		{"pbkdf2_sha256$1000000$salt$c3Vt", true},
+		{"pbkdf2_sha256$5000000$salt$c3Vt", true},
+		{"pbkdf2_sha256$5000001$salt$c3Vt", false},
+		{"pbkdf2_sha1$2147483647$salt$c3Vt", false},
+		{"$6$rounds=656000$saltsalt$c3Vt", true},
+		{"$6$rounds=5000000$saltsalt$c3Vt", true},
+		{"$6$rounds=5000001$saltsalt$c3Vt", false},
+		{"$5$rounds=999999999$saltsalt$c3Vt", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hash, func(t *testing.T) {
+			if err := ValidatePasswordHash(tt.hash); (err == nil) != tt.ok {
+				t.Errorf("ValidatePasswordHash = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidatePasswordHashRejectsMalformedHashes(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$2a$10$tooshort",
+		"pbkdf2_sha256$0$salt$c3Vt",
+		"pbkdf2_sha256$1000$salt",
+		"pbkdf2_md5$1000$salt$c3Vt",
+		"$scrypt$ln=10,r=8$MDEy$c3Vt",
+		"$scrypt$ln=10,r=8,p=1,x=1$MDEy$c3Vt",
+		"$firebase-scrypt$r=9,m=14$Bw==$c2lnbmVy$c2FsdA==$c3Vt",
+	} {
+		if err := ValidatePasswordHash(hash); err == nil {
+			t.Errorf("ValidatePasswordHash(%q) accepted a malformed hash", hash)
+		}
+	}
+}
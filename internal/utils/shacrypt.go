@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// SHA-crypt ($5$ and $6$) as specified by Ulrich Drepper in
+// https://www.akkadia.org/drepper/SHA-crypt.txt.
+
+const (
+	shaCryptDefaultRounds = 5000
+	shaCryptMinRounds     = 1000
+	shaCryptMaxRounds     = 999999999
+	shaCryptMaxSaltLen    = 16
+	cryptAlphabet         = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// maxShaCryptRounds caps the cost of imported hashes. The spec allows up to
+// shaCryptMaxRounds, which would take minutes to verify.
+const maxShaCryptRounds = 5000000
+
+type shaCryptParams struct {
+	ident        string
+	rounds       int
+	customRounds bool
+	salt         string
+	checksum     string
+}
+
+// Byte order in which the digest is emitted, as (b2, b1, b0) triples.
+var (
+	sha256CryptOrder = [][3]int{
+		{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+		{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+	}
+	sha512CryptOrder = [][3]int{
+		{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+		{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+		{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+		{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+		{62, 20, 41},
+	}
+)
+
+func parseSHACrypt(encoded string) (*shaCryptParams, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 && len(parts) != 5 {
+		return nil, fmt.Errorf("malformed sha-crypt hash")
+	}
+	if parts[1] != "5" && parts[1] != "6" {
+		return nil, fmt.Errorf("unsupported sha-crypt identifier %q", parts[1])
+	}
+
+	params := &shaCryptParams{ident: parts[1], rounds: shaCryptDefaultRounds}
+	rest := parts[2:]
+	if strings.HasPrefix(rest[0], "rounds=") {
+		rounds, err := strconv.Atoi(strings.TrimPrefix(rest[0], "rounds="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid sha-crypt rounds")
+		}
+		if rounds > maxShaCryptRounds {
+			return nil, fmt.Errorf("sha-crypt rounds too high")
+		}
+		params.rounds = min(max(rounds, shaCryptMinRounds), shaCryptMaxRounds)
+		params.customRounds = true
+		rest = rest[1:]
+	}
+	if len(rest) != 2 {
+		return nil, fmt.Errorf("malformed sha-crypt hash")
+	}
+
+	params.salt = rest[0]
+	if len(params.salt) > shaCryptMaxSaltLen {
+		params.salt = params.salt[:shaCryptMaxSaltLen]
+	}
+	params.checksum = rest[1]
+	if params.checksum == "" {
+		return nil, fmt.Errorf("sha-crypt hash is missing its checksum")
+	}
+	return params, nil
+}
+
+func verifySHACrypt(password, encoded string) bool {
+	params, err := parseSHACrypt(encoded)
+	if err != nil {
+		return false
+	}
+	computed := shaCrypt([]byte(password), params)
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(params.checksum)) == 1
+}
+
+// shaCrypt returns the encoded checksum part of a SHA-crypt hash.
+func shaCrypt(password []byte, params *shaCryptParams) string {
+	newHash, order, tail := sha256.New, sha256CryptOrder, 3
+	if params.ident == "6" {
+		newHash, order, tail = sha512.New, sha512CryptOrder, 2
+	}
+	salt := []byte(params.salt)
+
+	// Digest B: password, salt, password.
+	b := sum(newHash, password, salt, password)
+
+	// Digest A.
+	h := newHash()
+	h.Write(password)
+	h.Write(salt)
+	h.Write(repeatTo(b, len(password)))
+	for n := len(password); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write(b)
+		} else {
+			h.Write(password)
+		}
+	}
+	a := h.Sum(nil)
+
+	// Digest DP and the derived byte sequence P.
+	h = newHash()
+	for range password {
+		h.Write(password)
+	}
+	p := repeatTo(h.Sum(nil), len(password))
+
+	// Digest DS and the derived byte sequence S.
+	h = newHash()
+	for i := 0; i < 16+int(a[0]); i++ {
+		h.Write(salt)
+	}
+	s := repeatTo(h.Sum(nil), len(salt))
+
+	c := a
+	for i := 0; i < params.rounds; i++ {
+		h = newHash()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	var out strings.Builder
+	for _, idx := range order {
+		encodeCrypt64(&out, c[idx[0]], c[idx[1]], c[idx[2]], 4)
+	}
+	if tail == 3 {
+		encodeCrypt64(&out, 0, c[31], c[30], 3)
+	} else {
+		encodeCrypt64(&out, 0, 0, c[63], 2)
+	}
+	return out.String()
+}
+
+func sum(newHash func() hash.Hash, chunks ...[]byte) []byte {
+	h := newHash()
+	for _, chunk := range chunks {
+		h.Write(chunk)
+	}
+	return h.Sum(nil)
+}
+
+func repeatTo(src []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		out = append(out, src[:min(len(src), n-len(out))]...)
+	}
+	return out
+}
+
+func encodeCrypt64(out *strings.Builder, b2, b1, b0 byte, n int) {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for i := 0; i < n; i++ {
+		out.WriteByte(cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+}
@@ -1 +1,488 @@
 package utils
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/language"
+)
+
+// Username rejection reasons.
+var (
+	ErrUsernameLength   = NewAppError(http.StatusBadRequest, "username_invalid_length", "username has an invalid length")
+	ErrUsernameFormat   = NewAppError(http.StatusBadRequest, "username_invalid_format", "username contains invalid characters")
+	ErrUsernameReserved = NewAppError(http.StatusBadRequest, "username_reserved", "username is reserved")
+)
+
+// Email rejection reasons, reported in EmailValidationError.Reason.
+const (
+	EmailReasonLength           = "invalid_length"
+	EmailReasonSyntax           = "invalid_syntax"
+	EmailReasonDomain           = "invalid_domain"
+	EmailReasonDomainNotAllowed = "domain_not_allowed"
+	EmailReasonDomainBlocked    = "domain_blocked"
+	EmailReasonDisposable       = "disposable_domain"
+)
+
+const (
+	maxEmailLength      = 254
+	maxEmailLocalLength = 64
+)
+
+// EmailValidationError explains why an email address was rejected.
+type EmailValidationError struct {
+	Reason string
+}
+
+func (e *EmailValidationError) Error() string {
+	switch e.Reason {
+	case EmailReasonDomainNotAllowed, EmailReasonDomainBlocked:
+		return "email domain is not allowed"
+	case EmailReasonDisposable:
+		return "disposable email addresses are not allowed"
+	default:
+		return "invalid email format"
+	}
+}
+
+// EmailDomains restricts which domains ValidateEmail accepts. It is set from
+// configuration at startup; nil accepts every domain.
+var EmailDomains *EmailDomainPolicy
+
+// ValidateEmail checks that email is a single bare RFC 5322 address (no
+// display name or angle brackets) with a resolvable-looking domain, and that
+// the domain passes EmailDomains. It returns an *EmailValidationError.
+func ValidateEmail(email string) error {
+	if err := validateEmailSyntax(email); err != nil {
+		return err
+	}
+
+	if EmailDomains != nil {
+		domain := email[strings.LastIndex(email, "@")+1:]
+		if reason := EmailDomains.check(domain); reason != "" {
+			return &EmailValidationError{Reason: reason}
+		}
+	}
+	return nil
+}
+
+// validateEmailSyntax performs the checks of ValidateEmail that don't depend
+// on configuration.
+func validateEmailSyntax(email string) error {
+	if len(email) < 3 || len(email) > maxEmailLength {
+		return &EmailValidationError{Reason: EmailReasonLength}
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return &EmailValidationError{Reason: EmailReasonSyntax}
+	}
+
+	at := strings.LastIndex(email, "@")
+	local, domain := email[:at], email[at+1:]
+	if len(local) > maxEmailLocalLength {
+		return &EmailValidationError{Reason: EmailReasonLength}
+	}
+	if !isEmailDomainValid(domain) {
+		return &EmailValidationError{Reason: EmailReasonDomain}
+	}
+	return nil
+}
+
+// isEmailDomainValid requires a dotted host name; address literals such as
+// [127.0.0.1] and single-label hosts are rejected.
+func isEmailDomainValid(domain string) bool {
+	if strings.HasPrefix(domain, "[") || !strings.Contains(domain, ".") {
+		return false
+	}
+	_, err := idna.Registration.ToASCII(domain)
+	return err == nil
+}
+
+// EmailDomainPolicy holds allow, deny and disposable domain lists. A listed
+// domain also matches its subdomains.
+type EmailDomainPolicy struct {
+	allow      map[string]bool
+	deny       map[string]bool
+	disposable map[string]bool
+}
+
+// NewEmailDomainPolicy builds a policy. When allow is non-empty only those
+// domains are accepted. disposableFile, if set, names a file with one domain
+// per line; blank lines and lines starting with # are ignored.
+func NewEmailDomainPolicy(allow, deny []string, disposableFile string) (*EmailDomainPolicy, error) {
+	p := &EmailDomainPolicy{
+		allow:      domainSet(allow),
+		deny:       domainSet(deny),
+		disposable: map[string]bool{},
+	}
+
+	if disposableFile != "" {
+		f, err := os.Open(disposableFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open disposable domain list: %w", err)
+		}
+		defer f.Close()
+
+		var domains []string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				domains = append(domains, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read disposable domain list: %w", err)
+		}
+		p.disposable = domainSet(domains)
+	}
+
+	return p, nil
+}
+
+// check returns the rejection reason for domain, or "" if it is accepted.
+// Allow-listed domains skip the disposable check.
+func (p *EmailDomainPolicy) check(domain string) string {
+	domain = NormalizeEmailDomain(domain)
+	if matchesDomain(p.deny, domain) {
+		return EmailReasonDomainBlocked
+	}
+	if len(p.allow) > 0 {
+		if !matchesDomain(p.allow, domain) {
+			return EmailReasonDomainNotAllowed
+		}
+		return ""
+	}
+	if matchesDomain(p.disposable, domain) {
+		return EmailReasonDisposable
+	}
+	return ""
+}
+
+func matchesDomain(set map[string]bool, domain string) bool {
+	for {
+		if set[domain] {
+			return true
+		}
+		dot := strings.IndexByte(domain, '.')
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+func domainSet(domains []string) map[string]bool {
+	set := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		if d = NormalizeEmailDomain(d); d != "" {
+			set[d] = true
+		}
+	}
+	return set
+}
+
+const (
+	MaxProfileNameLength = 100
+	MaxAvatarURLLength   = 2048
+	// MaxMetadataSize limits the encoded size of a metadata object in bytes.
+	MaxMetadataSize = 16 * 1024
+)
+
+// IsLocaleValid reports whether locale is a well-formed BCP 47 language tag
+// such as "en" or "pt-BR".
+func IsLocaleValid(locale string) bool {
+	_, err := language.Parse(locale)
+	return err == nil
+}
+
+// IsTimezoneValid reports whether tz is a known IANA time zone name.
+func IsTimezoneValid(tz string) bool {
+	if tz == "" || tz == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(tz)
+	return err == nil
+}
+
+// IsImageURLValid accepts absolute http and https URLs, for avatars and logos.
+func IsImageURLValid(raw string) bool {
+	if len(raw) > MaxAvatarURLLength {
+		return false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+// IsRedirectURIValid accepts absolute URIs without a fragment that an OAuth
+// client can register. Plain http is only allowed for loopback addresses;
+// native apps may use private-use schemes in reverse domain notation such
+// as com.example.app:/callback (RFC 8252).
+func IsRedirectURIValid(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Fragment != "" || strings.Contains(raw, "#") {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return strings.Contains(u.Scheme, ".")
+	}
+}
+
+// IsProfileNameValid checks a display, given or family name.
+func IsProfileNameValid(name string) bool {
+	return len([]rune(name)) <= MaxProfileNameLength && !strings.ContainsAny(name, "\r\n\t")
+}
+
+// UsernamePolicy holds the configurable rules for usernames.
+type UsernamePolicy struct {
+	minLength int
+	maxLength int
+	pattern   *regexp.Regexp
+	reserved  map[string]bool
+}
+
+// NewUsernamePolicy compiles the format rules. Reserved words are compared
+// case-insensitively.
+func NewUsernamePolicy(minLength, maxLength int, pattern string, reserved []string) (*UsernamePolicy, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid username pattern: %w", err)
+	}
+	if minLength < 1 || maxLength < minLength {
+		return nil, fmt.Errorf("invalid username length bounds %d..%d", minLength, maxLength)
+	}
+
+	words := make(map[string]bool, len(reserved))
+	for _, w := range reserved {
+		if w = strings.TrimSpace(w); w != "" {
+			words[strings.ToLower(w)] = true
+		}
+	}
+
+	return &UsernamePolicy{
+		minLength: minLength,
+		maxLength: maxLength,
+		pattern:   re,
+		reserved:  words,
+	}, nil
+}
+
+// Validate returns one of the ErrUsername* errors if username breaks the
+// policy.
+func (p *UsernamePolicy) Validate(username string) error {
+	if n := len([]rune(username)); n < p.minLength || n > p.maxLength {
+		return ErrUsernameLength.WithMessagef("username must be %d to %d characters", p.minLength, p.maxLength)
+	}
+	// Usernames are never confused with emails at login
+	if strings.Contains(username, "@") || !p.pattern.MatchString(username) {
+		return ErrUsernameFormat
+	}
+	if p.reserved[strings.ToLower(username)] {
+		return ErrUsernameReserved
+	}
+	return nil
+}
+
+// FieldError describes one failed validation rule.
+type FieldError struct {
+	Field   string `json:"field"` // JSON name of the field
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors lists every invalid field of a request.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ValidateStruct enforces the `validate` tags on the exported fields of a
+// struct (or pointer to one) and returns ValidationErrors, or nil if all
+// fields are valid. Rules are comma-separated and checked in order; only the
+// first failure per field is reported. Supported rules:
+//
+//	required          the value must not be empty (blank strings are empty)
+//	required_without=F required unless the field named F is set
+//	omitempty         skip the remaining rules when the value is empty
+//	email             a bare RFC 5322 address
+//	min=N, max=N      length of strings (in characters), slices and maps,
+//	                  or the value of numbers
+//	oneof=a b c       one of the space-separated values
+//
+// An unknown rule is a programming error and panics.
+func ValidateStruct(s interface{}) error {
+	v := reflect.ValueOf(s)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs ValidationErrors
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("validate")
+		if !field.IsExported() || tag == "" || tag == "-" {
+			continue
+		}
+		if fe := validateField(v, v.Field(i), jsonFieldName(field), tag); fe != nil {
+			errs = append(errs, *fe)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateField(parent, value reflect.Value, name, tag string) *FieldError {
+	empty := isEmptyValue(value)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		rule, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		fail := func(message string) *FieldError {
+			return &FieldError{Field: name, Rule: rule, Param: param, Message: message}
+		}
+
+		switch rule {
+		case "omitempty":
+			if empty {
+				return nil
+			}
+		case "required":
+			if empty {
+				return fail(name + " is required")
+			}
+		case "required_without":
+			other := parent.FieldByName(param)
+			if !other.IsValid() {
+				panic(fmt.Sprintf("validate: required_without references unknown field %q", param))
+			}
+			if empty && isEmptyValue(other) {
+				return fail(fmt.Sprintf("%s is required when %s is not set", name, jsonFieldNameOf(parent, param)))
+			}
+		case "email":
+			if empty {
+				continue
+			}
+			if value.Kind() != reflect.String || validateEmailSyntax(value.String()) != nil {
+				return fail(name + " must be a valid email address")
+			}
+		case "min", "max":
+			if empty && value.Kind() == reflect.Pointer {
+				continue
+			}
+			limit, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				panic(fmt.Sprintf("validate: invalid %s parameter %q", rule, param))
+			}
+			size, unit := measure(value)
+			if rule == "min" && size < limit {
+				return fail(fmt.Sprintf("%s must be at least %s%s", name, param, unit))
+			}
+			if rule == "max" && size > limit {
+				return fail(fmt.Sprintf("%s must be at most %s%s", name, param, unit))
+			}
+		case "oneof":
+			if empty && value.Kind() == reflect.Pointer {
+				continue
+			}
+			actual := fmt.Sprint(value.Interface())
+			allowed := strings.Fields(param)
+			found := false
+			for _, a := range allowed {
+				if a == actual {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fail(fmt.Sprintf("%s must be one of: %s", name, strings.Join(allowed, ", ")))
+			}
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q", rule))
+		}
+	}
+	return nil
+}
+
+// measure returns what min and max compare against, and the unit used in
+// messages.
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	default:
+		panic(fmt.Sprintf("validate: min and max don't apply to %s", v.Kind()))
+	}
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func jsonFieldNameOf(parent reflect.Value, fieldName string) string {
+	field, _ := parent.Type().FieldByName(fieldName)
+	return jsonFieldName(field)
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type validatedRequest struct {
+	Email    string   `json:"email" validate:"required,email"`
+	Password string   `json:"password" validate:"required_without=Token,omitempty,min=8"`
+	Token    string   `json:"token"`
+	Name     string   `json:"name" validate:"omitempty,max=5"`
+	Role     string   `json:"role" validate:"omitempty,oneof=admin member"`
+	Scopes   []string `json:"scopes" validate:"max=2"`
+	Limit    *int     `json:"limit" validate:"min=1,max=100"`
+	Ignored  string   `validate:"-"`
+	internal string   `validate:"required"`
+}
+
+func TestValidateStruct(t *testing.T) {
+	valid := func() validatedRequest {
+		return validatedRequest{Email: "user@example.com", Password: "long enough"}
+	}
+	zero, hundredOne := 0, 101
+
+	tests := []struct {
+		name   string
+		modify func(r *validatedRequest)
+		want   []FieldError // only Field and Rule are compared
+	}{
+		{"valid", func(r *validatedRequest) {}, nil},
+		{"missing required", func(r *validatedRequest) { r.Email = "" }, []FieldError{{Field: "email", Rule: "required"}}},
+		{"blank is empty", func(r *validatedRequest) { r.Email = "   " }, []FieldError{{Field: "email", Rule: "required"}}},
+		{"invalid email", func(r *validatedRequest) { r.Email = "User <user@example.com>" }, []FieldError{{Field: "email", Rule: "email"}}},
+		{"required without both", func(r *validatedRequest) { r.Password = "" }, []FieldError{{Field: "password", Rule: "required_without"}}},
+		{"required without other set", func(r *validatedRequest) { r.Password, r.Token = "", "token" }, nil},
+		{"min after omitempty", func(r *validatedRequest) { r.Password = "short" }, []FieldError{{Field: "password", Rule: "min"}}},
+		{"max counts characters", func(r *validatedRequest) { r.Name = "Zoë Ü" }, nil},
+		{"max exceeded", func(r *validatedRequest) { r.Name = "Zoë Üx" }, []FieldError{{Field: "name", Rule: "max"}}},
+		{"oneof", func(r *validatedRequest) { r.Role = "owner" }, []FieldError{{Field: "role", Rule: "oneof"}}},
+		{"max items", func(r *validatedRequest) { r.Scopes = []string{"a", "b", "c"} }, []FieldError{{Field: "scopes", Rule: "max"}}},
+		{"nil pointer skips min", func(r *validatedRequest) { r.Limit = nil }, nil},
+		{"pointer below min", func(r *validatedRequest) { r.Limit = &zero }, []FieldError{{Field: "limit", Rule: "min"}}},
+		{"pointer above max", func(r *validatedRequest) { r.Limit = &hundredOne }, []FieldError{{Field: "limit", Rule: "max"}}},
+		{
+			"every field reported",
+			func(r *validatedRequest) { r.Email, r.Role = "", "owner" },
+			[]FieldError{{Field: "email", Rule: "required"}, {Field: "role", Rule: "oneof"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid()
+			tt.modify(&r)
+			err := ValidateStruct(&r)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("ValidateStruct = %v, want nil", err)
+				}
+				return
+			}
+
+			var errs ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("ValidateStruct = %v, want ValidationErrors", err)
+			}
+			var got []FieldError
+			for _, fe := range errs {
+				if fe.Message == "" {
+					t.Errorf("%s has no message", fe.Field)
+				}
+				got = append(got, FieldError{Field: fe.Field, Rule: fe.Rule})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateStruct = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateStructIgnoresNonStructs(t *testing.T) {
+	var nilRequest *validatedRequest
+	for _, v := range []interface{}{nil, nilRequest, "string", 42} {
+		if err := ValidateStruct(v); err != nil {
+			t.Errorf("ValidateStruct(%#v) = %v", v, err)
+		}
+	}
+}
+
+func TestValidateStructPanicsOnUnknownRule(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("unknown rule didn't panic")
+		}
+	}()
+	ValidateStruct(struct {
+		Name string `validate:"uppercase"`
+	}{Name: "name"})
+}
@@ -0,0 +1,3 @@
+-- Imported hashes (e.g. firebase-scrypt with its embedded signer key) can be
+-- longer than a bcrypt hash.
+ALTER TABLE users ALTER COLUMN password TYPE TEXT;
@@ -0,0 +1,9 @@
+ALTER TABLE users
+    ADD COLUMN display_name TEXT,
+    ADD COLUMN given_name TEXT,
+    ADD COLUMN family_name TEXT,
+    ADD COLUMN locale TEXT,
+    ADD COLUMN timezone TEXT,
+    ADD COLUMN avatar_url TEXT,
+    ADD COLUMN user_metadata JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN app_metadata JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN username TEXT;
+
+CREATE UNIQUE INDEX idx_users_username_lower ON users (lower(username));
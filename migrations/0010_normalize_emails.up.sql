@@ -0,0 +1,6 @@
+-- Fails if emails collide case-insensitively; run cmd/emaildedup to find
+-- and resolve them first.
+CREATE UNIQUE INDEX idx_users_email_lower ON users (lower(email));
+
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
+UPDATE invitations SET email = lower(email) WHERE email <> lower(email);
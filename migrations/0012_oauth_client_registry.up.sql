@@ -0,0 +1,10 @@
+ALTER TABLE oauth_clients
+    ADD COLUMN type VARCHAR(16) NOT NULL DEFAULT 'public',
+    ADD COLUMN secret_hash TEXT NOT NULL DEFAULT '',
+    ADD COLUMN previous_secret_hash TEXT NOT NULL DEFAULT '',
+    ADD COLUMN previous_secret_expires_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN logo_url TEXT NOT NULL DEFAULT '',
+    ADD COLUMN grant_types JSONB NOT NULL DEFAULT '["authorization_code", "refresh_token"]',
+    ADD COLUMN scopes JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN access_token_lifetime INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN refresh_token_lifetime INTEGER NOT NULL DEFAULT 0;
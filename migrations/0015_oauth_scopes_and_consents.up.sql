@@ -0,0 +1,25 @@
+CREATE TABLE oauth_scopes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Register the scopes existing clients already use
+INSERT INTO oauth_scopes (name)
+SELECT DISTINCT jsonb_array_elements_text(scopes) FROM oauth_clients
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE oauth_clients ADD COLUMN first_party BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE oauth_consents (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id VARCHAR(255) NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    scopes JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_oauth_consents_user_client ON oauth_consents(user_id, client_id);
+CREATE INDEX idx_oauth_consents_client_id ON oauth_consents(client_id);
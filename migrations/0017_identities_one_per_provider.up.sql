@@ -0,0 +1,3 @@
+-- Users link at most one account per identity provider
+DROP INDEX IF EXISTS idx_identities_user_id;
+CREATE UNIQUE INDEX idx_identities_user_provider ON identities(user_id, provider);
@@ -51,6 +51,16 @@ func Migrate(db *gorm.DB) error {
 	err := db.AutoMigrate(
 		// Add your models here
 		&models.User{},
+		&models.Permission{},
+		&models.Role{},
+		&models.Organization{},
+		&models.OrganizationMember{},
+		&models.Invitation{},
+		&models.AuditEvent{},
+		&models.OAuthClient{},
+		&models.OAuthScope{},
+		&models.OAuthConsent{},
+		&models.Identity{},
 		&models.TokenPair{},
 	)
 	if err != nil {
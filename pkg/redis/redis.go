@@ -60,6 +60,26 @@ func (r *RedisClient) DeleteRefreshToken(ctx context.Context, userID string) err
 	return r.Del(ctx, "refresh:"+userID)
 }
 
+func (r *RedisClient) DeleteClientRefreshTokens(ctx context.Context, userID string) error {
+	iter := r.client.Scan(ctx, 0, "refresh:"+userID+":*", 100).Iterator()
+	for iter.Next(ctx) {
+		if err := r.Del(ctx, iter.Val()); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+func (r *RedisClient) DeleteRefreshTokensOfClient(ctx context.Context, clientID string) error {
+	iter := r.client.Scan(ctx, 0, "refresh:*:"+clientID, 100).Iterator()
+	for iter.Next(ctx) {
+		if err := r.Del(ctx, iter.Val()); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
 func (r *RedisClient) BlacklistToken(ctx context.Context, token string, expiry time.Duration) error {
 	return r.Set(ctx, "blacklist:"+token, "1", expiry)
 }
@@ -68,6 +88,118 @@ func (r *RedisClient) IsTokenBlacklisted(ctx context.Context, token string) (boo
 	return r.Exists(ctx, "blacklist:"+token)
 }
 
+func (r *RedisClient) SetRevocationWatermark(ctx context.Context, userID string, at time.Time, expiry time.Duration) error {
+	return r.Set(ctx, "revoked_before:"+userID, at.Unix(), expiry)
+}
+
+func (r *RedisClient) GetRevocationWatermark(ctx context.Context, userID string) (int64, error) {
+	ts, err := r.client.Get(ctx, "revoked_before:"+userID).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return ts, err
+}
+
+func (r *RedisClient) StorePendingEmailChange(ctx context.Context, userID, value string, expiry time.Duration) error {
+	return r.Set(ctx, "email_change:"+userID, value, expiry)
+}
+
+func (r *RedisClient) GetPendingEmailChange(ctx context.Context, userID string) (string, error) {
+	value, err := r.Get(ctx, "email_change:"+userID)
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+func (r *RedisClient) DeletePendingEmailChange(ctx context.Context, userID string) error {
+	return r.Del(ctx, "email_change:"+userID)
+}
+
+func (r *RedisClient) StoreAuthorizationCode(ctx context.Context, code, value string, expiry time.Duration) error {
+	return r.Set(ctx, "oauth_code:"+code, value, expiry)
+}
+
+func (r *RedisClient) ConsumeAuthorizationCode(ctx context.Context, code string) (string, error) {
+	value, err := r.client.GetDel(ctx, "oauth_code:"+code).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+func (r *RedisClient) MarkClientAssertionUsed(ctx context.Context, clientID, jti string, expiry time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, "client_assertion:"+clientID+":"+jti, "1", expiry).Result()
+}
+
+func (r *RedisClient) StoreDeviceCode(ctx context.Context, deviceCode, userCode, value string, expiry time.Duration) error {
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, "device_code:"+deviceCode, value, expiry)
+	pipe.Set(ctx, "user_code:"+userCode, deviceCode, expiry)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisClient) GetDeviceCode(ctx context.Context, deviceCode string) (string, error) {
+	value, err := r.client.Get(ctx, "device_code:"+deviceCode).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+func (r *RedisClient) FindDeviceCode(ctx context.Context, userCode string) (string, error) {
+	deviceCode, err := r.client.Get(ctx, "user_code:"+userCode).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return deviceCode, err
+}
+
+func (r *RedisClient) UpdateDeviceCode(ctx context.Context, deviceCode, value string) error {
+	err := r.client.SetArgs(ctx, "device_code:"+deviceCode, value, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
+
+func (r *RedisClient) ConsumeDeviceCode(ctx context.Context, deviceCode string) (string, error) {
+	value, err := r.client.GetDel(ctx, "device_code:"+deviceCode).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+func (r *RedisClient) MarkDeviceCodePolled(ctx context.Context, deviceCode string, interval time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, "device_poll:"+deviceCode, "1", interval).Result()
+}
+
+func (r *RedisClient) StoreLoginState(ctx context.Context, state, value string, expiry time.Duration) error {
+	return r.Set(ctx, "login_state:"+state, value, expiry)
+}
+
+func (r *RedisClient) ConsumeLoginState(ctx context.Context, state string) (string, error) {
+	value, err := r.client.GetDel(ctx, "login_state:"+state).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+func (r *RedisClient) StoreLoginCode(ctx context.Context, code, value string, expiry time.Duration) error {
+	return r.Set(ctx, "login_code:"+code, value, expiry)
+}
+
+func (r *RedisClient) ConsumeLoginCode(ctx context.Context, code string) (string, error) {
+	value, err := r.client.GetDel(ctx, "login_code:"+code).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
 func (r *RedisClient) IncrementRequestCount(ctx context.Context, key string, window time.Duration) (int, error) {
 	pipe := r.client.TxPipeline()
 	incr := pipe.Incr(ctx, key)